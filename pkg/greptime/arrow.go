@@ -0,0 +1,225 @@
+package greptime
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Response formats accepted by GreptimeDB /v1/sql (?format=...).
+const (
+	ResponseFormatArrow = "arrow"
+	ResponseFormatJSON  = "json"
+)
+
+// arrowFileMagic prefixes Arrow IPC files; GreptimeDB writes format=arrow bodies as IPC files.
+var arrowFileMagic = []byte("ARROW1")
+
+// isArrowBody reports whether a /v1/sql body is Arrow IPC rather than JSON.
+// Errors are always returned as JSON, even when format=arrow was requested.
+func isArrowBody(contentType string, body []byte) bool {
+	if bytes.HasPrefix(body, arrowFileMagic) {
+		return true
+	}
+	return strings.Contains(contentType, "arrow") && !bytes.HasPrefix(bytes.TrimSpace(body), []byte("{"))
+}
+
+// decodeArrowResponse decodes an Arrow IPC body (file or stream format) into a
+// Response whose single Output carries typed fields instead of JSON rows.
+// At most rowLimit rows are copied when rowLimit is positive.
+func decodeArrowResponse(body []byte, rowLimit int64) (*Response, error) {
+	var (
+		schema  *arrow.Schema
+		records []arrow.Record
+	)
+	defer func() {
+		for _, rec := range records {
+			rec.Release()
+		}
+	}()
+
+	if bytes.HasPrefix(body, arrowFileMagic) {
+		reader, err := ipc.NewFileReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("open arrow file: %w", err)
+		}
+		defer reader.Close()
+		schema = reader.Schema()
+		for i := 0; i < reader.NumRecords(); i++ {
+			rec, err := reader.RecordAt(i)
+			if err != nil {
+				return nil, fmt.Errorf("read arrow record batch %d: %w", i, err)
+			}
+			records = append(records, rec)
+		}
+	} else {
+		reader, err := ipc.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("open arrow stream: %w", err)
+		}
+		defer reader.Release()
+		schema = reader.Schema()
+		for reader.Next() {
+			rec := reader.Record()
+			rec.Retain()
+			records = append(records, rec)
+		}
+		if err := reader.Err(); err != nil {
+			return nil, fmt.Errorf("read arrow stream: %w", err)
+		}
+	}
+
+	frame, dropped := arrowRecordsToFrame(schema, records, rowLimit)
+	return &Response{Output: []Output{{Frame: frame, DroppedRows: dropped}}}, nil
+}
+
+// arrowRecordsToFrame concatenates record batches column by column into typed fields.
+// Integers keep full 64-bit precision and timestamps keep their native unit,
+// unlike the JSON fallback, which yields float64 numbers and millisecond times.
+// It returns the number of rows left out because of rowLimit.
+func arrowRecordsToFrame(schema *arrow.Schema, records []arrow.Record, rowLimit int64) (*data.Frame, int64) {
+	if schema == nil {
+		return data.NewFrame(""), 0
+	}
+
+	var total int64
+	for _, rec := range records {
+		total += rec.NumRows()
+	}
+	kept := total
+	if rowLimit > 0 && kept > rowLimit {
+		kept = rowLimit
+	}
+	rowCount := int(kept)
+
+	fields := make([]*data.Field, schema.NumFields())
+	for colIndex, arrowField := range schema.Fields() {
+		chunks := make([]arrow.Array, len(records))
+		for i, rec := range records {
+			chunks[i] = rec.Column(colIndex)
+		}
+
+		name := arrowField.Name
+		if name == "" {
+			name = fmt.Sprintf("column_%d", colIndex+1)
+		}
+		fields[colIndex] = arrowColumnToField(name, arrowField, chunks, rowCount)
+	}
+	return data.NewFrame("", fields...), total - kept
+}
+
+func arrowColumnToField(name string, arrowField arrow.Field, chunks []arrow.Array, rowCount int) *data.Field {
+	nullable := arrowField.Nullable
+	switch dt := arrowField.Type.(type) {
+	case *arrow.Int8Type, *arrow.Int16Type, *arrow.Int32Type, *arrow.Int64Type:
+		return arrowValuesToField(name, nullable, chunks, rowCount, func(col arrow.Array, i int) int64 {
+			switch a := col.(type) {
+			case *array.Int8:
+				return int64(a.Value(i))
+			case *array.Int16:
+				return int64(a.Value(i))
+			case *array.Int32:
+				return int64(a.Value(i))
+			default:
+				return col.(*array.Int64).Value(i)
+			}
+		})
+	case *arrow.Uint8Type, *arrow.Uint16Type, *arrow.Uint32Type, *arrow.Uint64Type:
+		return arrowValuesToField(name, nullable, chunks, rowCount, func(col arrow.Array, i int) uint64 {
+			switch a := col.(type) {
+			case *array.Uint8:
+				return uint64(a.Value(i))
+			case *array.Uint16:
+				return uint64(a.Value(i))
+			case *array.Uint32:
+				return uint64(a.Value(i))
+			default:
+				return col.(*array.Uint64).Value(i)
+			}
+		})
+	case *arrow.Float16Type, *arrow.Float32Type, *arrow.Float64Type:
+		return arrowValuesToField(name, nullable, chunks, rowCount, func(col arrow.Array, i int) float64 {
+			switch a := col.(type) {
+			case *array.Float16:
+				return float64(a.Value(i).Float32())
+			case *array.Float32:
+				return float64(a.Value(i))
+			default:
+				return col.(*array.Float64).Value(i)
+			}
+		})
+	case *arrow.Decimal128Type, *arrow.Decimal256Type:
+		return arrowValuesToField(name, nullable, chunks, rowCount, func(col arrow.Array, i int) float64 {
+			f, _ := strconv.ParseFloat(col.ValueStr(i), 64)
+			return f
+		})
+	case *arrow.BooleanType:
+		return arrowValuesToField(name, nullable, chunks, rowCount, func(col arrow.Array, i int) bool {
+			return col.(*array.Boolean).Value(i)
+		})
+	case *arrow.TimestampType:
+		unit := dt.Unit
+		return arrowValuesToField(name, nullable, chunks, rowCount, func(col arrow.Array, i int) time.Time {
+			return col.(*array.Timestamp).Value(i).ToTime(unit)
+		})
+	case *arrow.Date32Type:
+		return arrowValuesToField(name, nullable, chunks, rowCount, func(col arrow.Array, i int) time.Time {
+			return col.(*array.Date32).Value(i).ToTime()
+		})
+	case *arrow.Date64Type:
+		return arrowValuesToField(name, nullable, chunks, rowCount, func(col arrow.Array, i int) time.Time {
+			return col.(*array.Date64).Value(i).ToTime()
+		})
+	case *arrow.StringType, *arrow.LargeStringType, *arrow.StringViewType:
+		return arrowValuesToField(name, true, chunks, rowCount, func(col arrow.Array, i int) string {
+			return col.(array.StringLike).Value(i)
+		})
+	default:
+		// Binary, durations, lists, dictionaries, ...: keep the textual form, like the JSON path.
+		return arrowValuesToField(name, true, chunks, rowCount, func(col arrow.Array, i int) string {
+			return col.ValueStr(i)
+		})
+	}
+}
+
+// arrowValuesToField copies chunks into a single []T (or []*T when nullable) field,
+// stopping once rowCount values have been copied.
+func arrowValuesToField[T any](name string, nullable bool, chunks []arrow.Array, rowCount int, value func(arrow.Array, int) T) *data.Field {
+	var field *data.Field
+	if nullable {
+		values := make([]*T, 0, rowCount)
+		for _, col := range chunks {
+			for i := 0; i < col.Len() && len(values) < rowCount; i++ {
+				if col.IsNull(i) {
+					values = append(values, nil)
+					continue
+				}
+				v := value(col, i)
+				values = append(values, &v)
+			}
+		}
+		field = data.NewField(name, nil, values)
+	} else {
+		values := make([]T, 0, rowCount)
+		for _, col := range chunks {
+			for i := 0; i < col.Len() && len(values) < rowCount; i++ {
+				if col.IsNull(i) {
+					var zero T
+					values = append(values, zero)
+					continue
+				}
+				values = append(values, value(col, i))
+			}
+		}
+		field = data.NewField(name, nil, values)
+	}
+	field.SetConfig(&data.FieldConfig{})
+	return field
+}
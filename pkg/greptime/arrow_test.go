@@ -0,0 +1,254 @@
+package greptime
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+)
+
+var metricSchema = arrow.NewSchema([]arrow.Field{
+	{Name: "ts", Type: &arrow.TimestampType{Unit: arrow.Nanosecond}},
+	{Name: "host", Type: arrow.BinaryTypes.String, Nullable: true},
+	{Name: "count", Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+	{Name: "value", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+}, nil)
+
+// writeMetricArrow encodes rows of (ts ns, host, count, value) as an Arrow IPC file,
+// split into batches of batchSize rows.
+func writeMetricArrow(t testing.TB, rows int, batchSize int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer, err := ipc.NewFileWriter(&buf, ipc.WithSchema(metricSchema))
+	require.NoError(t, err)
+
+	builder := array.NewRecordBuilder(memory.DefaultAllocator, metricSchema)
+	defer builder.Release()
+	for start := 0; start < rows; start += batchSize {
+		for i := start; i < start+batchSize && i < rows; i++ {
+			builder.Field(0).(*array.TimestampBuilder).Append(arrow.Timestamp(1700000000000000000 + int64(i)))
+			builder.Field(1).(*array.StringBuilder).Append(fmt.Sprintf("host-%d", i%10))
+			builder.Field(2).(*array.Int64Builder).Append(9007199254740993 + int64(i))
+			builder.Field(3).(*array.Float64Builder).Append(float64(i) / 2)
+		}
+		rec := builder.NewRecord()
+		require.NoError(t, writer.Write(rec))
+		rec.Release()
+	}
+	require.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+func metricJSON(rows int) []byte {
+	var b strings.Builder
+	b.WriteString(`{"code":0,"output":[{"records":{"schema":{"column_schemas":[`)
+	b.WriteString(`{"name":"ts","data_type":"TimestampNanosecond"},{"name":"host","data_type":"String"},`)
+	b.WriteString(`{"name":"count","data_type":"Int64"},{"name":"value","data_type":"Float64"}]},"rows":[`)
+	for i := 0; i < rows; i++ {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `[%d,"host-%d",%d,%g]`, 1700000000000000000+int64(i), i%10, 9007199254740993+int64(i), float64(i)/2)
+	}
+	b.WriteString(`]}}]}`)
+	return []byte(b.String())
+}
+
+func TestDecodeArrowResponse_TypedFields(t *testing.T) {
+	body := writeMetricArrow(t, 5, 2)
+
+	response, err := decodeArrowResponse(body, 0)
+	require.NoError(t, err)
+
+	frames, err := ResponseToFrames(response, "A")
+	require.NoError(t, err)
+	require.Len(t, frames, 1)
+
+	frame := frames[0]
+	require.Equal(t, "Result 1", frame.Name)
+	require.Equal(t, "A", frame.RefID)
+	require.Equal(t, 5, frame.Rows())
+	require.Equal(t, data.FieldTypeTime, frame.Fields[0].Type())
+	require.Equal(t, data.FieldTypeNullableString, frame.Fields[1].Type())
+	require.Equal(t, data.FieldTypeNullableInt64, frame.Fields[2].Type())
+	require.Equal(t, data.FieldTypeNullableFloat64, frame.Fields[3].Type())
+
+	// Nanosecond timestamps and integers above 2^53 survive unchanged.
+	require.Equal(t, time.Unix(0, 1700000000000000004).UTC(), frame.Fields[0].At(4))
+	require.Equal(t, int64(9007199254740997), *frame.Fields[2].At(4).(*int64))
+	require.Equal(t, "host-3", *frame.Fields[1].At(3).(*string))
+}
+
+func TestResponseFormats_FieldTypes(t *testing.T) {
+	arrowResponse, err := decodeArrowResponse(writeMetricArrow(t, 5, 5), 0)
+	require.NoError(t, err)
+	jsonResponse, err := decodeJSONResponse(bytes.NewReader(metricJSON(5)), decodeLimits{})
+	require.NoError(t, err)
+
+	arrowFrames, err := ResponseToFrames(arrowResponse, "A")
+	require.NoError(t, err)
+	jsonFrames, err := ResponseToFrames(jsonResponse, "A")
+	require.NoError(t, err)
+	arrowFrame, jsonFrame := arrowFrames[0], jsonFrames[0]
+
+	// Times: full precision over Arrow, milliseconds over JSON.
+	require.Equal(t, data.FieldTypeTime, arrowFrame.Fields[0].Type())
+	require.Equal(t, data.FieldTypeTime, jsonFrame.Fields[0].Type())
+	require.Equal(t, time.Unix(0, 1700000000000000004).UTC(), arrowFrame.Fields[0].At(4))
+	require.Equal(t, time.UnixMilli(1700000000000), jsonFrame.Fields[0].At(4))
+
+	// Integers: int64 over Arrow, float64 over JSON.
+	require.Equal(t, data.FieldTypeNullableInt64, arrowFrame.Fields[2].Type())
+	require.Equal(t, data.FieldTypeNullableFloat64, jsonFrame.Fields[2].Type())
+	require.Equal(t, int64(9007199254740997), *arrowFrame.Fields[2].At(4).(*int64))
+	require.Equal(t, float64(9007199254740997), *jsonFrame.Fields[2].At(4).(*float64))
+
+	// Strings and floats are the same either way.
+	for _, col := range []int{1, 3} {
+		require.Equal(t, arrowFrame.Fields[col].Type(), jsonFrame.Fields[col].Type())
+		for row := 0; row < 5; row++ {
+			require.Equal(t, arrowFrame.Fields[col].At(row), jsonFrame.Fields[col].At(row))
+		}
+	}
+}
+
+func TestDecodeArrowResponse_RowLimit(t *testing.T) {
+	body := writeMetricArrow(t, 10, 4)
+
+	response, err := decodeArrowResponse(body, 6)
+	require.NoError(t, err)
+	require.Equal(t, int64(4), response.Output[0].DroppedRows)
+
+	frames, err := ResponseToFrames(response, "A")
+	require.NoError(t, err)
+	require.Equal(t, 6, frames[0].Rows())
+	for _, field := range frames[0].Fields {
+		require.Equal(t, 6, field.Len())
+	}
+	require.Contains(t, frames[0].Meta.Notices[0].Text, "4 rows were dropped")
+}
+
+func TestDecodeArrowResponse_Nulls(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "v", Type: arrow.PrimitiveTypes.Int32, Nullable: true},
+		{Name: "d", Type: arrow.FixedWidthTypes.Date32, Nullable: true},
+	}, nil)
+	builder := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer builder.Release()
+	builder.Field(0).(*array.Int32Builder).AppendValues([]int32{7, 0}, []bool{true, false})
+	builder.Field(1).(*array.Date32Builder).AppendValues([]arrow.Date32{1, 0}, []bool{true, false})
+	rec := builder.NewRecord()
+	defer rec.Release()
+
+	var buf bytes.Buffer
+	writer := ipc.NewWriter(&buf, ipc.WithSchema(schema))
+	require.NoError(t, writer.Write(rec))
+	require.NoError(t, writer.Close())
+
+	require.True(t, isArrowBody("application/vnd.apache.arrow.stream", buf.Bytes()))
+	response, err := decodeArrowResponse(buf.Bytes(), 0)
+	require.NoError(t, err)
+
+	frame := response.Output[0].Frame
+	require.Equal(t, int64(7), *frame.Fields[0].At(0).(*int64))
+	require.Nil(t, frame.Fields[0].At(1))
+	require.Equal(t, time.Unix(86400, 0).UTC(), *frame.Fields[1].At(0).(*time.Time))
+	require.Nil(t, frame.Fields[1].At(1))
+}
+
+func TestClient_ExecuteSQL_ResponseFormat(t *testing.T) {
+	arrowBody := writeMetricArrow(t, 3, 3)
+	var gotFormat string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotFormat = r.URL.Query().Get("format")
+		if gotFormat == ResponseFormatArrow {
+			w.Header().Set("Content-Type", "application/arrow")
+			w.Header().Set(headerExecutionTime, "12")
+			_, _ = w.Write(arrowBody)
+			return
+		}
+		_, _ = w.Write(metricJSON(3))
+	}))
+	defer ts.Close()
+
+	t.Run("arrow by default", func(t *testing.T) {
+		client := NewClient(ClientSettings{SQLURL: ts.URL + "/v1/sql"})
+		defer client.Close()
+
+		response, err := client.ExecuteSQL(context.Background(), "SELECT * FROM metrics", nil)
+		require.NoError(t, err)
+		require.Equal(t, ResponseFormatArrow, gotFormat)
+		require.Equal(t, int64(12), response.ExecutionTimeMs)
+		require.NotNil(t, response.Output[0].Frame)
+		require.Equal(t, 3, response.Output[0].Frame.Rows())
+	})
+
+	t.Run("json fallback", func(t *testing.T) {
+		client := NewClient(ClientSettings{SQLURL: ts.URL + "/v1/sql", ResponseFormat: ResponseFormatJSON})
+		defer client.Close()
+
+		response, err := client.ExecuteSQL(context.Background(), "SELECT * FROM metrics", nil)
+		require.NoError(t, err)
+		require.Empty(t, gotFormat)
+		require.NotNil(t, response.Output[0].Frame)
+		require.Equal(t, 3, response.Output[0].Frame.Rows())
+		require.Equal(t, data.FieldTypeNullableFloat64, response.Output[0].Frame.Fields[2].Type())
+	})
+
+	t.Run("json for several statements", func(t *testing.T) {
+		client := NewClient(ClientSettings{SQLURL: ts.URL + "/v1/sql"})
+		defer client.Close()
+
+		_, err := client.ExecuteSQL(context.Background(), "SET time_zone = 'UTC'; SELECT * FROM metrics", nil)
+		require.NoError(t, err)
+		require.Empty(t, gotFormat)
+	})
+}
+
+const benchmarkRows = 1_000_000
+
+// BenchmarkResponseToFrames_JSON and BenchmarkResponseToFrames_Arrow compare
+// decoding a 1M-row /v1/sql result in each response format:
+//
+//	go test ./pkg/greptime -run '^$' -bench ResponseToFrames -benchmem
+func BenchmarkResponseToFrames_JSON(b *testing.B) {
+	body := metricJSON(benchmarkRows)
+	b.SetBytes(int64(len(body)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var response Response
+		if err := json.Unmarshal(body, &response); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := ResponseToFrames(&response, "A"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkResponseToFrames_Arrow(b *testing.B) {
+	body := writeMetricArrow(b, benchmarkRows, 8192)
+	b.SetBytes(int64(len(body)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		response, err := decodeArrowResponse(body, 0)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := ResponseToFrames(response, "A"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package greptime
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// Authentication modes. An empty mode means AuthModeBasic.
+const (
+	// AuthModeBasic sends Username/Password, or nothing when Username is empty.
+	AuthModeBasic = "basic"
+	// AuthModeBearer sends a static BearerToken.
+	AuthModeBearer = "bearer"
+	// AuthModeOAuth forwards the signed-in Grafana user's Authorization header.
+	AuthModeOAuth = "oauth"
+)
+
+// ErrMissingOAuthToken is returned in AuthModeOAuth when Grafana forwarded no
+// Authorization header, e.g. because the user did not sign in through OAuth.
+var ErrMissingOAuthToken = errors.New("oauth pass-through is enabled but Grafana forwarded no Authorization header; sign in through the OAuth provider")
+
+// ErrAuthenticationFailed wraps answers rejecting the request's credentials.
+var ErrAuthenticationFailed = errors.New("greptime rejected the credentials")
+
+// authorizationHeader returns the Authorization header value for mode, or ""
+// when the request should not carry one.
+func authorizationHeader(mode, username, password, token string, forwarded http.Header) (string, error) {
+	switch mode {
+	case AuthModeBearer:
+		return "Bearer " + token, nil
+	case AuthModeOAuth:
+		if auth := forwarded.Get("Authorization"); auth != "" {
+			return auth, nil
+		}
+		return "", backend.DownstreamError(ErrMissingOAuthToken)
+	default:
+		if username == "" {
+			return "", nil
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password)), nil
+	}
+}
+
+// bearerToken extracts the token of a "Bearer <token>" header value.
+func bearerToken(authorization string) string {
+	scheme, token, ok := strings.Cut(authorization, " ")
+	if ok && strings.EqualFold(scheme, "bearer") {
+		return strings.TrimSpace(token)
+	}
+	return authorization
+}
+
+// isAuthStatus reports whether an HTTP status rejects the request's credentials.
+func isAuthStatus(status int) bool {
+	return status == http.StatusUnauthorized || status == http.StatusForbidden
+}
+
+// authError marks err as a credentials failure under mode.
+func authError(mode string, err error) error {
+	if mode == "" {
+		mode = AuthModeBasic
+	}
+	return fmt.Errorf("%w (%s auth): %w", ErrAuthenticationFailed, mode, err)
+}
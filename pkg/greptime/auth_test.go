@@ -0,0 +1,75 @@
+package greptime
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_AuthModes(t *testing.T) {
+	var authorization []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = append(authorization, r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte(`{"code":0,"output":[]}`))
+	}))
+	defer ts.Close()
+
+	forwarded := http.Header{"Authorization": {"Bearer user-token"}}
+	tests := []struct {
+		name     string
+		settings ClientSettings
+		want     string
+	}{
+		{name: "no credentials", settings: ClientSettings{}, want: ""},
+		{name: "basic", settings: ClientSettings{Username: "greptime", Password: "secret"}, want: "Basic Z3JlcHRpbWU6c2VjcmV0"},
+		{name: "bearer", settings: ClientSettings{AuthMode: AuthModeBearer, BearerToken: "static", Username: "ignored"}, want: "Bearer static"},
+		{name: "oauth", settings: ClientSettings{AuthMode: AuthModeOAuth, BearerToken: "ignored"}, want: "Bearer user-token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authorization = nil
+			tt.settings.SQLURL = ts.URL + "/v1/sql"
+			tt.settings.ResponseFormat = ResponseFormatJSON
+			client := NewClient(tt.settings)
+			defer client.Close()
+
+			_, err := client.ExecuteSQL(context.Background(), "SELECT 1", forwarded)
+			require.NoError(t, err)
+			require.Equal(t, []string{tt.want}, authorization)
+		})
+	}
+}
+
+func TestClient_OAuthWithoutToken(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer ts.Close()
+
+	client := NewClient(ClientSettings{SQLURL: ts.URL + "/v1/sql", AuthMode: AuthModeOAuth})
+	defer client.Close()
+
+	_, err := client.ExecuteSQL(context.Background(), "SELECT 1", nil)
+	require.ErrorIs(t, err, ErrMissingOAuthToken)
+	require.Zero(t, requests, "nothing is sent without a token")
+}
+
+func TestClient_AuthenticationFailed(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"code":7002,"error":"Invalid token"}`))
+	}))
+	defer ts.Close()
+
+	client := NewClient(ClientSettings{SQLURL: ts.URL + "/v1/sql", AuthMode: AuthModeBearer, BearerToken: "expired"})
+	defer client.Close()
+
+	_, err := client.ExecuteSQL(context.Background(), "SELECT 1", nil)
+	require.ErrorIs(t, err, ErrAuthenticationFailed)
+	require.ErrorContains(t, err, "bearer auth")
+	require.ErrorContains(t, err, "Invalid token")
+}
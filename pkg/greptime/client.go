@@ -1,37 +1,109 @@
 package greptime
 
 import (
+	"bufio"
 	"context"
+	"crypto/rand"
 	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
 )
 
+// maxErrorBodyBytes bounds how much of a non-2xx body is read into the error message.
+const maxErrorBodyBytes = 64 << 10
+
+// cancelTimeout bounds the process lookup and KILL issued after a cancelled query.
+const cancelTimeout = 5 * time.Second
+
+// queryTagPrefix starts the comment that identifies statements sent by this client.
+const queryTagPrefix = "grafana_query_id="
+
+// headerExecutionTime carries the server execution time for non-JSON response formats.
+const headerExecutionTime = "x-greptime-execution-time"
+
+// Querier runs SQL against GreptimeDB. Client (HTTP), FlightClient (native
+// Arrow Flight) and PostgresClient (PostgreSQL wire protocol) implement it and
+// return identical frames for the same query. Queries run in the database set
+// by WithDatabase, or in the settings' DefaultDatabase, and with the session
+// timezone set by WithTimezone.
+type Querier interface {
+	ExecuteSQL(ctx context.Context, sql string, forwarded http.Header) (*Response, error)
+	CheckEndpoints(ctx context.Context, forwarded http.Header) []EndpointStatus
+	Close()
+}
+
+var (
+	_ Querier = (*Client)(nil)
+	_ Querier = (*FlightClient)(nil)
+	_ Querier = (*PostgresClient)(nil)
+)
+
 // ClientSettings is the subset of datasource settings required for HTTP SQL.
 type ClientSettings struct {
-	SQLURL                string
-	DefaultDatabase       string
+	// SQLURL is the /v1/sql endpoint and PrometheusURL the Prometheus-compatible
+	// API root (e.g. http://host:4000/v1/prometheus/api/v1) of a single frontend.
+	SQLURL        string
+	PrometheusURL string
+	// Endpoints lists frontend base URLs (e.g. http://host:4000). When set it
+	// replaces SQLURL and PrometheusURL, and requests fail over between them.
+	Endpoints []string
+	// EndpointSelection is EndpointSelectionRoundRobin (default) or EndpointSelectionLeastLatency.
+	EndpointSelection string
+
+	DefaultDatabase string
+	// AuthMode is AuthModeBasic (default, Username/Password), AuthModeBearer
+	// (BearerToken) or AuthModeOAuth (the forwarded Authorization header).
+	AuthMode              string
 	Username              string
 	Password              string
+	BearerToken           string
 	HttpHeaders           map[string]string
 	ForwardGrafanaHeaders bool
-	QueryTimeout          time.Duration
-	TLSConfig             *tls.Config
-	Transport             http.RoundTripper
+	// Hints are query hints sent with every request; see ValidateHint and WithHints.
+	Hints        map[string]string
+	QueryTimeout time.Duration
+	// RowLimit caps the rows kept per result set while decoding; zero or less means unlimited.
+	RowLimit int64
+	// MaxResponseBytes caps the bytes read from a response body; zero or less means unlimited.
+	MaxResponseBytes int64
+	// ResponseFormat selects the /v1/sql body format: ResponseFormatArrow (default) or ResponseFormatJSON.
+	ResponseFormat string
+	// ConnMaxLifetime bounds how long pooled connections are kept around.
+	// Idle connections are closed every ConnMaxLifetime; zero disables recycling.
+	ConnMaxLifetime time.Duration
+	TLSConfig       *tls.Config
+	Transport       http.RoundTripper
+	// Retry controls retries of read-only statements; see RetryPolicy.
+	Retry RetryPolicy
 }
 
 // Client executes GreptimeDB HTTP SQL queries.
+// A Client is safe for concurrent use and is meant to live as long as the
+// datasource instance so that connections and TLS sessions are reused.
 type Client struct {
-	settings ClientSettings
-	http     *http.Client
+	settings  ClientSettings
+	http      *http.Client
+	endpoints *endpointPool
+
+	// cancels tracks the kills still running for cancelled queries. Kills
+	// are only added under mu before closing is set, so none races Close's Wait.
+	cancels sync.WaitGroup
+	mu      sync.Mutex
+	closing bool
+
+	closeOnce sync.Once
+	done      chan struct{}
 }
 
 func NewClient(settings ClientSettings) *Client {
@@ -47,32 +119,316 @@ func NewClient(settings ClientSettings) *Client {
 		timeout = 60 * time.Second
 	}
 
-	return &Client{
+	c := &Client{
 		settings: settings,
 		http: &http.Client{
 			Timeout:   timeout,
 			Transport: transport,
 		},
+		endpoints: newEndpointPool(settings),
+		done:      make(chan struct{}),
 	}
+	if settings.ConnMaxLifetime > 0 {
+		go c.recycleConnections(settings.ConnMaxLifetime)
+	}
+	if len(c.endpoints.endpoints) > 1 {
+		go c.recheckEndpoints()
+	}
+	return c
+}
+
+// recycleConnections periodically drops idle connections so that no pooled
+// connection outlives ConnMaxLifetime by more than one in-flight request.
+func (c *Client) recycleConnections(lifetime time.Duration) {
+	ticker := time.NewTicker(lifetime)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.http.CloseIdleConnections()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Close stops connection recycling and closes all idle connections.
+// In-flight requests are not interrupted; kills of cancelled queries are
+// waited for.
+func (c *Client) Close() {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		c.closing = true
+		c.mu.Unlock()
+		close(c.done)
+		c.cancels.Wait()
+		c.http.CloseIdleConnections()
+	})
 }
 
+// startCancel runs kill in the background, tracked by cancels, unless Close
+// has begun: kills started then would outlive the client.
+func (c *Client) startCancel(kill func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closing {
+		return
+	}
+	c.cancels.Add(1)
+	go func() {
+		defer c.cancels.Done()
+		kill()
+	}()
+}
+
+// ExecuteSQL runs sql through /v1/sql. Each statement is tagged with a query
+// identifier; when ctx is cancelled or QueryTimeout expires before the response
+// arrives, the matching server-side process is killed so abandoned scans stop
+// consuming resources.
+//
+// Statements run in order within one request, so leading SET or USE
+// statements apply to the ones after them. Each output records the statement
+// that produced it.
+//
+// Read-only statements are retried on transient failures according to
+// ClientSettings.Retry. All attempts share QueryTimeout, and each retry is
+// recorded in Response.Retries.
 func (c *Client) ExecuteSQL(ctx context.Context, sql string, forwarded http.Header) (*Response, error) {
+	queryCtx, cancel := context.WithTimeout(ctx, c.http.Timeout)
+	defer cancel()
+
+	queryID := newQueryID()
+	tagged := tagQuery(sql, queryID)
+
+	policy := c.settings.Retry.withDefaults()
+	maxAttempts := 1
+	if IsReadOnlyStatement(sql) {
+		maxAttempts = policy.MaxAttempts
+	}
+
+	candidates := c.endpoints.candidates()
+	var retries []string
+	for attempt := 1; ; attempt++ {
+		ep := candidates[(attempt-1)%len(candidates)]
+		start := time.Now()
+		response, err := c.executeSQL(queryCtx, ep, tagged, forwarded)
+		c.observe(queryCtx, ep, start, response != nil, err, policy)
+		if err != nil && queryCtx.Err() != nil {
+			// The caller has given up; do not hold it while the kill runs.
+			c.startCancel(func() { c.cancelQuery(ctx, ep, queryID, forwarded) })
+		}
+
+		// Statements that never reached the server may move to another endpoint
+		// even when they are not read-only.
+		retryable := attempt < maxAttempts && policy.retryable(err)
+		failover := isDialError(err) && attempt < len(candidates)
+		if err == nil || queryCtx.Err() != nil || !(retryable || failover) {
+			if response != nil {
+				response.Retries = retries
+				setStatements(response, sql)
+			}
+			return response, err
+		}
+
+		retries = append(retries, fmt.Sprintf("attempt %d failed: %v", attempt, err))
+		next := candidates[attempt%len(candidates)]
+		if next == ep {
+			delay := policy.backoff(attempt)
+			log.DefaultLogger.Warn("greptime query failed, retrying", "queryId", queryID, "attempt", attempt, "backoff", delay, "error", err)
+			if !sleepContext(queryCtx, delay) {
+				return nil, err
+			}
+			continue
+		}
+		log.DefaultLogger.Warn("greptime query failed, trying next endpoint", "queryId", queryID, "attempt", attempt,
+			"endpoint", ep.baseURL, "next", next.baseURL, "error", err)
+	}
+}
+
+// observe updates endpoint health after a request: any server answer counts
+// as healthy, while transport errors and gateway statuses eject the endpoint.
+func (c *Client) observe(ctx context.Context, ep *endpoint, start time.Time, answered bool, err error, policy RetryPolicy) {
+	switch {
+	case err == nil || answered:
+		c.endpoints.markSuccess(ep, time.Since(start))
+	case ctx.Err() == nil && ejectable(err, policy):
+		c.endpoints.markFailure(ep, err)
+	}
+}
+
+func (c *Client) executeSQL(ctx context.Context, ep *endpoint, sql string, forwarded http.Header) (*Response, error) {
 	form := url.Values{}
 	form.Set("sql", sql)
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.settings.SQLURL, strings.NewReader(form.Encode()))
+	sqlURL := ep.sqlURL
+	accept := "application/json"
+	// Arrow responses carry a single result set, so several statements are
+	// always fetched as JSON.
+	if c.responseFormat() == ResponseFormatArrow && len(SplitStatements(sql)) < 2 {
+		sqlURL = withQueryParam(sqlURL, "format", ResponseFormatArrow)
+		accept = "application/vnd.apache.arrow.file, application/json"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sqlURL, strings.NewReader(form.Encode()))
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Accept", accept)
+
+	if err := c.setHeaders(req, forwarded); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, backend.DownstreamError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+		return nil, c.statusError(ctx, resp, body)
+	}
+
+	parsed, err := c.decodeBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.TLS != nil {
+		parsed.PeerCertificates = resp.TLS.PeerCertificates
+	}
+
+	if parsed.Error != "" || parsed.Code != 0 {
+		if parsed.Error == "" {
+			parsed.Error = fmt.Sprintf("greptime error code %d", parsed.Code)
+		}
+		err := newError(parsed.Code, ErrorKindUnknown, parsed.Error, queryDatabase(ctx, c.settings.DefaultDatabase), nil)
+		return parsed, backend.DownstreamError(err)
+	}
+
+	return parsed, nil
+}
+
+// decodeBody decodes a successful /v1/sql body. JSON is streamed so that large
+// results never sit in memory twice; Arrow IPC files need random access and are
+// read whole, failing once MaxResponseBytes is exceeded.
+func (c *Client) decodeBody(resp *http.Response) (*Response, error) {
+	counter := &countingReader{r: resp.Body}
+	body := bufio.NewReader(counter)
+	peek, _ := body.Peek(len(arrowFileMagic))
+
+	if !isArrowBody(resp.Header.Get("Content-Type"), peek) {
+		parsed, err := decodeJSONResponse(body, decodeLimits{
+			RowLimit: c.settings.RowLimit,
+			MaxBytes: c.settings.MaxResponseBytes,
+		})
+		if err != nil {
+			return nil, backend.DownstreamError(fmt.Errorf("decode greptime response: %w", err))
+		}
+		setResponseStats(parsed, resp, counter.n)
+		return parsed, nil
+	}
+
+	var reader io.Reader = body
+	if c.settings.MaxResponseBytes > 0 {
+		reader = io.LimitReader(body, c.settings.MaxResponseBytes+1)
+	}
+	raw, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if c.settings.MaxResponseBytes > 0 && int64(len(raw)) > c.settings.MaxResponseBytes {
+		return nil, backend.DownstreamError(fmt.Errorf("greptime arrow response exceeds the %d byte limit", c.settings.MaxResponseBytes))
+	}
 
-	dbName := strings.TrimSpace(c.settings.DefaultDatabase)
-	if dbName == "" {
-		dbName = "public"
+	parsed, err := decodeArrowResponse(raw, c.settings.RowLimit)
+	if err != nil {
+		return nil, backend.DownstreamError(fmt.Errorf("decode greptime arrow response: %w", err))
+	}
+	if ms, err := strconv.ParseInt(resp.Header.Get(headerExecutionTime), 10, 64); err == nil {
+		parsed.ExecutionTimeMs = ms
+	}
+	setResponseStats(parsed, resp, counter.n)
+	return parsed, nil
+}
+
+// setResponseStats records the body size and, unless the body carried them,
+// the metrics of the x-greptime-metrics header.
+func setResponseStats(parsed *Response, resp *http.Response, n int64) {
+	parsed.ResponseBytes = n
+	if parsed.Metrics == nil {
+		parsed.Metrics = parseMetricsHeader(resp.Header.Get(headerMetrics))
+	}
+}
+
+// cancelQuery looks up the server process running the statement tagged with
+// queryID and kills it. It runs in the background on a detached context
+// bounded by cancelTimeout; Close waits for it.
+func (c *Client) cancelQuery(ctx context.Context, ep *endpoint, queryID string, forwarded http.Header) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cancelTimeout)
+	defer cancel()
+
+	logger := log.DefaultLogger.With("queryId", queryID)
+	processIDs, err := c.findProcesses(ctx, ep, queryID, forwarded)
+	if err != nil {
+		logger.Warn("greptime query cancel: process lookup failed", "error", err)
+		return
+	}
+	if len(processIDs) == 0 {
+		logger.Debug("greptime query cancel: statement no longer running")
+		return
+	}
+	for _, processID := range processIDs {
+		kill := fmt.Sprintf("KILL '%s'", strings.ReplaceAll(processID, "'", "''"))
+		if _, err := c.executeSQL(ctx, ep, kill, forwarded); err != nil {
+			logger.Warn("greptime query cancel: kill failed", "processId", processID, "error", err)
+			continue
+		}
+		logger.Info("greptime query cancelled", "processId", processID)
+	}
+}
+
+// findProcesses returns the process_list ids of statements tagged with queryID.
+// The tag is split in the LIKE pattern so the lookup never matches itself.
+func (c *Client) findProcesses(ctx context.Context, ep *endpoint, queryID string, forwarded http.Header) ([]string, error) {
+	lookup := fmt.Sprintf("SELECT id FROM information_schema.process_list WHERE query LIKE concat('%%%s', '%s', '%%')",
+		queryTagPrefix, queryID)
+	response, err := c.executeSQL(ctx, ep, lookup, forwarded)
+	if err != nil {
+		return nil, err
+	}
+	frames, err := ResponseToFrames(response, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, frame := range frames {
+		if len(frame.Fields) == 0 {
+			continue
+		}
+		for row := 0; row < frame.Fields[0].Len(); row++ {
+			if id := stringAt(frame.Fields[0], row); id != "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// setHeaders applies the database, timezone and hints (see WithDatabase,
+// WithTimezone and WithHints), custom headers, forwarded Grafana headers and the AuthMode
+// credentials shared by every GreptimeDB HTTP request.
+func (c *Client) setHeaders(req *http.Request, forwarded http.Header) error {
+	req.Header.Set("x-greptime-db-name", queryDatabase(req.Context(), c.settings.DefaultDatabase))
+	if timezone := queryTimezone(req.Context()); timezone != "" {
+		req.Header.Set(timezoneHeader, timezone)
+	}
+	if hints := queryHints(req.Context(), c.settings.Hints); hints != "" {
+		req.Header.Set(hintsHeader, hints)
 	}
-	req.Header.Set("x-greptime-db-name", dbName)
 
 	for k, v := range c.settings.HttpHeaders {
 		if strings.TrimSpace(k) != "" {
@@ -89,53 +445,189 @@ func (c *Client) ExecuteSQL(ctx context.Context, sql string, forwarded http.Head
 		}
 	}
 
-	if c.settings.Username != "" {
-		req.SetBasicAuth(c.settings.Username, c.settings.Password)
+	auth, err := authorizationHeader(c.settings.AuthMode, c.settings.Username, c.settings.Password, c.settings.BearerToken, forwarded)
+	if err != nil {
+		return err
+	}
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
 	}
+	return nil
+}
 
-	resp, err := c.http.Do(req)
-	if err != nil {
-		return nil, backend.DownstreamError(err)
+// statusError converts a non-2xx answer into an Error, classified by the
+// GreptimeDB code of its {"code":...,"error":...} body or x-greptime-err-code
+// header, else by the HTTP status. Rejected credentials are flagged.
+func (c *Client) statusError(ctx context.Context, resp *http.Response, body []byte) error {
+	code := parseErrorCode(resp.Header.Get(errorCodeHeader))
+	msg := strings.TrimSpace(string(body))
+	var parsed struct {
+		Code  int    `json:"code"`
+		Error string `json:"error"`
 	}
-	defer resp.Body.Close()
+	if json.Unmarshal(body, &parsed) == nil && parsed.Error != "" {
+		msg = parsed.Error
+		if parsed.Code != 0 {
+			code = parsed.Code
+		}
+	}
+	if msg == "" {
+		msg = resp.Status
+	}
+
+	cause := &httpStatusError{StatusCode: resp.StatusCode, Message: msg}
+	var err error = newError(code, kindFromHTTPStatus(resp.StatusCode), msg, queryDatabase(ctx, c.settings.DefaultDatabase), cause)
+	if isAuthStatus(resp.StatusCode) {
+		err = authError(c.settings.AuthMode, err)
+	}
+	return backend.DownstreamError(err)
+}
+
+func (c *Client) responseFormat() string {
+	if strings.EqualFold(strings.TrimSpace(c.settings.ResponseFormat), ResponseFormatJSON) {
+		return ResponseFormatJSON
+	}
+	return ResponseFormatArrow
+}
 
-	body, err := io.ReadAll(resp.Body)
+// withQueryParam appends key=value to rawURL, keeping any existing query.
+func withQueryParam(rawURL, key, value string) string {
+	u, err := url.Parse(rawURL)
 	if err != nil {
-		return nil, err
+		return rawURL
 	}
+	q := u.Query()
+	q.Set(key, value)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		msg := strings.TrimSpace(string(body))
-		if msg == "" {
-			msg = resp.Status
+// QueryPromQL evaluates query through the Prometheus-compatible HTTP API,
+// using /query for instant queries and /query_range otherwise. Unavailable
+// endpoints are skipped in favour of the next one.
+func (c *Client) QueryPromQL(ctx context.Context, query PromQuery, forwarded http.Header) (*PromResponse, error) {
+	policy := c.settings.Retry.withDefaults()
+	var err error
+	for _, ep := range c.endpoints.candidates() {
+		if strings.TrimSpace(ep.promURL) == "" {
+			return nil, fmt.Errorf("prometheus endpoint is not configured")
+		}
+		start := time.Now()
+		var response *PromResponse
+		response, err = c.queryPromQL(ctx, ep, query, forwarded)
+		c.observe(ctx, ep, start, response != nil, err, policy)
+		if err == nil || ctx.Err() != nil || !ejectable(err, policy) {
+			return response, err
 		}
-		return nil, backend.DownstreamError(fmt.Errorf("greptime http %d: %s", resp.StatusCode, msg))
 	}
+	return nil, err
+}
 
-	var parsed Response
-	if err := json.Unmarshal(body, &parsed); err != nil {
-		return nil, backend.DownstreamError(fmt.Errorf("decode greptime response: %w", err))
+func (c *Client) queryPromQL(ctx context.Context, ep *endpoint, query PromQuery, forwarded http.Header) (*PromResponse, error) {
+	form := url.Values{}
+	form.Set("query", query.Expr)
+	form.Set("db", queryDatabase(ctx, c.settings.DefaultDatabase))
+	endpoint := "/query_range"
+	if query.Instant {
+		endpoint = "/query"
+		form.Set("time", promTimestamp(query.End))
+	} else {
+		form.Set("start", promTimestamp(query.Start))
+		form.Set("end", promTimestamp(query.End))
+		form.Set("step", strconv.FormatFloat(query.Step.Seconds(), 'f', -1, 64))
 	}
 
-	if parsed.Error != "" {
-		return &parsed, backend.DownstreamError(fmt.Errorf("%s", parsed.Error))
+	promURL := strings.TrimRight(ep.promURL, "/") + endpoint
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, promURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if err := c.setHeaders(req, forwarded); err != nil {
+		return nil, err
 	}
 
-	if parsed.Code != 0 {
-		if parsed.Error == "" {
-			parsed.Error = fmt.Sprintf("greptime error code %d", parsed.Code)
-		}
-		return &parsed, backend.DownstreamError(fmt.Errorf("%s", parsed.Error))
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, backend.DownstreamError(err)
+	}
+	defer resp.Body.Close()
+
+	var body io.Reader = resp.Body
+	if c.settings.MaxResponseBytes > 0 {
+		body = io.LimitReader(resp.Body, c.settings.MaxResponseBytes)
+	}
+	if isAuthStatus(resp.StatusCode) {
+		errBody, _ := io.ReadAll(io.LimitReader(body, maxErrorBodyBytes))
+		return nil, c.statusError(ctx, resp, errBody)
 	}
+	var parsed PromResponse
+	decodeErr := json.NewDecoder(body).Decode(&parsed)
 
+	// The Prometheus API reports failures as {"status":"error",...} with a 4xx/5xx status.
+	if parsed.Status == "error" || parsed.Error != "" {
+		msg := parsed.Error
+		if parsed.ErrorType != "" {
+			msg = parsed.ErrorType + ": " + msg
+		}
+		err := newError(0, kindFromHTTPStatus(resp.StatusCode), msg, queryDatabase(ctx, c.settings.DefaultDatabase), nil)
+		return &parsed, backend.DownstreamError(err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, c.statusError(ctx, resp, nil)
+	}
+	if decodeErr != nil {
+		return nil, backend.DownstreamError(fmt.Errorf("decode prometheus response: %w", decodeErr))
+	}
 	return &parsed, nil
 }
 
+// promTimestamp formats t as Prometheus API seconds with millisecond precision.
+func promTimestamp(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixMilli())/1000, 'f', -1, 64)
+}
+
+// tagQuery prefixes sql with a comment carrying queryID, visible in process_list.
+func tagQuery(sql, queryID string) string {
+	return fmt.Sprintf("/* %s%s */ %s", queryTagPrefix, queryID, sql)
+}
+
+func newQueryID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
 func (c *Client) Ping(ctx context.Context, forwarded http.Header) error {
 	_, err := c.ExecuteSQL(ctx, "SELECT 1", forwarded)
 	return err
 }
 
+// CheckEndpoints runs SELECT 1 against every endpoint, updating their health,
+// and returns the status of each.
+func (c *Client) CheckEndpoints(ctx context.Context, forwarded http.Header) []EndpointStatus {
+	var wg sync.WaitGroup
+	for _, ep := range c.endpoints.endpoints {
+		wg.Add(1)
+		go func(ep *endpoint) {
+			defer wg.Done()
+			start := time.Now()
+			if _, err := c.executeSQL(ctx, ep, "SELECT 1", forwarded); err != nil {
+				c.endpoints.markFailure(ep, err)
+				return
+			}
+			c.endpoints.markSuccess(ep, time.Since(start))
+		}(ep)
+	}
+	wg.Wait()
+	return c.endpoints.status()
+}
+
 func LogExecutedSQL(refID, sql string) {
 	log.DefaultLogger.Info("greptime executed sql", "refId", refID, "sql", sql)
 }
+
+func LogExecutedPromQL(refID, expr string) {
+	log.DefaultLogger.Info("greptime executed promql", "refId", refID, "expr", expr)
+}
@@ -0,0 +1,239 @@
+package greptime
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// cancelServer fakes GreptimeDB for the cancel path: statements tagged with a
+// query id block until the client goes away, process_list lookups return the
+// blocked statement, and KILL statements are recorded.
+type cancelServer struct {
+	mu      sync.Mutex
+	running map[string]string // process id -> query id
+	killed  []string
+	lookups []string
+	started chan struct{}
+	release chan struct{} // when set, process_list lookups wait for it
+}
+
+var queryTagRe = regexp.MustCompile(`^/\* grafana_query_id=([0-9a-f]{32}) \*/ `)
+
+func (s *cancelServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	sql := r.PostForm.Get("sql")
+	body := strings.TrimSpace(queryTagRe.ReplaceAllString(sql, ""))
+
+	switch {
+	case strings.HasPrefix(body, "SELECT id FROM information_schema.process_list"):
+		if s.release != nil {
+			<-s.release
+		}
+		s.mu.Lock()
+		s.lookups = append(s.lookups, body)
+		var rows []string
+		for pid, qid := range s.running {
+			if strings.Contains(body, "'"+qid+"'") {
+				rows = append(rows, `["`+pid+`"]`)
+			}
+		}
+		s.mu.Unlock()
+		_, _ = w.Write([]byte(`{"code":0,"output":[{"records":{"schema":{"column_schemas":[{"name":"id","data_type":"String"}]},"rows":[` +
+			strings.Join(rows, ",") + `]}}]}`))
+	case strings.HasPrefix(body, "KILL "):
+		s.mu.Lock()
+		s.killed = append(s.killed, body)
+		s.mu.Unlock()
+		_, _ = w.Write([]byte(`{"code":0,"output":[{"affectedrows":1}]}`))
+	default:
+		m := queryTagRe.FindStringSubmatch(sql)
+		if m == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		s.running["127.0.0.1:4001/7"] = m[1]
+		s.mu.Unlock()
+		close(s.started)
+		<-r.Context().Done()
+	}
+}
+
+func TestClient_ExecuteSQL_CancelKillsServerQuery(t *testing.T) {
+	fake := &cancelServer{running: map[string]string{}, started: make(chan struct{})}
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	client := NewClient(ClientSettings{SQLURL: ts.URL + "/v1/sql"})
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-fake.started
+		cancel()
+	}()
+
+	_, err := client.ExecuteSQL(ctx, "SELECT * FROM huge_table", nil)
+	require.ErrorIs(t, err, context.Canceled)
+	client.Close() // waits for the kill
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	require.Len(t, fake.lookups, 1)
+	require.NotContains(t, fake.lookups[0], queryTagPrefix+fake.running["127.0.0.1:4001/7"],
+		"the lookup must not match its own process_list entry")
+	require.Equal(t, []string{"KILL '127.0.0.1:4001/7'"}, fake.killed)
+}
+
+func TestClient_ExecuteSQL_TimeoutKillsServerQuery(t *testing.T) {
+	fake := &cancelServer{running: map[string]string{}, started: make(chan struct{})}
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	client := NewClient(ClientSettings{SQLURL: ts.URL, QueryTimeout: 100 * time.Millisecond})
+	defer client.Close()
+
+	_, err := client.ExecuteSQL(context.Background(), "SELECT * FROM huge_table", nil)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	client.Close()
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	require.Equal(t, []string{"KILL '127.0.0.1:4001/7'"}, fake.killed)
+}
+
+func TestClient_ExecuteSQL_CancelDoesNotBlockCaller(t *testing.T) {
+	fake := &cancelServer{running: map[string]string{}, started: make(chan struct{}), release: make(chan struct{})}
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	client := NewClient(ClientSettings{SQLURL: ts.URL})
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-fake.started
+		cancel()
+	}()
+
+	// The kill is still waiting on the lookup when ExecuteSQL returns.
+	_, err := client.ExecuteSQL(ctx, "SELECT * FROM huge_table", nil)
+	require.ErrorIs(t, err, context.Canceled)
+	fake.mu.Lock()
+	require.Empty(t, fake.killed)
+	fake.mu.Unlock()
+
+	close(fake.release)
+	client.Close()
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	require.Equal(t, []string{"KILL '127.0.0.1:4001/7'"}, fake.killed)
+}
+
+func TestClient_ExecuteSQL_NoCancelAfterClose(t *testing.T) {
+	fake := &cancelServer{running: map[string]string{}, started: make(chan struct{})}
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	client := NewClient(ClientSettings{SQLURL: ts.URL})
+
+	// The instance is disposed while the query still runs.
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-fake.started
+		client.Close()
+		cancel()
+	}()
+
+	_, err := client.ExecuteSQL(ctx, "SELECT * FROM huge_table", nil)
+	require.ErrorIs(t, err, context.Canceled)
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	require.Empty(t, fake.lookups, "no kill starts once the client is closed")
+}
+
+func TestClient_ExecuteSQL_NoCancelOnSuccess(t *testing.T) {
+	var mu sync.Mutex
+	var statements []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		mu.Lock()
+		statements = append(statements, r.PostForm.Get("sql"))
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"code":1004,"error":"Table not found"}`))
+	}))
+	defer ts.Close()
+
+	client := NewClient(ClientSettings{SQLURL: ts.URL, QueryTimeout: time.Second})
+	defer client.Close()
+
+	_, err := client.ExecuteSQL(context.Background(), "SELECT * FROM missing", nil)
+	require.ErrorContains(t, err, "Table not found")
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, statements, 1, "server errors must not trigger a cancel")
+	require.Regexp(t, queryTagRe, statements[0])
+	require.True(t, strings.HasSuffix(statements[0], "SELECT * FROM missing"))
+}
+
+func TestClient_WithDatabase(t *testing.T) {
+	var databases []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/prometheus/api/v1/query" {
+			_ = r.ParseForm()
+			databases = append(databases, "prom:"+r.PostForm.Get("db"))
+			_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+			return
+		}
+		databases = append(databases, r.Header.Get("x-greptime-db-name"))
+		_, _ = w.Write([]byte(`{"code":0,"output":[]}`))
+	}))
+	defer ts.Close()
+
+	client := NewClient(ClientSettings{
+		SQLURL:         ts.URL + "/v1/sql",
+		PrometheusURL:  ts.URL + "/v1/prometheus/api/v1",
+		ResponseFormat: ResponseFormatJSON,
+	})
+	defer client.Close()
+
+	ctx := context.Background()
+	_, err := client.ExecuteSQL(ctx, "SELECT 1", nil)
+	require.NoError(t, err)
+	_, err = client.ExecuteSQL(WithDatabase(ctx, "logs"), "SELECT 1", nil)
+	require.NoError(t, err)
+	_, err = client.ExecuteSQL(WithDatabase(ctx, " "), "SELECT 1", nil)
+	require.NoError(t, err)
+	_, err = client.QueryPromQL(WithDatabase(ctx, "metrics"), PromQuery{Expr: "up", Instant: true, End: time.Now()}, nil)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"public", "logs", "public", "prom:metrics"}, databases)
+}
+
+func TestClient_WithTimezone(t *testing.T) {
+	var timezones []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timezones = append(timezones, r.Header.Get("x-greptime-timezone"))
+		_, _ = w.Write([]byte(`{"code":0,"output":[]}`))
+	}))
+	defer ts.Close()
+
+	client := NewClient(ClientSettings{SQLURL: ts.URL + "/v1/sql", ResponseFormat: ResponseFormatJSON})
+	defer client.Close()
+
+	_, err := client.ExecuteSQL(WithTimezone(context.Background(), "Asia/Shanghai"), "SELECT 1", nil)
+	require.NoError(t, err)
+	_, err = client.ExecuteSQL(context.Background(), "SELECT 1", nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"Asia/Shanghai", ""}, timezones)
+}
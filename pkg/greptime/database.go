@@ -0,0 +1,33 @@
+package greptime
+
+import (
+	"context"
+	"strings"
+)
+
+// DefaultDatabaseName is used when neither the query nor the settings name a database.
+const DefaultDatabaseName = "public"
+
+type databaseKey struct{}
+
+// WithDatabase returns a context whose queries run in database instead of
+// the client's DefaultDatabase. An empty database keeps the default.
+func WithDatabase(ctx context.Context, database string) context.Context {
+	database = strings.TrimSpace(database)
+	if database == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, databaseKey{}, database)
+}
+
+// queryDatabase returns the database of queries under ctx: the WithDatabase
+// override, otherwise defaultDatabase, otherwise DefaultDatabaseName.
+func queryDatabase(ctx context.Context, defaultDatabase string) string {
+	if database, ok := ctx.Value(databaseKey{}).(string); ok {
+		return database
+	}
+	if database := strings.TrimSpace(defaultDatabase); database != "" {
+		return database
+	}
+	return DefaultDatabaseName
+}
@@ -0,0 +1,287 @@
+package greptime
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// decodeLimits bounds how much of a /v1/sql response is materialised.
+type decodeLimits struct {
+	// RowLimit caps the rows kept per result set; remaining rows are skipped and counted.
+	RowLimit int64
+	// MaxBytes caps the bytes read from the response body; decoding stops once reached.
+	MaxBytes int64
+}
+
+// errByteBudget is returned by budgetReader once MaxBytes have been consumed.
+var errByteBudget = errors.New("greptime response byte budget exhausted")
+
+type budgetReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (b *budgetReader) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, errByteBudget
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.r.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+// decodeJSONResponse decodes a /v1/sql JSON body token by token. Each row is
+// written straight into column builders, so the body and the [][]any rows are
+// never held in memory at once. Outputs carry ready-made frames equal to what
+// ResponseToFrames builds from Records.
+//
+// When limits.MaxBytes is reached before the outputs end, the outputs decoded
+// so far are returned with ByteLimitReached set on the last one instead of an
+// error; an empty output carries it when the limit cut off the first one.
+func decodeJSONResponse(r io.Reader, limits decodeLimits) (*Response, error) {
+	if limits.MaxBytes > 0 {
+		r = &budgetReader{r: r, remaining: limits.MaxBytes}
+	}
+	d := &jsonResponseDecoder{dec: json.NewDecoder(r), limits: limits}
+
+	err := d.decodeResponse()
+	if errors.Is(err, errByteBudget) {
+		d.finishTruncated()
+		return &d.response, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d.response, nil
+}
+
+type jsonResponseDecoder struct {
+	dec      *json.Decoder
+	limits   decodeLimits
+	response Response
+
+	outputsDone bool // the output array was read to its end
+
+	// State of the output currently being decoded.
+	inOutput    bool
+	schema      []ColumnSchema
+	builder     *frameBuilder
+	pendingRows [][]any // rows seen before the schema
+	kept        int64
+	dropped     int64
+	affected    *int64
+}
+
+func (d *jsonResponseDecoder) decodeResponse() error {
+	return d.decodeObject(func(key string) error {
+		switch key {
+		case "code":
+			return d.dec.Decode(&d.response.Code)
+		case "execution_time_ms":
+			return d.dec.Decode(&d.response.ExecutionTimeMs)
+		case "error":
+			return d.dec.Decode(&d.response.Error)
+		case "resp_metrics":
+			var metrics map[string]any
+			if err := d.dec.Decode(&metrics); err != nil {
+				return err
+			}
+			d.response.Metrics = numericMetrics(metrics)
+			return nil
+		case "output":
+			if err := d.decodeArray(d.decodeOutput); err != nil {
+				return err
+			}
+			d.outputsDone = true
+			return nil
+		default:
+			return d.skipValue()
+		}
+	})
+}
+
+func (d *jsonResponseDecoder) decodeOutput() error {
+	d.inOutput = true
+	d.schema, d.builder, d.pendingRows, d.kept, d.dropped, d.affected = nil, nil, nil, 0, 0, nil
+
+	err := d.decodeObject(func(key string) error {
+		switch key {
+		case "records":
+		case "affectedrows":
+			return d.dec.Decode(&d.affected)
+		default:
+			return d.skipValue()
+		}
+		return d.decodeObject(func(key string) error {
+			switch key {
+			case "schema":
+				var schema Schema
+				if err := d.dec.Decode(&schema); err != nil {
+					return err
+				}
+				d.setSchema(schema.ColumnSchemas)
+				return nil
+			case "rows":
+				return d.decodeArray(d.decodeRow)
+			default:
+				return d.skipValue()
+			}
+		})
+	})
+	if err != nil {
+		return err
+	}
+	d.finishOutput(false)
+	return nil
+}
+
+func (d *jsonResponseDecoder) setSchema(columnSchemas []ColumnSchema) {
+	d.schema = columnSchemas
+	d.builder = newFrameBuilder(columnSchemas, len(d.pendingRows))
+	for _, row := range d.pendingRows {
+		d.builder.appendRow(row)
+	}
+	d.pendingRows = nil
+}
+
+func (d *jsonResponseDecoder) decodeRow() error {
+	if d.limits.RowLimit > 0 && d.kept >= d.limits.RowLimit {
+		d.dropped++
+		return d.skipValue()
+	}
+
+	var row []any
+	if err := d.dec.Decode(&row); err != nil {
+		return err
+	}
+	d.kept++
+	if d.builder == nil {
+		d.pendingRows = append(d.pendingRows, row)
+		return nil
+	}
+	d.builder.appendRow(row)
+	return nil
+}
+
+// finishOutput appends the output being decoded, if any, to the response.
+func (d *jsonResponseDecoder) finishOutput(byteLimitReached bool) {
+	if !d.inOutput {
+		return
+	}
+	d.inOutput = false
+	if d.affected != nil && d.schema == nil && d.builder == nil && len(d.pendingRows) == 0 {
+		d.response.Output = append(d.response.Output, Output{
+			AffectedRows:     d.affected,
+			Frame:            affectedRowsFrame(*d.affected),
+			ByteLimitReached: byteLimitReached,
+		})
+		return
+	}
+	if d.builder == nil {
+		d.setSchema(d.schema)
+	}
+	d.response.Output = append(d.response.Output, Output{
+		Frame:            d.builder.frame(),
+		DroppedRows:      d.dropped,
+		ByteLimitReached: byteLimitReached,
+	})
+}
+
+// finishTruncated records that the byte budget ran out. Outputs the budget
+// cut off mark the output decoded last, or an empty one when none was.
+func (d *jsonResponseDecoder) finishTruncated() {
+	// The decoder reports More before reading the next element, so an output
+	// may have been entered without any of it being read.
+	if d.inOutput && (d.schema != nil || d.builder != nil || len(d.pendingRows) > 0 || d.dropped > 0 || d.affected != nil) {
+		d.finishOutput(true)
+		return
+	}
+	d.inOutput = false
+	if d.outputsDone {
+		// Only fields after the outputs, such as metrics, were lost.
+		return
+	}
+	if n := len(d.response.Output); n > 0 {
+		d.response.Output[n-1].ByteLimitReached = true
+		return
+	}
+	d.response.Output = append(d.response.Output, Output{Frame: data.NewFrame(""), ByteLimitReached: true})
+}
+
+// decodeObject walks a JSON object (or null), calling field for each key with
+// the decoder positioned at its value.
+func (d *jsonResponseDecoder) decodeObject(field func(key string) error) error {
+	tok, err := d.dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		return nil
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return fmt.Errorf("decode greptime response: expected object, got %v", tok)
+	}
+	for d.dec.More() {
+		tok, err := d.dec.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := tok.(string)
+		if err := field(key); err != nil {
+			return err
+		}
+	}
+	_, err = d.dec.Token()
+	return err
+}
+
+// decodeArray walks a JSON array (or null), calling elem with the decoder
+// positioned at each element.
+func (d *jsonResponseDecoder) decodeArray(elem func() error) error {
+	tok, err := d.dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		return nil
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("decode greptime response: expected array, got %v", tok)
+	}
+	for d.dec.More() {
+		if err := elem(); err != nil {
+			return err
+		}
+	}
+	_, err = d.dec.Token()
+	return err
+}
+
+// skipValue consumes the next value without materialising it.
+func (d *jsonResponseDecoder) skipValue() error {
+	depth := 0
+	for {
+		tok, err := d.dec.Token()
+		if err != nil {
+			return err
+		}
+		if delim, ok := tok.(json.Delim); ok {
+			switch delim {
+			case '{', '[':
+				depth++
+			default:
+				depth--
+			}
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package greptime
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeJSONResponse_MatchesUnmarshal(t *testing.T) {
+	bodies := map[string]string{
+		"metrics": string(metricJSON(20)),
+		"mixed types": `{
+			"code": 0,
+			"output": [{
+				"records": {
+					"schema": {"column_schemas": [
+						{"name": "ts", "data_type": "TimestampSecond"},
+						{"name": "ok", "data_type": "Boolean"},
+						{"name": "tags", "data_type": "Json"},
+						{"name": "", "data_type": "Float64"}
+					]},
+					"rows": [
+						[1700000000, true, {"a": [1, 2]}, 1.5],
+						[null, null, null, null],
+						[1700000001, false]
+					]
+				}
+			}, {
+				"records": {"schema": {"column_schemas": []}, "rows": []}
+			}],
+			"execution_time_ms": 7
+		}`,
+		"rows before schema": `{"output":[{"records":{"rows":[[1,"a"],[2,"b"]],"schema":{"column_schemas":[
+			{"name":"id","data_type":"Int64"},{"name":"name","data_type":"String"}]}}}]}`,
+		"error": `{"code": 1004, "error": "Table not found: missing"}`,
+	}
+
+	for name, body := range bodies {
+		t.Run(name, func(t *testing.T) {
+			var want Response
+			require.NoError(t, json.Unmarshal([]byte(body), &want))
+			wantFrames, err := ResponseToFrames(&want, "A")
+			require.NoError(t, err)
+
+			got, err := decodeJSONResponse(strings.NewReader(body), decodeLimits{})
+			require.NoError(t, err)
+			require.Equal(t, want.Code, got.Code)
+			require.Equal(t, want.Error, got.Error)
+			require.Equal(t, want.ExecutionTimeMs, got.ExecutionTimeMs)
+			gotFrames, err := ResponseToFrames(got, "A")
+			require.NoError(t, err)
+
+			require.Len(t, gotFrames, len(wantFrames))
+			for i := range wantFrames {
+				wantJSON, err := json.Marshal(wantFrames[i])
+				require.NoError(t, err)
+				gotJSON, err := json.Marshal(gotFrames[i])
+				require.NoError(t, err)
+				require.JSONEq(t, string(wantJSON), string(gotJSON))
+			}
+		})
+	}
+}
+
+func TestDecodeJSONResponse_RowLimit(t *testing.T) {
+	response, err := decodeJSONResponse(bytes.NewReader(metricJSON(10)), decodeLimits{RowLimit: 4})
+	require.NoError(t, err)
+	require.Len(t, response.Output, 1)
+	require.Equal(t, int64(6), response.Output[0].DroppedRows)
+	require.Equal(t, 4, response.Output[0].Frame.Rows())
+}
+
+func TestDecodeJSONResponse_ByteLimit(t *testing.T) {
+	body := metricJSON(1000)
+	response, err := decodeJSONResponse(bytes.NewReader(body), decodeLimits{MaxBytes: int64(len(body) / 2)})
+	require.NoError(t, err)
+	require.Len(t, response.Output, 1)
+
+	output := response.Output[0]
+	require.True(t, output.ByteLimitReached)
+	require.Greater(t, output.Frame.Rows(), 0)
+	require.Less(t, output.Frame.Rows(), 1000)
+
+	frames, err := ResponseToFrames(response, "A")
+	require.NoError(t, err)
+	require.Len(t, frames[0].Meta.Notices, 1)
+	require.Contains(t, frames[0].Meta.Notices[0].Text, "exceeded the size limit")
+}
+
+func TestDecodeJSONResponse_ByteLimitBetweenOutputs(t *testing.T) {
+	first := `{"records":{"schema":{"column_schemas":[{"name":"v","data_type":"Int64"}]},"rows":[[1],[2]]}}`
+	body := `{"code":0,"output":[` + first + `,{"affectedrows":3}],"execution_time_ms":7}`
+
+	// The budget runs out right after the first output.
+	cut := strings.Index(body, first) + len(first)
+	response, err := decodeJSONResponse(strings.NewReader(body), decodeLimits{MaxBytes: int64(cut)})
+	require.NoError(t, err)
+	require.Len(t, response.Output, 1)
+	require.True(t, response.Output[0].ByteLimitReached)
+	require.Equal(t, 2, response.Output[0].Frame.Rows())
+
+	// It runs out before the first output.
+	response, err = decodeJSONResponse(strings.NewReader(body), decodeLimits{MaxBytes: int64(strings.Index(body, first))})
+	require.NoError(t, err)
+	require.Len(t, response.Output, 1)
+	require.True(t, response.Output[0].ByteLimitReached)
+	frames, err := ResponseToFrames(response, "A")
+	require.NoError(t, err)
+	require.Len(t, frames, 1)
+	require.Contains(t, frames[0].Meta.Notices[0].Text, "exceeded the size limit")
+
+	// It runs out after the outputs, losing nothing of them.
+	response, err = decodeJSONResponse(strings.NewReader(body), decodeLimits{MaxBytes: int64(strings.Index(body, `"execution_time_ms"`))})
+	require.NoError(t, err)
+	require.Len(t, response.Output, 2)
+	require.False(t, response.Output[0].ByteLimitReached)
+	require.False(t, response.Output[1].ByteLimitReached)
+}
+
+func TestDecodeJSONResponse_Malformed(t *testing.T) {
+	_, err := decodeJSONResponse(strings.NewReader(`{"output": [{"records": {"rows": [[1,`), decodeLimits{})
+	require.Error(t, err)
+
+	_, err = decodeJSONResponse(strings.NewReader(`[]`), decodeLimits{})
+	require.Error(t, err)
+}
+
+func TestClient_ExecuteSQL_MaxResponseBytes(t *testing.T) {
+	arrowBody := writeMetricArrow(t, 100, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("format") == ResponseFormatArrow {
+			w.Header().Set("Content-Type", "application/arrow")
+			_, _ = w.Write(arrowBody)
+			return
+		}
+		_, _ = w.Write(metricJSON(100))
+	}))
+	defer ts.Close()
+
+	t.Run("json is truncated", func(t *testing.T) {
+		client := NewClient(ClientSettings{SQLURL: ts.URL, ResponseFormat: ResponseFormatJSON, MaxResponseBytes: 1024})
+		defer client.Close()
+
+		response, err := client.ExecuteSQL(context.Background(), "SELECT * FROM metrics", nil)
+		require.NoError(t, err)
+		require.True(t, response.Output[0].ByteLimitReached)
+		require.Less(t, response.Output[0].Frame.Rows(), 100)
+	})
+
+	t.Run("arrow fails", func(t *testing.T) {
+		client := NewClient(ClientSettings{SQLURL: ts.URL, MaxResponseBytes: 1024})
+		defer client.Close()
+
+		_, err := client.ExecuteSQL(context.Background(), "SELECT * FROM metrics", nil)
+		require.ErrorContains(t, err, "exceeds the 1024 byte limit")
+	})
+}
+
+func BenchmarkDecodeJSONResponse(b *testing.B) {
+	body := metricJSON(benchmarkRows)
+	b.SetBytes(int64(len(body)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		response, err := decodeJSONResponse(bytes.NewReader(body), decodeLimits{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := ResponseToFrames(response, "A"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package greptime
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Endpoint selection strategies for ClientSettings.EndpointSelection.
+const (
+	EndpointSelectionRoundRobin   = "round-robin"
+	EndpointSelectionLeastLatency = "least-latency"
+)
+
+// endpointRecheckInterval is how often ejected endpoints are probed via /health.
+const endpointRecheckInterval = 10 * time.Second
+
+// latencyWeight is the weight of the newest sample in the latency moving average.
+const latencyWeight = 0.3
+
+// endpoint is one GreptimeDB frontend.
+type endpoint struct {
+	baseURL string
+	sqlURL  string
+	promURL string
+
+	mu        sync.Mutex
+	healthy   bool
+	latency   time.Duration // moving average of successful requests; 0 until measured
+	lastErr   error
+	ejectedAt time.Time
+}
+
+// EndpointStatus describes a frontend as seen by the client.
+type EndpointStatus struct {
+	URL     string        `json:"url"`
+	Healthy bool          `json:"healthy"`
+	Latency time.Duration `json:"latency"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// endpointPool selects frontends and tracks their health. Endpoints are ejected
+// passively when requests to them fail and come back once /health succeeds.
+type endpointPool struct {
+	endpoints []*endpoint
+	selection string
+	next      atomic.Uint64
+}
+
+// newEndpointPool builds the pool from base URLs, or from the single SQL and
+// Prometheus URLs when no endpoint list is configured.
+func newEndpointPool(settings ClientSettings) *endpointPool {
+	pool := &endpointPool{selection: settings.EndpointSelection}
+	for _, base := range settings.Endpoints {
+		base = strings.TrimRight(strings.TrimSpace(base), "/")
+		if base == "" {
+			continue
+		}
+		pool.endpoints = append(pool.endpoints, &endpoint{
+			baseURL: base,
+			sqlURL:  base + "/v1/sql",
+			promURL: base + "/v1/prometheus/api/v1",
+			healthy: true,
+		})
+	}
+	if len(pool.endpoints) == 0 {
+		pool.endpoints = []*endpoint{{
+			baseURL: baseURLOf(settings.SQLURL, "/v1/sql"),
+			sqlURL:  settings.SQLURL,
+			promURL: settings.PrometheusURL,
+			healthy: true,
+		}}
+	}
+	return pool
+}
+
+// baseURLOf strips suffix and any query from rawURL.
+func baseURLOf(rawURL, suffix string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	u.RawQuery = ""
+	u.Path = strings.TrimSuffix(strings.TrimRight(u.Path, "/"), suffix)
+	return strings.TrimRight(u.String(), "/")
+}
+
+// candidates returns endpoints in the order they should be tried: healthy ones
+// by the selection strategy, then ejected ones as a last resort.
+func (p *endpointPool) candidates() []*endpoint {
+	if len(p.endpoints) == 1 {
+		return p.endpoints
+	}
+
+	type snapshot struct {
+		ep      *endpoint
+		healthy bool
+		latency time.Duration
+	}
+	start := int(p.next.Add(1)-1) % len(p.endpoints)
+	snaps := make([]snapshot, 0, len(p.endpoints))
+	for i := range p.endpoints {
+		ep := p.endpoints[(start+i)%len(p.endpoints)]
+		ep.mu.Lock()
+		snaps = append(snaps, snapshot{ep: ep, healthy: ep.healthy, latency: ep.latency})
+		ep.mu.Unlock()
+	}
+
+	slices.SortStableFunc(snaps, func(a, b snapshot) int {
+		if a.healthy != b.healthy {
+			if a.healthy {
+				return -1
+			}
+			return 1
+		}
+		if p.selection == EndpointSelectionLeastLatency {
+			return cmp.Compare(a.latency, b.latency)
+		}
+		return 0
+	})
+
+	out := make([]*endpoint, len(snaps))
+	for i, s := range snaps {
+		out[i] = s.ep
+	}
+	return out
+}
+
+func (p *endpointPool) markSuccess(ep *endpoint, latency time.Duration) {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	ep.healthy = true
+	ep.lastErr = nil
+	if ep.latency == 0 {
+		ep.latency = latency
+	} else {
+		ep.latency = time.Duration(latencyWeight*float64(latency) + (1-latencyWeight)*float64(ep.latency))
+	}
+}
+
+func (p *endpointPool) markFailure(ep *endpoint, err error) {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	if ep.healthy {
+		ep.ejectedAt = time.Now()
+	}
+	ep.healthy = false
+	ep.lastErr = err
+}
+
+func (p *endpointPool) status() []EndpointStatus {
+	out := make([]EndpointStatus, 0, len(p.endpoints))
+	for _, ep := range p.endpoints {
+		ep.mu.Lock()
+		st := EndpointStatus{URL: ep.baseURL, Healthy: ep.healthy, Latency: ep.latency}
+		if ep.lastErr != nil {
+			st.Error = ep.lastErr.Error()
+		}
+		ep.mu.Unlock()
+		out = append(out, st)
+	}
+	return out
+}
+
+// ejectable reports whether err says the endpoint itself is unavailable, as
+// opposed to the statement failing.
+func ejectable(err error, policy RetryPolicy) bool {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return slices.Contains(policy.RetryableStatusCodes, statusErr.StatusCode)
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// isDialError reports whether err happened before the request was sent, so
+// any statement can safely be sent to another endpoint.
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// recheckEndpoints probes ejected endpoints until the client is closed.
+func (c *Client) recheckEndpoints() {
+	ticker := time.NewTicker(endpointRecheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.probeEjected()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *Client) probeEjected() {
+	for _, ep := range c.endpoints.endpoints {
+		ep.mu.Lock()
+		healthy := ep.healthy
+		ep.mu.Unlock()
+		if healthy {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), endpointRecheckInterval)
+		start := time.Now()
+		err := c.probe(ctx, ep)
+		cancel()
+		if err == nil {
+			c.endpoints.markSuccess(ep, time.Since(start))
+		} else {
+			c.endpoints.markFailure(ep, err)
+		}
+	}
+}
+
+// probe checks GreptimeDB's /health endpoint.
+func (c *Client) probe(ctx context.Context, ep *endpoint) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ep.baseURL+"/health", nil)
+	if err != nil {
+		return err
+	}
+	// /health needs no credentials, so a missing OAuth token is not a failure.
+	_ = c.setHeaders(req, nil)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &httpStatusError{StatusCode: resp.StatusCode, Message: resp.Status}
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package greptime
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// frontend fakes a GreptimeDB frontend that answers /v1/sql and /health and
+// counts SQL requests.
+type frontend struct {
+	*httptest.Server
+	queries atomic.Int32
+	status  atomic.Int32 // HTTP status for /v1/sql and /health; 0 means 200
+}
+
+func newFrontend(t *testing.T) *frontend {
+	f := &frontend{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status := f.status.Load(); status != 0 {
+			w.WriteHeader(int(status))
+			return
+		}
+		if r.URL.Path == "/health" {
+			_, _ = w.Write([]byte("{}"))
+			return
+		}
+		f.queries.Add(1)
+		_, _ = w.Write([]byte(`{"code":0,"output":[{"records":{"schema":{"column_schemas":[{"name":"v","data_type":"Int64"}]},"rows":[[1]]}}]}`))
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// deadURL returns a URL nothing listens on.
+func deadURL(t *testing.T) string {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	ts.Close()
+	return ts.URL
+}
+
+func TestNewEndpointPool(t *testing.T) {
+	single := newEndpointPool(ClientSettings{SQLURL: "http://db:4000/v1/sql?format=arrow", PrometheusURL: "http://db:4000/v1/prometheus/api/v1"})
+	require.Len(t, single.endpoints, 1)
+	require.Equal(t, "http://db:4000", single.endpoints[0].baseURL)
+	require.Equal(t, "http://db:4000/v1/sql?format=arrow", single.endpoints[0].sqlURL)
+
+	multi := newEndpointPool(ClientSettings{SQLURL: "http://ignored/v1/sql", Endpoints: []string{"http://a:4000/", " ", "http://b:4000"}})
+	require.Len(t, multi.endpoints, 2)
+	require.Equal(t, "http://a:4000/v1/sql", multi.endpoints[0].sqlURL)
+	require.Equal(t, "http://b:4000/v1/prometheus/api/v1", multi.endpoints[1].promURL)
+}
+
+func TestEndpointPool_Candidates(t *testing.T) {
+	t.Run("round robin", func(t *testing.T) {
+		pool := newEndpointPool(ClientSettings{Endpoints: []string{"http://a", "http://b", "http://c"}})
+		var firsts []string
+		for i := 0; i < 4; i++ {
+			firsts = append(firsts, pool.candidates()[0].baseURL)
+		}
+		require.Equal(t, []string{"http://a", "http://b", "http://c", "http://a"}, firsts)
+	})
+
+	t.Run("ejected endpoints go last", func(t *testing.T) {
+		pool := newEndpointPool(ClientSettings{Endpoints: []string{"http://a", "http://b", "http://c"}})
+		pool.markFailure(pool.endpoints[0], errors.New("connection refused"))
+		for i := 0; i < 3; i++ {
+			candidates := pool.candidates()
+			require.Len(t, candidates, 3)
+			require.Equal(t, "http://a", candidates[2].baseURL)
+		}
+	})
+
+	t.Run("least latency", func(t *testing.T) {
+		pool := newEndpointPool(ClientSettings{
+			Endpoints:         []string{"http://a", "http://b", "http://c"},
+			EndpointSelection: EndpointSelectionLeastLatency,
+		})
+		pool.markSuccess(pool.endpoints[0], 30*time.Millisecond)
+		pool.markSuccess(pool.endpoints[1], 5*time.Millisecond)
+		pool.markSuccess(pool.endpoints[2], 20*time.Millisecond)
+		for i := 0; i < 3; i++ {
+			require.Equal(t, "http://b", pool.candidates()[0].baseURL)
+		}
+
+		// The moving average follows a slowing endpoint.
+		for i := 0; i < 10; i++ {
+			pool.markSuccess(pool.endpoints[1], 100*time.Millisecond)
+		}
+		require.Equal(t, "http://c", pool.candidates()[0].baseURL)
+	})
+}
+
+func TestClient_ExecuteSQL_Failover(t *testing.T) {
+	t.Run("dead endpoint is skipped and ejected", func(t *testing.T) {
+		live := newFrontend(t)
+		client := NewClient(ClientSettings{Endpoints: []string{deadURL(t), live.URL}, Retry: fastRetry})
+		defer client.Close()
+
+		// Even writes fail over when the connection was never established.
+		for i := 0; i < 3; i++ {
+			_, err := client.ExecuteSQL(context.Background(), "INSERT INTO t VALUES (1)", nil)
+			require.NoError(t, err)
+		}
+		require.Equal(t, int32(3), live.queries.Load())
+
+		status := client.endpoints.status()
+		require.False(t, status[0].Healthy)
+		require.True(t, status[1].Healthy)
+	})
+
+	t.Run("gateway errors move reads to the next endpoint", func(t *testing.T) {
+		flaky, live := newFrontend(t), newFrontend(t)
+		flaky.status.Store(http.StatusServiceUnavailable)
+		client := NewClient(ClientSettings{Endpoints: []string{flaky.URL, live.URL}, Retry: fastRetry})
+		defer client.Close()
+
+		response, err := client.ExecuteSQL(context.Background(), "SELECT v FROM t", nil)
+		require.NoError(t, err)
+		require.Equal(t, int32(1), live.queries.Load())
+		require.Len(t, response.Retries, 1)
+		require.False(t, client.endpoints.status()[0].Healthy)
+	})
+
+	t.Run("statement errors do not eject", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"code":1004,"error":"Table not found"}`))
+		}))
+		defer ts.Close()
+		client := NewClient(ClientSettings{Endpoints: []string{ts.URL, deadURL(t)}})
+		defer client.Close()
+
+		_, err := client.ExecuteSQL(context.Background(), "SELECT * FROM missing", nil)
+		require.ErrorContains(t, err, "Table not found")
+		require.True(t, client.endpoints.status()[0].Healthy)
+	})
+}
+
+func TestClient_ProbeEjected(t *testing.T) {
+	a, b := newFrontend(t), newFrontend(t)
+	client := NewClient(ClientSettings{Endpoints: []string{a.URL, b.URL}})
+	defer client.Close()
+
+	client.endpoints.markFailure(client.endpoints.endpoints[0], errors.New("connection reset"))
+	a.status.Store(http.StatusServiceUnavailable)
+	client.probeEjected()
+	require.False(t, client.endpoints.status()[0].Healthy)
+
+	a.status.Store(0)
+	client.probeEjected()
+	require.True(t, client.endpoints.status()[0].Healthy)
+}
+
+func TestClient_CheckEndpoints(t *testing.T) {
+	live := newFrontend(t)
+	dead := deadURL(t)
+	client := NewClient(ClientSettings{Endpoints: []string{live.URL, dead}})
+	defer client.Close()
+
+	statuses := client.CheckEndpoints(context.Background(), nil)
+	require.Len(t, statuses, 2)
+	require.Equal(t, live.URL, statuses[0].URL)
+	require.True(t, statuses[0].Healthy)
+	require.Greater(t, statuses[0].Latency, time.Duration(0))
+	require.Equal(t, dead, statuses[1].URL)
+	require.False(t, statuses[1].Healthy)
+	require.NotEmpty(t, statuses[1].Error)
+}
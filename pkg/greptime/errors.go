@@ -0,0 +1,315 @@
+package greptime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"google.golang.org/grpc/codes"
+)
+
+// errorCodeHeader carries the GreptimeDB status code of a failed request, as
+// an HTTP header or gRPC trailer.
+const errorCodeHeader = "x-greptime-err-code"
+
+// ErrorKind classifies a failed GreptimeDB request.
+type ErrorKind string
+
+const (
+	ErrorKindUnknown          ErrorKind = "unknown"
+	ErrorKindUnauthenticated  ErrorKind = "unauthenticated"
+	ErrorKindPermissionDenied ErrorKind = "permission_denied"
+	ErrorKindTableNotFound    ErrorKind = "table_not_found"
+	ErrorKindColumnNotFound   ErrorKind = "column_not_found"
+	ErrorKindDatabaseNotFound ErrorKind = "database_not_found"
+	ErrorKindNotFound         ErrorKind = "not_found"
+	ErrorKindSyntax           ErrorKind = "syntax"
+	ErrorKindInvalidQuery     ErrorKind = "invalid_query"
+	ErrorKindOverloaded       ErrorKind = "overloaded"
+	ErrorKindUnavailable      ErrorKind = "unavailable"
+	ErrorKindTimeout          ErrorKind = "timeout"
+	ErrorKindInternal         ErrorKind = "internal"
+)
+
+// statusCodeKinds maps GreptimeDB status codes (common_error::status_code) to kinds.
+var statusCodeKinds = map[int]ErrorKind{
+	1000: ErrorKindUnknown,          // Unknown
+	1001: ErrorKindInvalidQuery,     // Unsupported
+	1002: ErrorKindInternal,         // Unexpected
+	1003: ErrorKindInternal,         // Internal
+	1004: ErrorKindInvalidQuery,     // InvalidArguments
+	1005: ErrorKindTimeout,          // Cancelled
+	1006: ErrorKindInternal,         // IllegalState
+	1007: ErrorKindInternal,         // External
+	1008: ErrorKindTimeout,          // DeadlineExceeded
+	2000: ErrorKindSyntax,           // InvalidSyntax
+	3000: ErrorKindInvalidQuery,     // PlanQuery
+	3001: ErrorKindInternal,         // EngineExecuteQuery
+	4000: ErrorKindInvalidQuery,     // TableAlreadyExists
+	4001: ErrorKindTableNotFound,    // TableNotFound
+	4002: ErrorKindColumnNotFound,   // TableColumnNotFound
+	4003: ErrorKindInvalidQuery,     // TableColumnExists
+	4004: ErrorKindDatabaseNotFound, // DatabaseNotFound
+	4005: ErrorKindNotFound,         // RegionNotFound
+	4006: ErrorKindInvalidQuery,     // RegionAlreadyExists
+	4007: ErrorKindInvalidQuery,     // RegionReadonly
+	4008: ErrorKindUnavailable,      // RegionNotReady
+	4009: ErrorKindOverloaded,       // RegionBusy
+	4010: ErrorKindUnavailable,      // TableUnavailable
+	4011: ErrorKindInvalidQuery,     // DatabaseAlreadyExists
+	5000: ErrorKindUnavailable,      // StorageUnavailable
+	5001: ErrorKindUnavailable,      // RequestOutdated
+	6000: ErrorKindOverloaded,       // RuntimeResourcesExhausted
+	6001: ErrorKindOverloaded,       // RateLimited
+	7000: ErrorKindUnauthenticated,  // UserNotFound
+	7001: ErrorKindUnauthenticated,  // UnsupportedPasswordType
+	7002: ErrorKindUnauthenticated,  // UserPasswordMismatch
+	7003: ErrorKindUnauthenticated,  // AuthHeaderNotFound
+	7004: ErrorKindUnauthenticated,  // InvalidAuthHeader
+	7005: ErrorKindPermissionDenied, // AccessDenied
+	7006: ErrorKindPermissionDenied, // PermissionDenied
+}
+
+// Error is a request GreptimeDB answered with a failure, classified by its
+// status code or, when it sent none, by the transport status.
+type Error struct {
+	Kind ErrorKind
+	// Code is the GreptimeDB status code, zero when unknown.
+	Code int
+	// Message is the server's error message.
+	Message string
+	// Database is the database the statement ran in.
+	Database string
+
+	// cause is the transport error (HTTP status, gRPC status, PgError).
+	cause error
+}
+
+func (e *Error) Error() string {
+	if msg := e.friendly(); msg != "" {
+		return msg
+	}
+	detail := e.Message
+	if e.cause != nil {
+		detail = e.cause.Error()
+	}
+	if hint := e.Kind.hint(); hint != "" {
+		return fmt.Sprintf("%s (%s)", detail, hint)
+	}
+	return detail
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Status is the Grafana status matching the error kind.
+func (e *Error) Status() backend.Status {
+	switch e.Kind {
+	case ErrorKindUnauthenticated:
+		return backend.StatusUnauthorized
+	case ErrorKindPermissionDenied:
+		return backend.StatusForbidden
+	case ErrorKindTableNotFound, ErrorKindColumnNotFound, ErrorKindDatabaseNotFound, ErrorKindNotFound:
+		return backend.StatusNotFound
+	case ErrorKindSyntax, ErrorKindInvalidQuery:
+		return backend.StatusBadRequest
+	case ErrorKindOverloaded:
+		return backend.StatusTooManyRequests
+	case ErrorKindUnavailable:
+		return backend.StatusBadGateway
+	case ErrorKindTimeout:
+		return backend.StatusTimeout
+	default:
+		return backend.StatusInternal
+	}
+}
+
+var (
+	tableNotFoundPattern    = regexp.MustCompile(`(?i)table not found: ?([^\s,]+)`)
+	databaseNotFoundPattern = regexp.MustCompile(`(?i)database not found: ?([^\s,]+)`)
+	columnNotFoundPattern   = regexp.MustCompile(`(?i)(?:no field named|column) ([^\s,]+)(?: not (?:found|exists?))?`)
+)
+
+// friendly rewrites not-found errors naming the missing object, or returns "".
+func (e *Error) friendly() string {
+	switch e.Kind {
+	case ErrorKindTableNotFound:
+		m := tableNotFoundPattern.FindStringSubmatch(e.Message)
+		if m == nil {
+			return ""
+		}
+		database, table := e.Database, strings.Trim(m[1], "`\"'")
+		// GreptimeDB reports fully qualified names: catalog.schema.table.
+		if parts := strings.Split(table, "."); len(parts) >= 2 {
+			database, table = parts[len(parts)-2], parts[len(parts)-1]
+		}
+		if database == "" {
+			return fmt.Sprintf("table %q not found", table)
+		}
+		return fmt.Sprintf("table %q not found in database %q", table, database)
+	case ErrorKindDatabaseNotFound:
+		m := databaseNotFoundPattern.FindStringSubmatch(e.Message)
+		if m == nil {
+			return ""
+		}
+		database := strings.Trim(m[1], "`\"'")
+		if parts := strings.Split(database, "."); len(parts) == 2 {
+			database = parts[1]
+		}
+		return fmt.Sprintf("database %q not found; check the default database or the query's database", database)
+	case ErrorKindColumnNotFound:
+		m := columnNotFoundPattern.FindStringSubmatch(e.Message)
+		if m == nil {
+			return ""
+		}
+		return fmt.Sprintf("column %s not found: %s", strings.Trim(m[1], "`\"'"), e.Message)
+	}
+	return ""
+}
+
+// hint suggests what the user can do about an error of kind k.
+func (k ErrorKind) hint() string {
+	switch k {
+	case ErrorKindUnauthenticated:
+		return "check the datasource credentials"
+	case ErrorKindPermissionDenied:
+		return "the user lacks permission for this database or table"
+	case ErrorKindSyntax:
+		return "check the query syntax"
+	case ErrorKindOverloaded:
+		return "GreptimeDB is overloaded; retry later or narrow the time range"
+	case ErrorKindUnavailable:
+		return "GreptimeDB is temporarily unavailable; retry later"
+	case ErrorKindTimeout:
+		return "the query was cancelled or timed out; narrow the time range or raise the query timeout"
+	}
+	return ""
+}
+
+// newError classifies a failure by GreptimeDB status code, falling back to
+// fallback when the code is unknown.
+func newError(code int, fallback ErrorKind, message, database string, cause error) *Error {
+	kind, ok := statusCodeKinds[code]
+	if !ok {
+		kind = fallback
+	}
+	// Some planner errors carry a generic code but name the missing table.
+	if (kind == ErrorKindInvalidQuery || kind == ErrorKindUnknown) && tableNotFoundPattern.MatchString(message) {
+		kind = ErrorKindTableNotFound
+	}
+	return &Error{Kind: kind, Code: code, Message: message, Database: database, cause: cause}
+}
+
+// parseErrorCode parses an x-greptime-err-code value, returning 0 when absent.
+func parseErrorCode(v string) int {
+	code, _ := strconv.Atoi(strings.TrimSpace(v))
+	return code
+}
+
+// kindFromHTTPStatus classifies an HTTP answer without a GreptimeDB code.
+func kindFromHTTPStatus(status int) ErrorKind {
+	switch {
+	case status == http.StatusUnauthorized:
+		return ErrorKindUnauthenticated
+	case status == http.StatusForbidden:
+		return ErrorKindPermissionDenied
+	case status == http.StatusNotFound:
+		return ErrorKindNotFound
+	case status == http.StatusTooManyRequests:
+		return ErrorKindOverloaded
+	case status == http.StatusRequestTimeout, status == http.StatusGatewayTimeout:
+		return ErrorKindTimeout
+	case status == http.StatusBadGateway, status == http.StatusServiceUnavailable:
+		return ErrorKindUnavailable
+	case status >= 500:
+		return ErrorKindInternal
+	case status >= 400:
+		return ErrorKindInvalidQuery
+	}
+	return ErrorKindUnknown
+}
+
+// kindFromGRPCCode classifies a gRPC status without a GreptimeDB code.
+func kindFromGRPCCode(code codes.Code) ErrorKind {
+	switch code {
+	case codes.Unauthenticated:
+		return ErrorKindUnauthenticated
+	case codes.PermissionDenied:
+		return ErrorKindPermissionDenied
+	case codes.NotFound:
+		return ErrorKindNotFound
+	case codes.InvalidArgument, codes.Unimplemented, codes.AlreadyExists, codes.FailedPrecondition, codes.OutOfRange:
+		return ErrorKindInvalidQuery
+	case codes.ResourceExhausted:
+		return ErrorKindOverloaded
+	case codes.Unavailable:
+		return ErrorKindUnavailable
+	case codes.DeadlineExceeded, codes.Canceled:
+		return ErrorKindTimeout
+	case codes.Internal, codes.DataLoss:
+		return ErrorKindInternal
+	}
+	return ErrorKindUnknown
+}
+
+// kindFromSQLState classifies a PostgreSQL error by its SQLSTATE.
+func kindFromSQLState(state string) ErrorKind {
+	switch state {
+	case "42P01":
+		return ErrorKindTableNotFound
+	case "42703":
+		return ErrorKindColumnNotFound
+	case "3D000", "3F000":
+		return ErrorKindDatabaseNotFound
+	case "42601":
+		return ErrorKindSyntax
+	case "42501":
+		return ErrorKindPermissionDenied
+	case "57014":
+		return ErrorKindTimeout
+	}
+	switch {
+	case strings.HasPrefix(state, "28"):
+		return ErrorKindUnauthenticated
+	case strings.HasPrefix(state, "08"), strings.HasPrefix(state, "57"):
+		return ErrorKindUnavailable
+	case strings.HasPrefix(state, "53"):
+		return ErrorKindOverloaded
+	case strings.HasPrefix(state, "22"), strings.HasPrefix(state, "42"), strings.HasPrefix(state, "0A"):
+		return ErrorKindInvalidQuery
+	case strings.HasPrefix(state, "XX"):
+		return ErrorKindInternal
+	}
+	return ErrorKindUnknown
+}
+
+// ErrorStatus returns the Grafana status for a failed query: the status of a
+// GreptimeDB Error, StatusTimeout for deadlines, StatusBadGateway when
+// GreptimeDB could not be reached, StatusBadRequest for other downstream
+// errors and StatusInternal for plugin errors.
+func ErrorStatus(err error) backend.Status {
+	var greptimeErr *Error
+	var urlErr *url.Error
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return backend.StatusOK
+	case errors.As(err, &greptimeErr):
+		return greptimeErr.Status()
+	case errors.Is(err, context.DeadlineExceeded):
+		return backend.StatusTimeout
+	case errors.As(err, &urlErr), errors.As(err, &netErr):
+		return backend.StatusBadGateway
+	case backend.IsDownstreamError(err):
+		return backend.StatusBadRequest
+	}
+	return backend.StatusInternal
+}
@@ -0,0 +1,136 @@
+package greptime
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_ErrorClassification(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		header  string
+		body    string
+		kind    ErrorKind
+		code    int
+		message string
+		result  backend.Status
+	}{
+		{
+			name:    "table not found",
+			status:  http.StatusOK,
+			body:    `{"code":4001,"error":"Failed to plan SQL: Table not found: greptime.metrics.cpu"}`,
+			kind:    ErrorKindTableNotFound,
+			code:    4001,
+			message: `table "cpu" not found in database "metrics"`,
+			result:  backend.StatusNotFound,
+		},
+		{
+			name:    "unqualified table not found uses the query database",
+			status:  http.StatusBadRequest,
+			body:    `{"code":1004,"error":"Table not found: cpu"}`,
+			kind:    ErrorKindTableNotFound,
+			code:    1004,
+			message: `table "cpu" not found in database "public"`,
+			result:  backend.StatusNotFound,
+		},
+		{
+			name:    "database not found",
+			status:  http.StatusOK,
+			body:    `{"code":4004,"error":"Database not found: greptime.missing"}`,
+			kind:    ErrorKindDatabaseNotFound,
+			code:    4004,
+			message: `database "missing" not found; check the default database or the query's database`,
+			result:  backend.StatusNotFound,
+		},
+		{
+			name:    "syntax error",
+			status:  http.StatusOK,
+			body:    `{"code":2000,"error":"sql parser error: Expected an expression"}`,
+			kind:    ErrorKindSyntax,
+			code:    2000,
+			message: "sql parser error: Expected an expression (check the query syntax)",
+			result:  backend.StatusBadRequest,
+		},
+		{
+			name:    "rate limited",
+			status:  http.StatusTooManyRequests,
+			body:    `{"code":6001,"error":"rate limited"}`,
+			kind:    ErrorKindOverloaded,
+			code:    6001,
+			message: "greptime http 429: rate limited (GreptimeDB is overloaded; retry later or narrow the time range)",
+			result:  backend.StatusTooManyRequests,
+		},
+		{
+			name:    "code from header",
+			status:  http.StatusInternalServerError,
+			header:  "1008",
+			body:    "query deadline exceeded",
+			kind:    ErrorKindTimeout,
+			code:    1008,
+			message: "greptime http 500: query deadline exceeded (the query was cancelled or timed out; narrow the time range or raise the query timeout)",
+			result:  backend.StatusTimeout,
+		},
+		{
+			name:    "http status only",
+			status:  http.StatusInternalServerError,
+			body:    "Internal Server Error",
+			kind:    ErrorKindInternal,
+			message: "greptime http 500: Internal Server Error",
+			result:  backend.StatusInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.header != "" {
+					w.Header().Set(errorCodeHeader, tt.header)
+				}
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer ts.Close()
+			client := NewClient(ClientSettings{SQLURL: ts.URL, ResponseFormat: ResponseFormatJSON})
+			defer client.Close()
+
+			_, err := client.ExecuteSQL(context.Background(), "SELECT * FROM cpu", nil)
+			var greptimeErr *Error
+			require.ErrorAs(t, err, &greptimeErr)
+			require.Equal(t, tt.kind, greptimeErr.Kind)
+			require.Equal(t, tt.code, greptimeErr.Code)
+			require.EqualError(t, err, tt.message)
+			require.True(t, backend.IsDownstreamError(err))
+			require.Equal(t, tt.result, ErrorStatus(err))
+		})
+	}
+}
+
+func TestClient_ErrorClassification_Auth(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"code":7006,"error":"User is not allowed to access database logs"}`))
+	}))
+	defer ts.Close()
+	client := NewClient(ClientSettings{SQLURL: ts.URL})
+	defer client.Close()
+
+	_, err := client.ExecuteSQL(context.Background(), "SELECT 1", nil)
+	require.ErrorIs(t, err, ErrAuthenticationFailed)
+	var greptimeErr *Error
+	require.ErrorAs(t, err, &greptimeErr)
+	require.Equal(t, ErrorKindPermissionDenied, greptimeErr.Kind)
+	require.Equal(t, backend.StatusForbidden, ErrorStatus(err))
+}
+
+func TestErrorStatus(t *testing.T) {
+	require.Equal(t, backend.StatusOK, ErrorStatus(nil))
+	require.Equal(t, backend.StatusTimeout, ErrorStatus(backend.DownstreamError(context.DeadlineExceeded)))
+	require.Equal(t, backend.StatusBadRequest, ErrorStatus(backend.DownstreamError(ErrInvalidHint)))
+	require.Equal(t, backend.StatusInternal, ErrorStatus(backend.PluginError(ErrInvalidHint)))
+}
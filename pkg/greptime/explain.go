@@ -0,0 +1,289 @@
+package greptime
+
+import (
+	"errors"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// explainPattern matches the EXPLAIN keyword and its options that start
+// statements already asking for a plan.
+var explainPattern = regexp.MustCompile(`(?is)^(?:\s+|--[^\n]*\n?|/\*.*?\*/)*EXPLAIN\b(?:\s+(?:ANALYZE|VERBOSE|FORMAT\s+\w+)\b)*`)
+
+// explainablePattern matches the queries that may run under EXPLAIN ANALYZE,
+// which executes them.
+var explainablePattern = regexp.MustCompile(`(?is)^(?:\s+|--[^\n]*\n?|/\*.*?\*/|\()*(SELECT|WITH|TQL|VALUES)\b`)
+
+// tqlEvalPattern matches the command of TQL EVAL statements, which TQL
+// ANALYZE explains.
+var tqlEvalPattern = regexp.MustCompile(`(?is)^((?:\s+|--[^\n]*\n?|/\*.*?\*/)*TQL\s+)(?:EVAL|EVALUATE)\b`)
+
+// explainedStatement returns the statement an EXPLAIN statement plans, and
+// false when statement is not an EXPLAIN.
+func explainedStatement(statement string) (string, bool) {
+	loc := explainPattern.FindStringIndex(statement)
+	if loc == nil {
+		return "", false
+	}
+	return statement[loc[1]:], true
+}
+
+// ErrNotExplainable is returned by ExplainSQL for statements that would
+// change data when run under EXPLAIN ANALYZE.
+var ErrNotExplainable = errors.New("only SELECT and TQL queries can be explained, as EXPLAIN ANALYZE executes the statement")
+
+// ExplainSQL wraps sql in EXPLAIN ANALYZE, or turns TQL EVAL into TQL
+// ANALYZE, unless it already asks for a plan, e.g. with a plain EXPLAIN that
+// only plans the query. Of several statements only the last is explained; the
+// ones before still set up the session for it. Statements other than queries,
+// including those of a written EXPLAIN, are rejected with ErrNotExplainable
+// rather than executed.
+func ExplainSQL(sql string) (string, error) {
+	if statements := SplitStatements(sql); len(statements) > 1 {
+		for _, statement := range statements[:len(statements)-1] {
+			if !IsSessionStatement(statement) {
+				return "", ErrNotExplainable
+			}
+		}
+		last := len(statements) - 1
+		explained, err := ExplainSQL(statements[last])
+		if err != nil {
+			return "", err
+		}
+		statements[last] = explained
+		return strings.Join(statements, ";\n"), nil
+	}
+	if explained, ok := explainedStatement(sql); ok {
+		if !explainablePattern.MatchString(explained) {
+			return "", ErrNotExplainable
+		}
+		return sql, nil
+	}
+	switch TQLCommand(sql) {
+	case "EVAL":
+		return tqlEvalPattern.ReplaceAllString(strings.TrimRight(strings.TrimSpace(sql), "; \t\n"), "${1}ANALYZE"), nil
+	case "EXPLAIN", "ANALYZE":
+		return sql, nil
+	}
+	if !explainablePattern.MatchString(sql) {
+		return "", ErrNotExplainable
+	}
+	return "EXPLAIN ANALYZE " + strings.TrimRight(strings.TrimSpace(sql), "; \t\n"), nil
+}
+
+// planNode is one operator of an execution plan.
+type planNode struct {
+	id       string
+	parent   string
+	name     string
+	detail   string
+	location string
+	metrics  [][2]string
+}
+
+// metricsPattern captures the metrics=[...] suffix DataFusion prints after
+// an operator in EXPLAIN ANALYZE output.
+var metricsPattern = regexp.MustCompile(`\s*,?\s*metrics=\[(.*)\]\s*$`)
+
+// ExplainToNodeGraph converts the result of EXPLAIN [ANALYZE] into Grafana
+// node graph frames: one node per operator carrying its metrics, and edges
+// from each operator to its inputs. Plans of later stages (the region scans
+// behind a MergeScanExec) hang off the stage that merges them. It returns nil
+// when frames hold no plan, so callers can show the raw table instead.
+func ExplainToNodeGraph(frames []*data.Frame) []*data.Frame {
+	var nodes []planNode
+	for _, frame := range frames {
+		// Ids continue across frames so the plans of several outputs stay apart.
+		nodes = append(nodes, planNodes(frame, len(nodes))...)
+	}
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	var metricNames []string
+	for _, node := range nodes {
+		for _, m := range node.metrics {
+			if !slices.Contains(metricNames, m[0]) {
+				metricNames = append(metricNames, m[0])
+			}
+		}
+	}
+	slices.Sort(metricNames)
+
+	ids := make([]string, len(nodes))
+	titles := make([]string, len(nodes))
+	subtitles := make([]string, len(nodes))
+	mainStats := make([]string, len(nodes))
+	secondaryStats := make([]string, len(nodes))
+	details := make([]string, len(nodes))
+	metricValues := make([][]string, len(metricNames))
+	for i := range metricValues {
+		metricValues[i] = make([]string, len(nodes))
+	}
+	var edgeIDs, sources, targets []string
+	for i, node := range nodes {
+		ids[i] = node.id
+		titles[i] = node.name
+		subtitles[i] = node.location
+		details[i] = node.detail
+		for _, m := range node.metrics {
+			switch m[0] {
+			case "output_rows":
+				mainStats[i] = m[1] + " rows"
+			case "elapsed_compute":
+				secondaryStats[i] = m[1]
+			}
+			metricValues[slices.Index(metricNames, m[0])][i] = m[1]
+		}
+		if node.parent != "" {
+			edgeIDs = append(edgeIDs, node.parent+"->"+node.id)
+			sources = append(sources, node.parent)
+			targets = append(targets, node.id)
+		}
+	}
+
+	nodeFields := []*data.Field{
+		data.NewField("id", nil, ids),
+		data.NewField("title", nil, titles),
+		data.NewField("subtitle", nil, subtitles),
+		data.NewField("mainstat", nil, mainStats),
+		data.NewField("secondarystat", nil, secondaryStats),
+		data.NewField("detail__operator", nil, details),
+	}
+	nodeFields[5].SetConfig(&data.FieldConfig{DisplayName: "Operator"})
+	for i, name := range metricNames {
+		field := data.NewField("detail__"+name, nil, metricValues[i])
+		field.SetConfig(&data.FieldConfig{DisplayName: name})
+		nodeFields = append(nodeFields, field)
+	}
+
+	nodeFrame := data.NewFrame("nodes", nodeFields...)
+	nodeFrame.Meta = &data.FrameMeta{PreferredVisualization: data.VisTypeNodeGraph}
+	edgeFrame := data.NewFrame("edges",
+		data.NewField("id", nil, edgeIDs),
+		data.NewField("source", nil, sources),
+		data.NewField("target", nil, targets),
+	)
+	edgeFrame.Meta = &data.FrameMeta{PreferredVisualization: data.VisTypeNodeGraph}
+	if len(frames) > 0 && frames[0] != nil {
+		nodeFrame.RefID = frames[0].RefID
+		edgeFrame.RefID = frames[0].RefID
+	}
+	return []*data.Frame{nodeFrame, edgeFrame}
+}
+
+// planNodes parses the plan column of an EXPLAIN frame. EXPLAIN ANALYZE adds
+// stage and node columns; plain EXPLAIN adds plan_type, of which only the
+// physical plan is kept when present. Node ids start at firstID.
+func planNodes(frame *data.Frame, firstID int) []planNode {
+	if frame == nil {
+		return nil
+	}
+	var planField, stageField, nodeField, typeField *data.Field
+	for _, field := range frame.Fields {
+		switch strings.ToLower(field.Name) {
+		case "plan":
+			planField = field
+		case "stage":
+			stageField = field
+		case "node":
+			nodeField = field
+		case "plan_type":
+			typeField = field
+		}
+	}
+	if planField == nil {
+		return nil
+	}
+
+	physicalOnly := false
+	for row := 0; typeField != nil && row < typeField.Len(); row++ {
+		if strings.Contains(stringAt(typeField, row), "physical") {
+			physicalOnly = true
+		}
+	}
+
+	var nodes []planNode
+	// mergeScans holds the last MergeScanExec of each stage; the plans of the
+	// next stage are its inputs.
+	mergeScans := map[int]string{}
+	for row := 0; row < planField.Len(); row++ {
+		if physicalOnly && !strings.Contains(stringAt(typeField, row), "physical") {
+			continue
+		}
+		stage, hasStage := -1, false
+		if s, err := strconv.Atoi(strings.TrimSpace(stringAt(stageField, row))); err == nil {
+			stage, hasStage = s, true
+		}
+		location := ""
+		if hasStage {
+			location = "stage " + strconv.Itoa(stage)
+			if n := strings.TrimSpace(stringAt(nodeField, row)); n != "" {
+				location += ", node " + n
+			}
+		} else if typeField != nil {
+			location = stringAt(typeField, row)
+		}
+
+		// stack holds the enclosing operators of the current line with their indents.
+		type open struct {
+			indent int
+			id     string
+		}
+		var stack []open
+		for _, line := range strings.Split(stringAt(planField, row), "\n") {
+			text := strings.TrimSpace(line)
+			if text == "" || strings.HasPrefix(text, "Total rows:") {
+				continue
+			}
+			indent := len(line) - len(strings.TrimLeft(line, " "))
+			for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+				stack = stack[:len(stack)-1]
+			}
+
+			node := parsePlanLine(text)
+			node.id = strconv.Itoa(firstID + len(nodes))
+			node.location = location
+			switch {
+			case len(stack) > 0:
+				node.parent = stack[len(stack)-1].id
+			case hasStage:
+				node.parent = mergeScans[stage-1]
+			}
+			if hasStage && strings.HasPrefix(node.name, "MergeScan") {
+				mergeScans[stage] = node.id
+			}
+			stack = append(stack, open{indent: indent, id: node.id})
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// parsePlanLine splits "Name: details metrics=[k=v, ...]" into its parts.
+func parsePlanLine(text string) planNode {
+	var node planNode
+	if m := metricsPattern.FindStringSubmatchIndex(text); m != nil {
+		for _, metric := range strings.Split(text[m[2]:m[3]], ", ") {
+			k, v, ok := strings.Cut(metric, "=")
+			if !ok {
+				k, v, ok = strings.Cut(metric, ":")
+			}
+			if k = strings.TrimSpace(k); ok && k != "" {
+				node.metrics = append(node.metrics, [2]string{k, strings.TrimSpace(v)})
+			}
+		}
+		text = text[:m[0]]
+	}
+	name, detail, _ := strings.Cut(text, ":")
+	if i := strings.IndexByte(name, ' '); i >= 0 {
+		name, detail = text[:i], text[i+1:]
+	}
+	node.name = strings.TrimSpace(name)
+	node.detail = strings.TrimSpace(detail)
+	return node
+}
@@ -0,0 +1,123 @@
+package greptime
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplainSQL(t *testing.T) {
+	for sql, want := range map[string]string{
+		" SELECT * FROM cpu;\n":            "EXPLAIN ANALYZE SELECT * FROM cpu",
+		"EXPLAIN SELECT 1":                 "EXPLAIN SELECT 1",
+		"/* c */ explain analyze SELECT 1": "/* c */ explain analyze SELECT 1",
+		"USE logs; SELECT 1;":              "USE logs;\nEXPLAIN ANALYZE SELECT 1",
+		"TQL EVAL (0, 10, '5s') up":        "TQL ANALYZE (0, 10, '5s') up",
+		"/* tag */ tql evaluate (1704067200, 1704153600, '1m') rate(http_requests_total{job=\"api\"}[5m]);": "/* tag */ tql ANALYZE (1704067200, 1704153600, '1m') rate(http_requests_total{job=\"api\"}[5m])",
+		"TQL ANALYZE (0, 10, '5s') up": "TQL ANALYZE (0, 10, '5s') up",
+		"EXPLAIN VERBOSE SELECT 1":     "EXPLAIN VERBOSE SELECT 1",
+	} {
+		got, err := ExplainSQL(sql)
+		require.NoError(t, err, sql)
+		require.Equal(t, want, got)
+	}
+
+	// EXPLAIN ANALYZE would execute these.
+	for _, sql := range []string{
+		"DELETE FROM cpu",
+		"INSERT INTO cpu VALUES (1, 2)",
+		"/* tag */ DROP TABLE cpu",
+		"DELETE FROM cpu; SELECT 1",
+		"EXPLAIN ANALYZE INSERT INTO cpu VALUES (1, 2)",
+		"EXPLAIN ANALYZE DELETE FROM cpu",
+		"-- why is this slow?\n/* tag */ EXPLAIN ANALYZE DELETE FROM cpu WHERE ts < now()",
+		"EXPLAIN ANALYZE VERBOSE CREATE TABLE t (ts TIMESTAMP TIME INDEX)",
+	} {
+		_, err := ExplainSQL(sql)
+		require.ErrorIs(t, err, ErrNotExplainable, sql)
+	}
+}
+
+func fieldStrings(t *testing.T, frame *data.Frame, name string) []string {
+	t.Helper()
+	field, _ := frame.FieldByName(name)
+	require.NotNil(t, field, name)
+	out := make([]string, field.Len())
+	for i := range out {
+		out[i] = field.At(i).(string)
+	}
+	return out
+}
+
+func TestExplainToNodeGraph_Analyze(t *testing.T) {
+	frame := data.NewFrame("",
+		data.NewField("stage", nil, []uint32{0, 1, 1}),
+		data.NewField("node", nil, []uint32{0, 0, 1}),
+		data.NewField("plan", nil, []string{
+			"MergeScanExec: peers=[4398046511104(1024, 0), ] metrics=[output_rows: 4, greptime_exec_read_cost: 0, finish_time: 2311]\n",
+			"ProjectionExec: expr=[host@0 as host] metrics=[output_rows=2, elapsed_compute=1.2µs]\n" +
+				"  FilterExec: usage@1 > 10, metrics=[output_rows=2, elapsed_compute=20µs]\n" +
+				"    SeqScan: region=4398046511104(1024, 0), partition_count=1 metrics=[output_rows=5, elapsed_compute=3ms]\n",
+			"ProjectionExec: expr=[host@0 as host] metrics=[output_rows=2]\n" +
+				"  SeqScan: region=4398046511105(1024, 1) metrics=[output_rows=2]\n" +
+				"\nTotal rows: 4",
+		}),
+	)
+	frame.RefID = "A"
+
+	out := ExplainToNodeGraph([]*data.Frame{frame})
+	require.Len(t, out, 2)
+	nodes, edges := out[0], out[1]
+	require.Equal(t, data.VisType(data.VisTypeNodeGraph), nodes.Meta.PreferredVisualization)
+	require.Equal(t, "A", nodes.RefID)
+
+	require.Equal(t, []string{"MergeScanExec", "ProjectionExec", "FilterExec", "SeqScan", "ProjectionExec", "SeqScan"}, fieldStrings(t, nodes, "title"))
+	require.Equal(t, []string{"stage 0, node 0", "stage 1, node 0", "stage 1, node 0", "stage 1, node 0", "stage 1, node 1", "stage 1, node 1"},
+		fieldStrings(t, nodes, "subtitle"))
+	require.Equal(t, []string{"4 rows", "2 rows", "2 rows", "5 rows", "2 rows", "2 rows"}, fieldStrings(t, nodes, "mainstat"))
+	require.Equal(t, []string{"", "1.2µs", "20µs", "3ms", "", ""}, fieldStrings(t, nodes, "secondarystat"))
+	require.Equal(t, "usage@1 > 10", fieldStrings(t, nodes, "detail__operator")[2])
+	require.Equal(t, "2311", fieldStrings(t, nodes, "detail__finish_time")[0])
+
+	// Region plans feed the merge scan; operators feed their parents.
+	require.Equal(t, []string{"0", "1", "2", "0", "4"}, fieldStrings(t, edges, "source"))
+	require.Equal(t, []string{"1", "2", "3", "4", "5"}, fieldStrings(t, edges, "target"))
+}
+
+func TestExplainToNodeGraph_SeveralFrames(t *testing.T) {
+	plan := func(stage uint32) *data.Frame {
+		return data.NewFrame("",
+			data.NewField("stage", nil, []uint32{stage}),
+			data.NewField("node", nil, []uint32{0}),
+			data.NewField("plan", nil, []string{"ProjectionExec: expr=[host@0 as host]\n  SeqScan: region=1\n"}),
+		)
+	}
+
+	out := ExplainToNodeGraph([]*data.Frame{plan(0), plan(0)})
+	require.Len(t, out, 2)
+	require.Equal(t, []string{"0", "1", "2", "3"}, fieldStrings(t, out[0], "id"))
+	require.Equal(t, []string{"0->1", "2->3"}, fieldStrings(t, out[1], "id"))
+}
+
+func TestExplainToNodeGraph_PhysicalPlan(t *testing.T) {
+	frame := data.NewFrame("",
+		data.NewField("plan_type", nil, []string{"logical_plan", "physical_plan"}),
+		data.NewField("plan", nil, []string{
+			"Projection: cpu.host\n  TableScan: cpu",
+			"CoalescePartitionsExec\n  SortExec TopK(fetch=10), expr=[ts@0 DESC]\n",
+		}),
+	)
+
+	out := ExplainToNodeGraph([]*data.Frame{frame})
+	require.Len(t, out, 2)
+	require.Equal(t, []string{"CoalescePartitionsExec", "SortExec"}, fieldStrings(t, out[0], "title"))
+	require.Equal(t, []string{"", "TopK(fetch=10), expr=[ts@0 DESC]"}, fieldStrings(t, out[0], "detail__operator"))
+	require.Equal(t, []string{"0"}, fieldStrings(t, out[1], "source"))
+}
+
+func TestFormatFrames_ExplainFallback(t *testing.T) {
+	frame := data.NewFrame("", data.NewField("result", nil, []string{"not a plan"}))
+	out := FormatFrames([]*data.Frame{frame}, FormatOptions{QueryType: QueryTypeExplain})
+	require.Equal(t, []*data.Frame{frame}, out)
+}
@@ -0,0 +1,441 @@
+package greptime
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/flight"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// DefaultFlightPort is the GreptimeDB frontend gRPC port.
+const DefaultFlightPort = 4001
+
+// FlightSettings is the subset of datasource settings required for the native
+// Arrow Flight transport.
+type FlightSettings struct {
+	// Address is the host:port of the frontend gRPC endpoint.
+	Address string
+
+	DefaultDatabase string
+	// AuthMode selects the credentials as in ClientSettings.
+	AuthMode              string
+	Username              string
+	Password              string
+	BearerToken           string
+	HttpHeaders           map[string]string
+	ForwardGrafanaHeaders bool
+	// Hints are query hints sent with every request as in ClientSettings.
+	Hints        map[string]string
+	QueryTimeout time.Duration
+	// RowLimit caps the rows kept per result set while decoding; zero or less means unlimited.
+	RowLimit int64
+	// TLSConfig enables TLS (and mTLS when it carries certificates); nil means plaintext.
+	TLSConfig *tls.Config
+	// Dialer replaces the default TCP dialer, e.g. to go through the PDC proxy.
+	Dialer func(ctx context.Context, addr string) (net.Conn, error)
+}
+
+// FlightClient executes SQL over GreptimeDB's Arrow Flight (gRPC) service.
+// Results are decoded into the same frames as the HTTP Arrow path.
+// A FlightClient is safe for concurrent use; requests share one gRPC connection.
+type FlightClient struct {
+	settings FlightSettings
+	client   flight.Client
+}
+
+func NewFlightClient(settings FlightSettings) (*FlightClient, error) {
+	creds := insecure.NewCredentials()
+	if settings.TLSConfig != nil {
+		creds = credentials.NewTLS(settings.TLSConfig)
+	}
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(math.MaxInt32)),
+	}
+
+	target := settings.Address
+	if settings.Dialer != nil {
+		opts = append(opts, grpc.WithContextDialer(settings.Dialer))
+		// The proxy resolves the host; skip local DNS resolution.
+		target = "passthrough:///" + target
+	}
+
+	client, err := flight.NewClientWithMiddleware(target, nil, nil, opts...)
+	if err != nil {
+		return nil, backend.DownstreamError(fmt.Errorf("greptime flight client: %w", err))
+	}
+	return &FlightClient{settings: settings, client: client}, nil
+}
+
+// Close closes the underlying gRPC connection.
+func (c *FlightClient) Close() {
+	_ = c.client.Close()
+}
+
+// ExecuteSQL runs sql through Flight DoGet. Cancelling ctx or reaching
+// QueryTimeout cancels the gRPC stream, which stops the query on the server.
+//
+// GreptimeDB runs one statement per Flight request and keeps no session
+// between requests, so statements are sent one at a time. Leading USE and
+// SET time_zone statements are applied to the tickets of the statements after
+// them; other SET statements are rejected as they would have no effect.
+func (c *FlightClient) ExecuteSQL(ctx context.Context, sql string, forwarded http.Header) (*Response, error) {
+	timeout := c.settings.QueryTimeout
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+	auth, err := c.ticketAuth(forwarded)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ctx = metadata.NewOutgoingContext(ctx, c.metadata(ctx, forwarded))
+
+	database, timezone := queryDatabase(ctx, c.settings.DefaultDatabase), queryTimezone(ctx)
+	statements := SplitStatements(sql)
+	if len(statements) < 2 {
+		response, err := c.doGet(ctx, sql, database, timezone, auth)
+		if err != nil {
+			return nil, err
+		}
+		setStatements(response, sql)
+		return response, nil
+	}
+
+	response := &Response{}
+	for _, statement := range statements {
+		if IsSessionStatement(statement) {
+			if err := applySessionStatement(statement, &database, &timezone); err != nil {
+				return nil, err
+			}
+			var affected int64
+			response.Output = append(response.Output, Output{AffectedRows: &affected, Frame: affectedRowsFrame(0), Statement: statement})
+			continue
+		}
+		resp, err := c.doGet(ctx, statement, database, timezone, auth)
+		if err != nil {
+			return nil, err
+		}
+		for _, output := range resp.Output {
+			output.Statement = statement
+			response.Output = append(response.Output, output)
+		}
+		response.ExecutionTimeMs += resp.ExecutionTimeMs
+		response.ResponseBytes += resp.ResponseBytes
+		response.PeerCertificates = resp.PeerCertificates
+	}
+	return response, nil
+}
+
+var (
+	useStatementPattern      = regexp.MustCompile(`(?i)^USE\s+(\S+?)\s*$`)
+	timezoneStatementPattern = regexp.MustCompile(`(?i)^SET\s+(?:SESSION\s+)?(?:TIME\s+ZONE|time_zone\s*(?:=|TO))\s*'([^']*)'\s*$`)
+)
+
+// applySessionStatement applies a USE or SET time_zone statement to the
+// ticket fields database and timezone.
+func applySessionStatement(statement string, database, timezone *string) error {
+	stripped := stripComments(statement)
+	if m := useStatementPattern.FindStringSubmatch(stripped); m != nil {
+		*database = strings.Trim(m[1], "`\"")
+		return nil
+	}
+	if m := timezoneStatementPattern.FindStringSubmatch(stripped); m != nil {
+		*timezone = m[1]
+		return nil
+	}
+	return backend.DownstreamError(fmt.Errorf("%q cannot apply to later statements over Arrow Flight; only USE and SET time_zone can, or use the HTTP or PostgreSQL protocol", StatementName(statement)))
+}
+
+// doGet runs a single statement in database and timezone.
+func (c *FlightClient) doGet(ctx context.Context, sql, database, timezone string, auth ticketAuth) (*Response, error) {
+	start := time.Now()
+	var server peer.Peer
+	stream, err := c.client.DoGet(ctx, &flight.Ticket{Ticket: encodeSQLTicket(sql, database, timezone, auth)}, grpc.Peer(&server))
+	if err != nil {
+		return nil, c.flightError(err, nil, database)
+	}
+
+	// Statements without a result set (e.g. INSERT) answer with metadata only,
+	// carrying the affected rows.
+	first, err := stream.Recv()
+	if errors.Is(err, io.EOF) {
+		return &Response{ExecutionTimeMs: time.Since(start).Milliseconds(), PeerCertificates: peerCertificates(&server)}, nil
+	}
+	if err != nil {
+		return nil, c.flightError(err, stream.Trailer(), database)
+	}
+	if len(first.DataHeader) == 0 {
+		response := &Response{}
+		for msg := first; ; {
+			if affected, ok := decodeAffectedRows(msg.AppMetadata); ok {
+				response.Output = []Output{{AffectedRows: &affected, Frame: affectedRowsFrame(affected)}}
+			}
+			if msg, err = stream.Recv(); err != nil {
+				if errors.Is(err, io.EOF) {
+					response.ExecutionTimeMs = time.Since(start).Milliseconds()
+					response.PeerCertificates = peerCertificates(&server)
+					return response, nil
+				}
+				return nil, c.flightError(err, stream.Trailer(), database)
+			}
+		}
+	}
+
+	peeked := &peekedStream{first: first, stream: stream}
+	reader, err := flight.NewRecordReader(peeked)
+	if err != nil {
+		return nil, c.flightError(err, stream.Trailer(), database)
+	}
+	defer reader.Release()
+
+	var records []arrow.Record
+	defer func() {
+		for _, rec := range records {
+			rec.Release()
+		}
+	}()
+	for reader.Next() {
+		rec := reader.Record()
+		rec.Retain()
+		records = append(records, rec)
+	}
+	if err := reader.Err(); err != nil {
+		return nil, c.flightError(err, stream.Trailer(), database)
+	}
+
+	frame, dropped := arrowRecordsToFrame(reader.Schema(), records, c.settings.RowLimit)
+	return &Response{
+		ExecutionTimeMs:  time.Since(start).Milliseconds(),
+		Output:           []Output{{Frame: frame, DroppedRows: dropped}},
+		ResponseBytes:    peeked.bytes,
+		PeerCertificates: peerCertificates(&server),
+	}, nil
+}
+
+// peerCertificates returns the TLS certificates the server presented, once the
+// call has finished.
+func peerCertificates(server *peer.Peer) []*x509.Certificate {
+	if info, ok := server.AuthInfo.(credentials.TLSInfo); ok {
+		return info.State.PeerCertificates
+	}
+	return nil
+}
+
+// CheckEndpoints runs SELECT 1 against the Flight endpoint.
+func (c *FlightClient) CheckEndpoints(ctx context.Context, forwarded http.Header) []EndpointStatus {
+	start := time.Now()
+	_, err := c.ExecuteSQL(ctx, "SELECT 1", forwarded)
+	status := EndpointStatus{URL: c.settings.Address, Healthy: err == nil, Latency: time.Since(start)}
+	if err != nil {
+		status.Error = err.Error()
+	}
+	return []EndpointStatus{status}
+}
+
+// ticketAuth resolves the AuthMode credentials carried in the request header.
+func (c *FlightClient) ticketAuth(forwarded http.Header) (ticketAuth, error) {
+	switch c.settings.AuthMode {
+	case AuthModeBearer, AuthModeOAuth:
+		auth, err := authorizationHeader(c.settings.AuthMode, "", "", c.settings.BearerToken, forwarded)
+		return ticketAuth{Token: bearerToken(auth)}, err
+	default:
+		return ticketAuth{Username: c.settings.Username, Password: c.settings.Password}, nil
+	}
+}
+
+// metadata carries custom and forwarded headers and the query hints of ctx
+// as gRPC metadata.
+func (c *FlightClient) metadata(ctx context.Context, forwarded http.Header) metadata.MD {
+	md := metadata.MD{}
+	for k, v := range c.settings.HttpHeaders {
+		if strings.TrimSpace(k) != "" {
+			md.Set(k, v)
+		}
+	}
+	if c.settings.ForwardGrafanaHeaders && forwarded != nil {
+		for k, vals := range forwarded {
+			if len(vals) == 0 {
+				continue
+			}
+			md.Set(k, strings.Join(vals, ","))
+		}
+	}
+	if hints := queryHints(ctx, c.settings.Hints); hints != "" {
+		md.Set(hintsHeader, hints)
+	}
+	return md
+}
+
+// peekedStream replays a message already received from stream and counts the
+// bytes of the messages it returns.
+type peekedStream struct {
+	first  *flight.FlightData
+	stream flight.FlightService_DoGetClient
+	bytes  int64
+}
+
+func (s *peekedStream) Recv() (*flight.FlightData, error) {
+	msg := s.first
+	s.first = nil
+	if msg == nil {
+		var err error
+		if msg, err = s.stream.Recv(); err != nil {
+			return nil, err
+		}
+	}
+	s.bytes += int64(len(msg.DataHeader) + len(msg.DataBody) + len(msg.AppMetadata))
+	return msg, nil
+}
+
+// flightError turns gRPC statuses into downstream Errors carrying the server
+// message, classified by the x-greptime-err-code trailer or else the gRPC code,
+// and flags rejected credentials.
+func (c *FlightClient) flightError(err error, trailer metadata.MD, database string) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return backend.DownstreamError(err)
+	}
+	var code int
+	if values := trailer.Get(errorCodeHeader); len(values) > 0 {
+		code = parseErrorCode(values[0])
+	}
+	cause := fmt.Errorf("greptime flight %s: %s", st.Code(), st.Message())
+	err = newError(code, kindFromGRPCCode(st.Code()), st.Message(), database, cause)
+	if st.Code() == codes.Unauthenticated || st.Code() == codes.PermissionDenied {
+		err = authError(c.settings.AuthMode, err)
+	}
+	return backend.DownstreamError(err)
+}
+
+// Field numbers of the greptime.v1 messages encoded into a DoGet ticket.
+const (
+	greptimeRequestHeader  = 1 // GreptimeRequest.header
+	greptimeRequestQuery   = 3 // GreptimeRequest.query
+	requestHeaderAuth      = 3 // RequestHeader.authorization
+	requestHeaderDbname    = 4 // RequestHeader.dbname
+	requestHeaderTimezone  = 6 // RequestHeader.timezone
+	authHeaderBasic        = 1 // AuthHeader.basic
+	authHeaderToken        = 2 // AuthHeader.token
+	basicUsername          = 1 // Basic.username
+	basicPassword          = 2 // Basic.password
+	tokenToken             = 1 // Token.token
+	queryRequestSQL        = 1 // QueryRequest.sql
+	flightMetadataAffected = 1 // FlightMetadata.affected_rows
+	affectedRowsValue      = 1 // AffectedRows.value
+)
+
+// ticketAuth is the AuthHeader of a ticket: a token, basic credentials, or
+// nothing when both are empty.
+type ticketAuth struct {
+	Username, Password string
+	Token              string
+}
+
+// encodeSQLTicket encodes a greptime.v1.GreptimeRequest running sql in dbname,
+// with the session timezone when it is not empty. The messages are small and
+// stable, so they are written with protowire instead of depending on the
+// generated greptime-proto package.
+func encodeSQLTicket(sql, dbname, timezone string, credentials ticketAuth) []byte {
+	var header []byte
+	switch {
+	case credentials.Token != "":
+		var token []byte
+		token = appendString(token, tokenToken, credentials.Token)
+		var auth []byte
+		auth = appendBytes(auth, authHeaderToken, token)
+		header = appendBytes(header, requestHeaderAuth, auth)
+	case credentials.Username != "":
+		var basic []byte
+		basic = appendString(basic, basicUsername, credentials.Username)
+		basic = appendString(basic, basicPassword, credentials.Password)
+		var auth []byte
+		auth = appendBytes(auth, authHeaderBasic, basic)
+		header = appendBytes(header, requestHeaderAuth, auth)
+	}
+	header = appendString(header, requestHeaderDbname, dbname)
+	if timezone != "" {
+		header = appendString(header, requestHeaderTimezone, timezone)
+	}
+
+	var query []byte
+	query = appendString(query, queryRequestSQL, sql)
+
+	var request []byte
+	request = appendBytes(request, greptimeRequestHeader, header)
+	request = appendBytes(request, greptimeRequestQuery, query)
+	return request
+}
+
+// decodeAffectedRows reads the affected rows from the greptime.v1.FlightMetadata
+// GreptimeDB sends as app metadata for statements without a result set.
+func decodeAffectedRows(b []byte) (int64, bool) {
+	affected, ok := protoField(b, flightMetadataAffected, protowire.BytesType)
+	if !ok {
+		return 0, false
+	}
+	value, ok := protoField(affected, affectedRowsValue, protowire.VarintType)
+	if !ok {
+		// proto3 omits a zero value.
+		return 0, true
+	}
+	n, _ := protowire.ConsumeVarint(value)
+	return int64(n), true
+}
+
+// protoField returns the encoded value of the last field num of type typ in
+// b, skipping any other field.
+func protoField(b []byte, num protowire.Number, typ protowire.Type) ([]byte, bool) {
+	var value []byte
+	var found bool
+	for len(b) > 0 {
+		n, t, tagLen := protowire.ConsumeTag(b)
+		if tagLen < 0 {
+			return nil, false
+		}
+		b = b[tagLen:]
+		valueLen := protowire.ConsumeFieldValue(n, t, b)
+		if valueLen < 0 {
+			return nil, false
+		}
+		if n == num && t == typ {
+			value, found = b[:valueLen], true
+			if t == protowire.BytesType {
+				value, _ = protowire.ConsumeBytes(value)
+			}
+		}
+		b = b[valueLen:]
+	}
+	return value, found
+}
+
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func appendBytes(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
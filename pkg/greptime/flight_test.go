@@ -0,0 +1,286 @@
+package greptime
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow/flight"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// flightTicket is the part of a GreptimeRequest ticket checked by the tests.
+type flightTicket struct {
+	SQL, DB, Timezone, Username, Password, Token string
+}
+
+// protoFields returns the last value of each length-delimited field in b.
+func protoFields(t testing.TB, b []byte) map[protowire.Number][]byte {
+	t.Helper()
+	fields := map[protowire.Number][]byte{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		require.GreaterOrEqual(t, n, 0)
+		require.Equal(t, protowire.BytesType, typ)
+		b = b[n:]
+		v, n := protowire.ConsumeBytes(b)
+		require.GreaterOrEqual(t, n, 0)
+		fields[num] = v
+		b = b[n:]
+	}
+	return fields
+}
+
+func decodeFlightTicket(t testing.TB, ticket []byte) flightTicket {
+	request := protoFields(t, ticket)
+	header := protoFields(t, request[greptimeRequestHeader])
+	query := protoFields(t, request[greptimeRequestQuery])
+	auth := protoFields(t, header[requestHeaderAuth])
+	basic := protoFields(t, auth[authHeaderBasic])
+	token := protoFields(t, auth[authHeaderToken])
+	return flightTicket{
+		SQL:      string(query[queryRequestSQL]),
+		DB:       string(header[requestHeaderDbname]),
+		Timezone: string(header[requestHeaderTimezone]),
+		Username: string(basic[basicUsername]),
+		Password: string(basic[basicPassword]),
+		Token:    string(token[tokenToken]),
+	}
+}
+
+// flightFrontend is a fake GreptimeDB Flight service answering every DoGet
+// with the records of an Arrow IPC file, or with err when set.
+type flightFrontend struct {
+	flight.BaseFlightServer
+	t    testing.TB
+	body []byte
+	err  error
+
+	// trailer is sent with err, e.g. to carry x-greptime-err-code.
+	trailer metadata.MD
+	// appMetadata is sent instead of records when body is nil.
+	appMetadata []byte
+
+	mu      sync.Mutex
+	tickets []flightTicket
+	md      metadata.MD
+}
+
+func (f *flightFrontend) DoGet(ticket *flight.Ticket, stream flight.FlightService_DoGetServer) error {
+	f.mu.Lock()
+	f.tickets = append(f.tickets, decodeFlightTicket(f.t, ticket.Ticket))
+	f.md, _ = metadata.FromIncomingContext(stream.Context())
+	f.mu.Unlock()
+	if f.err != nil {
+		stream.SetTrailer(f.trailer)
+		return f.err
+	}
+	if f.body == nil {
+		if f.appMetadata != nil {
+			return stream.Send(&flight.FlightData{AppMetadata: f.appMetadata})
+		}
+		return nil
+	}
+
+	reader, err := ipc.NewFileReader(bytes.NewReader(f.body))
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	writer := flight.NewRecordWriter(stream, ipc.WithSchema(reader.Schema()))
+	defer writer.Close()
+	for i := 0; i < reader.NumRecords(); i++ {
+		rec, err := reader.Record(i)
+		if err != nil {
+			return err
+		}
+		if err := writer.Write(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newFlightFrontend(t *testing.T, body []byte) (*flightFrontend, string) {
+	t.Helper()
+	f := &flightFrontend{t: t, body: body}
+	server := flight.NewServerWithMiddleware(nil)
+	require.NoError(t, server.Init("127.0.0.1:0"))
+	server.RegisterFlightService(f)
+	go func() { _ = server.Serve() }()
+	t.Cleanup(server.Shutdown)
+	return f, server.Addr().String()
+}
+
+func newTestFlightClient(t *testing.T, settings FlightSettings) *FlightClient {
+	t.Helper()
+	client, err := NewFlightClient(settings)
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+	return client
+}
+
+func TestFlightClient_ExecuteSQL_MatchesHTTPFrames(t *testing.T) {
+	body := writeMetricArrow(t, 250, 100)
+	frontend, addr := newFlightFrontend(t, body)
+	client := newTestFlightClient(t, FlightSettings{
+		Address:         addr,
+		DefaultDatabase: "metrics",
+		Username:        "greptime",
+		Password:        "secret",
+		HttpHeaders:     map[string]string{"X-Tenant": "a"},
+		RowLimit:        200,
+	})
+
+	resp, err := client.ExecuteSQL(context.Background(), "SELECT * FROM cpu", nil)
+	require.NoError(t, err)
+
+	expected, err := decodeArrowResponse(body, 200)
+	require.NoError(t, err)
+	setStatements(expected, "SELECT * FROM cpu")
+	require.Len(t, resp.Output, 1)
+	require.Equal(t, expected.Output[0].DroppedRows, resp.Output[0].DroppedRows)
+
+	got, err := ResponseToFrames(resp, "A")
+	require.NoError(t, err)
+	want, err := ResponseToFrames(expected, "A")
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	require.Equal(t, []flightTicket{{SQL: "SELECT * FROM cpu", DB: "metrics", Username: "greptime", Password: "secret"}}, frontend.tickets)
+	require.Equal(t, []string{"a"}, frontend.md.Get("x-tenant"))
+}
+
+func TestFlightClient_ExecuteSQL_NoResultSet(t *testing.T) {
+	frontend, addr := newFlightFrontend(t, nil)
+	client := newTestFlightClient(t, FlightSettings{Address: addr})
+
+	resp, err := client.ExecuteSQL(context.Background(), "INSERT INTO cpu VALUES (1, 2)", nil)
+	require.NoError(t, err)
+	require.Empty(t, resp.Output)
+	require.Equal(t, "public", frontend.tickets[0].DB)
+	require.Empty(t, frontend.tickets[0].Username)
+}
+
+func TestFlightClient_ExecuteSQL_AffectedRows(t *testing.T) {
+	frontend, addr := newFlightFrontend(t, nil)
+	var affected []byte
+	affected = protowire.AppendTag(affected, affectedRowsValue, protowire.VarintType)
+	affected = protowire.AppendVarint(affected, 3)
+	frontend.appMetadata = appendBytes(nil, flightMetadataAffected, affected)
+	client := newTestFlightClient(t, FlightSettings{Address: addr})
+
+	resp, err := client.ExecuteSQL(context.Background(), "INSERT INTO cpu VALUES (1, 2), (3, 4), (5, 6)", nil)
+	require.NoError(t, err)
+	require.Len(t, resp.Output, 1)
+	require.Equal(t, int64(3), *resp.Output[0].AffectedRows)
+}
+
+func TestFlightClient_ExecuteSQL_SessionStatements(t *testing.T) {
+	frontend, addr := newFlightFrontend(t, writeMetricArrow(t, 2, 100))
+	client := newTestFlightClient(t, FlightSettings{Address: addr, DefaultDatabase: "metrics"})
+
+	resp, err := client.ExecuteSQL(context.Background(), "USE logs; SET time_zone = 'Asia/Shanghai';\nSELECT * FROM cpu", nil)
+	require.NoError(t, err)
+	require.Len(t, resp.Output, 3)
+	require.True(t, resp.Output[0].IsAffectedRows())
+	require.True(t, resp.Output[1].IsAffectedRows())
+	require.Equal(t, "SELECT * FROM cpu", resp.Output[2].Statement)
+	require.Equal(t, 2, resp.Output[2].Frame.Rows())
+	require.Equal(t, []flightTicket{{SQL: "SELECT * FROM cpu", DB: "logs", Timezone: "Asia/Shanghai"}}, frontend.tickets)
+
+	_, err = client.ExecuteSQL(context.Background(), "SET max_execution_time = 10; SELECT 1", nil)
+	require.ErrorContains(t, err, `"SET max_execution_time = 10" cannot apply to later statements over Arrow Flight`)
+}
+
+func TestFlightClient_Session(t *testing.T) {
+	frontend, addr := newFlightFrontend(t, nil)
+	client := newTestFlightClient(t, FlightSettings{Address: addr, DefaultDatabase: "metrics"})
+
+	_, err := client.ExecuteSQL(WithDatabase(context.Background(), "logs"), "SELECT 1", nil)
+	require.NoError(t, err)
+	_, err = client.ExecuteSQL(WithTimezone(context.Background(), "Asia/Shanghai"), "SELECT 1", nil)
+	require.NoError(t, err)
+	require.Equal(t, []flightTicket{
+		{SQL: "SELECT 1", DB: "logs"},
+		{SQL: "SELECT 1", DB: "metrics", Timezone: "Asia/Shanghai"},
+	}, frontend.tickets)
+}
+
+func TestFlightClient_ExecuteSQL_Error(t *testing.T) {
+	frontend, addr := newFlightFrontend(t, nil)
+	frontend.err = status.Error(codes.InvalidArgument, "Table not found: cpu")
+	client := newTestFlightClient(t, FlightSettings{Address: addr})
+
+	_, err := client.ExecuteSQL(context.Background(), "SELECT * FROM cpu", nil)
+	require.EqualError(t, err, `table "cpu" not found in database "public"`)
+
+	statuses := client.CheckEndpoints(context.Background(), nil)
+	require.Len(t, statuses, 1)
+	require.False(t, statuses[0].Healthy)
+	require.Equal(t, addr, statuses[0].URL)
+}
+
+func TestFlightClient_ErrorCode(t *testing.T) {
+	frontend, addr := newFlightFrontend(t, nil)
+	frontend.err = status.Error(codes.Internal, "Region 42 is busy")
+	frontend.trailer = metadata.Pairs(errorCodeHeader, "4009")
+	client := newTestFlightClient(t, FlightSettings{Address: addr})
+
+	_, err := client.ExecuteSQL(context.Background(), "SELECT 1", nil)
+	var greptimeErr *Error
+	require.ErrorAs(t, err, &greptimeErr)
+	require.Equal(t, ErrorKindOverloaded, greptimeErr.Kind)
+	require.Equal(t, 4009, greptimeErr.Code)
+	require.ErrorContains(t, err, "greptime flight Internal: Region 42 is busy")
+}
+
+func TestFlightClient_ForwardedHeaders(t *testing.T) {
+	frontend, addr := newFlightFrontend(t, writeMetricArrow(t, 1, 1))
+	client := newTestFlightClient(t, FlightSettings{Address: addr, ForwardGrafanaHeaders: true, QueryTimeout: time.Second})
+
+	_, err := client.ExecuteSQL(context.Background(), "SELECT 1", http.Header{"X-Grafana-User": {"admin"}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"admin"}, frontend.md.Get("x-grafana-user"))
+}
+
+func TestFlightClient_Hints(t *testing.T) {
+	frontend, addr := newFlightFrontend(t, nil)
+	client := newTestFlightClient(t, FlightSettings{Address: addr, Hints: map[string]string{"read_preference": "follower"}})
+
+	_, err := client.ExecuteSQL(WithHints(context.Background(), map[string]string{"query_parallelism": "4"}), "SELECT 1", nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"query_parallelism=4, read_preference=follower"}, frontend.md.Get("x-greptime-hints"))
+}
+
+func TestFlightClient_AuthModes(t *testing.T) {
+	frontend, addr := newFlightFrontend(t, writeMetricArrow(t, 1, 1))
+
+	bearer := newTestFlightClient(t, FlightSettings{Address: addr, AuthMode: AuthModeBearer, BearerToken: "static", Username: "ignored"})
+	_, err := bearer.ExecuteSQL(context.Background(), "SELECT 1", nil)
+	require.NoError(t, err)
+
+	oauth := newTestFlightClient(t, FlightSettings{Address: addr, AuthMode: AuthModeOAuth})
+	_, err = oauth.ExecuteSQL(context.Background(), "SELECT 1", http.Header{"Authorization": {"Bearer user-token"}})
+	require.NoError(t, err)
+	_, err = oauth.ExecuteSQL(context.Background(), "SELECT 1", nil)
+	require.ErrorIs(t, err, ErrMissingOAuthToken)
+
+	require.Equal(t, []flightTicket{
+		{SQL: "SELECT 1", DB: "public", Token: "static"},
+		{SQL: "SELECT 1", DB: "public", Token: "user-token"},
+	}, frontend.tickets)
+
+	frontend.err = status.Error(codes.Unauthenticated, "invalid token")
+	_, err = bearer.ExecuteSQL(context.Background(), "SELECT 1", nil)
+	require.ErrorIs(t, err, ErrAuthenticationFailed)
+	require.ErrorContains(t, err, "invalid token")
+}
@@ -38,10 +38,15 @@ func isSingleTraceDetail(frames []*data.Frame) bool {
 
 // FormatFrames applies query-type-specific shaping after ResponseToFrames.
 // Time series → multi-frame; logs → LogLines; traces detail → Grafana Trace fields.
+// Notices on the input frames (e.g. row limit warnings) are kept on the output.
 func FormatFrames(frames []*data.Frame, opts FormatOptions) []*data.Frame {
 	if len(frames) == 0 {
 		return frames
 	}
+	return carryNotices(frames, formatFrames(frames, opts))
+}
+
+func formatFrames(frames []*data.Frame, opts FormatOptions) []*data.Frame {
 
 	// Preserve error frames as-is.
 	if len(frames) == 1 && frames[0] != nil && len(frames[0].Fields) > 0 && frames[0].Fields[0].Name == "Error" {
@@ -65,7 +70,35 @@ func FormatFrames(frames []*data.Frame, opts FormatOptions) []*data.Frame {
 			return TransformTraceDetailFrames(frames, opts.TraceColumns, opts.TraceDuration)
 		}
 		return frames
+	case QueryTypeExplain:
+		if graph := ExplainToNodeGraph(frames); graph != nil {
+			return graph
+		}
+		return frames
 	default:
 		return frames
 	}
 }
+
+// carryNotices moves notices from the original frames onto the first shaped
+// frame when shaping replaced the frames (multi-frame, logs, traces).
+func carryNotices(in, out []*data.Frame) []*data.Frame {
+	var notices []data.Notice
+	original := make(map[*data.Frame]bool, len(in))
+	for _, frame := range in {
+		original[frame] = true
+		if frame != nil && frame.Meta != nil {
+			notices = append(notices, frame.Meta.Notices...)
+		}
+	}
+	if len(notices) == 0 || len(out) == 0 || out[0] == nil {
+		return out
+	}
+	for _, frame := range out {
+		if original[frame] {
+			return out
+		}
+	}
+	out[0].AppendNotices(notices...)
+	return out
+}
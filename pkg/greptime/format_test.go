@@ -134,6 +134,22 @@ func TestFormatFrames_TimeSeries(t *testing.T) {
 	assert.Equal(t, "b", out[1].Fields[1].Labels["instance"])
 }
 
+func TestFormatFrames_TimeSeriesKeepsNotices(t *testing.T) {
+	frame := data.NewFrame("Result 1",
+		data.NewField("time", nil, []time.Time{time.UnixMilli(1700000000000), time.UnixMilli(1700000060000)}),
+		data.NewField("instance", nil, []*string{str("a"), str("b")}),
+		data.NewField("value", nil, []*float64{f64(1.5), f64(2.5)}),
+	)
+	frame.AppendNotices(data.Notice{Severity: data.NoticeSeverityWarning, Text: "row limit"})
+
+	out := FormatFrames([]*data.Frame{frame}, FormatOptions{QueryType: QueryTypeTimeSeries})
+	require.Len(t, out, 2)
+	require.NotNil(t, out[0].Meta)
+	require.Len(t, out[0].Meta.Notices, 1)
+	assert.Equal(t, "row limit", out[0].Meta.Notices[0].Text)
+	assert.Nil(t, out[1].Meta)
+}
+
 func TestResolveQueryType(t *testing.T) {
 	assert.Equal(t, QueryTypeTraces, ResolveQueryType(QueryModel{RefID: "Trace ID"}))
 	assert.Equal(t, QueryTypeLogs, ResolveQueryType(QueryModel{
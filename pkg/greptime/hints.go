@@ -0,0 +1,64 @@
+package greptime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// hintsHeader carries query hints as comma-separated name=value pairs, e.g.
+// "read_preference=leader, query_parallelism=4".
+const hintsHeader = "x-greptime-hints"
+
+// ErrInvalidHint is returned for hints that cannot be encoded in hintsHeader.
+var ErrInvalidHint = errors.New("invalid query hint")
+
+var hintNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// ValidateHint checks that name=value can be sent as a query hint: names are
+// lowercase letters, digits and underscores, and values are non-empty
+// without the ',' and '=' separators.
+func ValidateHint(name, value string) error {
+	if !hintNamePattern.MatchString(name) {
+		return backend.DownstreamError(fmt.Errorf("%w: name %q must be lowercase letters, digits and underscores", ErrInvalidHint, name))
+	}
+	if value == "" || strings.ContainsAny(value, ",=\r\n") {
+		return backend.DownstreamError(fmt.Errorf("%w: value %q of %s must be non-empty and contain no ',' or '='", ErrInvalidHint, value, name))
+	}
+	return nil
+}
+
+type hintsKey struct{}
+
+// WithHints returns a context whose queries carry hints in addition to the
+// client's, replacing client hints of the same name. Hints must pass
+// ValidateHint.
+func WithHints(ctx context.Context, hints map[string]string) context.Context {
+	if len(hints) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, hintsKey{}, hints)
+}
+
+// queryHints merges the WithHints hints of ctx over defaults and encodes
+// them, sorted by name, as a hintsHeader value; "" means no hints.
+func queryHints(ctx context.Context, defaults map[string]string) string {
+	hints := maps.Clone(defaults)
+	if override, ok := ctx.Value(hintsKey{}).(map[string]string); ok {
+		if hints == nil {
+			hints = map[string]string{}
+		}
+		maps.Copy(hints, override)
+	}
+	pairs := make([]string, 0, len(hints))
+	for _, name := range slices.Sorted(maps.Keys(hints)) {
+		pairs = append(pairs, name+"="+hints[name])
+	}
+	return strings.Join(pairs, ", ")
+}
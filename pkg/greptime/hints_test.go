@@ -0,0 +1,59 @@
+package greptime
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateHint(t *testing.T) {
+	require.NoError(t, ValidateHint("read_preference", "leader"))
+	require.NoError(t, ValidateHint("query_parallelism", "4"))
+
+	for _, tt := range []struct{ name, value string }{
+		{"", "1"},
+		{"Parallelism", "1"},
+		{"read-preference", "leader"},
+		{"ttl", ""},
+		{"ttl", "7d, append_mode=true"},
+		{"ttl", "a=b"},
+	} {
+		require.ErrorIs(t, ValidateHint(tt.name, tt.value), ErrInvalidHint, "%s=%s", tt.name, tt.value)
+	}
+}
+
+func TestClient_Hints(t *testing.T) {
+	var hints []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hints = append(hints, r.Header.Get("x-greptime-hints"))
+		_, _ = w.Write([]byte(`{"code":0,"output":[]}`))
+	}))
+	defer ts.Close()
+
+	client := NewClient(ClientSettings{
+		SQLURL:         ts.URL + "/v1/sql",
+		ResponseFormat: ResponseFormatJSON,
+		Hints:          map[string]string{"read_preference": "follower", "query_parallelism": "2"},
+	})
+	defer client.Close()
+
+	ctx := context.Background()
+	_, err := client.ExecuteSQL(ctx, "SELECT 1", nil)
+	require.NoError(t, err)
+	_, err = client.ExecuteSQL(WithHints(ctx, map[string]string{"read_preference": "leader", "ttl": "7d"}), "SELECT 1", nil)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{
+		"query_parallelism=2, read_preference=follower",
+		"query_parallelism=2, read_preference=leader, ttl=7d",
+	}, hints)
+
+	withoutDefaults := NewClient(ClientSettings{SQLURL: ts.URL + "/v1/sql", ResponseFormat: ResponseFormatJSON})
+	defer withoutDefaults.Close()
+	_, err = withoutDefaults.ExecuteSQL(ctx, "SELECT 1", nil)
+	require.NoError(t, err)
+	require.Equal(t, "", hints[2])
+}
@@ -151,7 +151,11 @@ func stringAt(field *data.Field, row int) string {
 		}
 		return *t
 	default:
-		return fmt.Sprint(t)
+		// Dereference typed nullable values (e.g. *int64 from Arrow responses).
+		if c, ok := field.ConcreteAt(row); ok {
+			return fmt.Sprint(c)
+		}
+		return ""
 	}
 }
 
@@ -223,8 +227,10 @@ func floatPtrAt(field *data.Field, row int) *float64 {
 		f := float64(t)
 		return &f
 	default:
-		if f, ok := toFloat64(v); ok {
-			return &f
+		if c, ok := field.ConcreteAt(row); ok {
+			if f, ok := toFloat64(c); ok {
+				return &f
+			}
 		}
 		return nil
 	}
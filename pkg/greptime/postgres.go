@@ -0,0 +1,409 @@
+package greptime
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DefaultPostgresPort is the GreptimeDB frontend PostgreSQL port.
+const DefaultPostgresPort = 4003
+
+// PostgresSettings is the subset of datasource settings required for the
+// PostgreSQL wire-protocol transport. Query hints have no equivalent in the
+// wire protocol and are not sent.
+type PostgresSettings struct {
+	// Address is the host:port of the frontend PostgreSQL endpoint.
+	Address string
+
+	DefaultDatabase string
+	Username        string
+	Password        string
+	QueryTimeout    time.Duration
+	// RowLimit caps the rows kept per result set while decoding; zero or less means unlimited.
+	RowLimit int64
+	// MaxConns bounds the connection pool; zero keeps the pgxpool default.
+	MaxConns int32
+	// ConnMaxLifetime closes pooled connections after this age; zero keeps the pgxpool default.
+	ConnMaxLifetime time.Duration
+	// TLSConfig enables TLS (and mTLS when it carries certificates); nil means plaintext.
+	TLSConfig *tls.Config
+	// Dialer replaces the default TCP dialer, e.g. to go through the PDC proxy.
+	Dialer func(ctx context.Context, addr string) (net.Conn, error)
+}
+
+// PostgresClient executes SQL over GreptimeDB's PostgreSQL wire protocol.
+// Columns become the same typed fields as /v1/sql Arrow responses, so frames
+// match the HTTP transport; the wire protocol does not say which columns are
+// nullable, so every field is. A PostgresClient is safe for concurrent use.
+//
+// All queries share one pool bounded by MaxConns. Connections start in the
+// default database and the server's timezone; a query selecting another
+// database or timezone with WithDatabase and WithTimezone switches the
+// connection it acquires with USE and SET TIME ZONE first.
+type PostgresClient struct {
+	settings PostgresSettings
+	pool     *pgxpool.Pool
+	initial  session // the session of new connections
+
+	mu       sync.Mutex
+	closed   bool
+	sessions map[*pgx.Conn]session // connections switched away from initial
+}
+
+// session is the database and timezone of a connection; an empty timezone
+// is the server's.
+type session struct {
+	database, timezone string
+}
+
+// errPostgresClosed is returned by queries started after Close.
+var errPostgresClosed = errors.New("greptime postgres client is closed")
+
+func NewPostgresClient(settings PostgresSettings) (*PostgresClient, error) {
+	connURL := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(settings.Username, settings.Password),
+		Host:     settings.Address,
+		Path:     "/" + queryDatabase(context.Background(), settings.DefaultDatabase),
+		RawQuery: "sslmode=disable&application_name=grafana",
+	}
+	config, err := pgxpool.ParseConfig(connURL.String())
+	if err != nil {
+		return nil, backend.DownstreamError(fmt.Errorf("greptime postgres config: %w", err))
+	}
+
+	config.ConnConfig.TLSConfig = settings.TLSConfig
+	if settings.Dialer != nil {
+		config.ConnConfig.DialFunc = func(ctx context.Context, _, addr string) (net.Conn, error) {
+			return settings.Dialer(ctx, addr)
+		}
+		// The proxy resolves the host; skip local DNS resolution.
+		config.ConnConfig.LookupFunc = func(_ context.Context, host string) ([]string, error) {
+			return []string{host}, nil
+		}
+	}
+	if settings.MaxConns > 0 {
+		config.MaxConns = settings.MaxConns
+	}
+	if settings.ConnMaxLifetime > 0 {
+		config.MaxConnLifetime = settings.ConnMaxLifetime
+	}
+
+	c := &PostgresClient{
+		settings: settings,
+		initial:  session{database: config.ConnConfig.Database},
+		sessions: map[*pgx.Conn]session{},
+	}
+	config.BeforeClose = c.forget
+	// The pool connects lazily, so this does not reach the server.
+	if c.pool, err = pgxpool.NewWithConfig(context.Background(), config); err != nil {
+		return nil, backend.DownstreamError(fmt.Errorf("greptime postgres pool: %w", err))
+	}
+	return c, nil
+}
+
+// Close closes all pooled connections. Queries started afterwards fail.
+func (c *PostgresClient) Close() {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	c.pool.Close()
+}
+
+// acquire returns a pooled connection switched to s.
+func (c *PostgresClient) acquire(ctx context.Context, s session) (*pgxpool.Conn, error) {
+	for {
+		c.mu.Lock()
+		closed := c.closed
+		c.mu.Unlock()
+		if closed {
+			return nil, backend.PluginError(errPostgresClosed)
+		}
+
+		conn, err := c.pool.Acquire(ctx)
+		if err != nil {
+			return nil, postgresError(err, s.database)
+		}
+		current := c.sessionOf(conn.Conn())
+		if current == s {
+			return conn, nil
+		}
+		if s.timezone == "" && current.timezone != "" {
+			// The server's timezone cannot be restored; only connections that
+			// never changed it still have it.
+			c.discard(conn)
+			continue
+		}
+		if err := c.switchSession(ctx, conn, current, s); err != nil {
+			c.discard(conn)
+			return nil, postgresError(err, s.database)
+		}
+		return conn, nil
+	}
+}
+
+// switchSession runs the USE and SET TIME ZONE statements that take conn
+// from session current to s.
+func (c *PostgresClient) switchSession(ctx context.Context, conn *pgxpool.Conn, current, s session) error {
+	var statements []string
+	if s.database != current.database {
+		statements = append(statements, `USE "`+strings.ReplaceAll(s.database, `"`, `""`)+`"`)
+	}
+	if s.timezone != current.timezone {
+		statements = append(statements, "SET TIME ZONE '"+strings.ReplaceAll(s.timezone, "'", "''")+"'")
+	}
+	for _, statement := range statements {
+		if _, err := conn.Conn().PgConn().Exec(ctx, statement).ReadAll(); err != nil {
+			return err
+		}
+	}
+	c.mu.Lock()
+	c.sessions[conn.Conn()] = s
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *PostgresClient) sessionOf(conn *pgx.Conn) session {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s, ok := c.sessions[conn]; ok {
+		return s
+	}
+	return c.initial
+}
+
+// forget drops the session of a connection the pool closes.
+func (c *PostgresClient) forget(conn *pgx.Conn) {
+	c.mu.Lock()
+	delete(c.sessions, conn)
+	c.mu.Unlock()
+}
+
+// discard closes conn instead of returning it to the pool, freeing its slot.
+func (c *PostgresClient) discard(conn *pgxpool.Conn) {
+	raw := conn.Hijack()
+	c.forget(raw)
+	_ = raw.Close(context.Background())
+}
+
+// ExecuteSQL runs sql with the simple query protocol, producing one Output
+// per statement: a result set, or the affected-row count of statements
+// without one. Leading SET or USE statements apply to the statements after
+// them; the connection they changed is not reused. Cancelling ctx or reaching
+// QueryTimeout sends a PostgreSQL cancel request for the statement. Forwarded
+// headers cannot be carried over the wire protocol and are ignored.
+func (c *PostgresClient) ExecuteSQL(ctx context.Context, sql string, _ http.Header) (*Response, error) {
+	timeout := c.settings.QueryTimeout
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	s := session{
+		database: queryDatabase(ctx, c.settings.DefaultDatabase),
+		timezone: queryTimezone(ctx),
+	}
+	conn, err := c.acquire(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	if changesSession(sql) {
+		// The session the statements leave is unknown; close the connection
+		// rather than return it to the pool.
+		defer c.discard(conn)
+	} else {
+		defer conn.Release()
+	}
+	typeMap := conn.Conn().TypeMap()
+
+	// pgconn.Exec skips pgx's statement handling, which would require
+	// standard_conforming_strings and reject multiple statements.
+	start := time.Now()
+	results := conn.Conn().PgConn().Exec(ctx, sql)
+	response := &Response{}
+	for results.NextResult() {
+		output, err := c.readResult(typeMap, results.ResultReader())
+		if err != nil {
+			_ = results.Close()
+			return nil, postgresError(err, s.database)
+		}
+		response.Output = append(response.Output, *output)
+	}
+	if err := results.Close(); err != nil {
+		return nil, postgresError(err, s.database)
+	}
+	response.ExecutionTimeMs = time.Since(start).Milliseconds()
+	setStatements(response, sql)
+	if tlsConn, ok := conn.Conn().PgConn().Conn().(*tls.Conn); ok {
+		response.PeerCertificates = tlsConn.ConnectionState().PeerCertificates
+	}
+	return response, nil
+}
+
+// readResult converts one result set; statements without columns yield the
+// affected-row count of their command tag.
+func (c *PostgresClient) readResult(typeMap *pgtype.Map, result *pgconn.ResultReader) (*Output, error) {
+	fields := result.FieldDescriptions()
+	if len(fields) == 0 {
+		tag, err := result.Close()
+		if err != nil {
+			return nil, err
+		}
+		affected := tag.RowsAffected()
+		return &Output{AffectedRows: &affected, Frame: affectedRowsFrame(affected)}, nil
+	}
+
+	frameFields := make([]*data.Field, len(fields))
+	for i, field := range fields {
+		name := field.Name
+		if name == "" {
+			name = fmt.Sprintf("column_%d", i+1)
+		}
+		frameFields[i] = data.NewFieldFromFieldType(postgresFieldType(field.DataTypeOID), 0)
+		frameFields[i].Name = name
+		frameFields[i].SetConfig(&data.FieldConfig{})
+	}
+
+	var kept, dropped int64
+	for result.NextRow() {
+		if c.settings.RowLimit > 0 && kept >= c.settings.RowLimit {
+			dropped++
+			continue
+		}
+		for i, src := range result.Values() {
+			value, err := decodePostgresValue(typeMap, fields[i], src)
+			if err != nil {
+				return nil, fmt.Errorf("decode column %q: %w", fields[i].Name, err)
+			}
+			frameFields[i].Extend(1)
+			if value != nil {
+				frameFields[i].SetConcrete(int(kept), value)
+			}
+		}
+		kept++
+	}
+	if _, err := result.Close(); err != nil {
+		return nil, err
+	}
+	return &Output{Frame: data.NewFrame("", frameFields...), DroppedRows: dropped}, nil
+}
+
+// changesSession reports whether sql has a SET or USE statement.
+func changesSession(sql string) bool {
+	for _, statement := range SplitStatements(sql) {
+		if IsSessionStatement(statement) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckEndpoints runs SELECT 1 against the PostgreSQL endpoint.
+func (c *PostgresClient) CheckEndpoints(ctx context.Context, forwarded http.Header) []EndpointStatus {
+	start := time.Now()
+	_, err := c.ExecuteSQL(ctx, "SELECT 1", forwarded)
+	status := EndpointStatus{URL: c.settings.Address, Healthy: err == nil, Latency: time.Since(start)}
+	if err != nil {
+		status.Error = err.Error()
+	}
+	return []EndpointStatus{status}
+}
+
+// postgresFieldType picks the field type arrowColumnToField gives the same
+// column over /v1/sql: 64-bit integers, float64 for floats and decimals, and
+// strings for everything without a dedicated type.
+func postgresFieldType(oid uint32) data.FieldType {
+	switch oid {
+	case pgtype.BoolOID:
+		return data.FieldTypeNullableBool
+	case pgtype.Int2OID, pgtype.Int4OID, pgtype.Int8OID:
+		return data.FieldTypeNullableInt64
+	case pgtype.Float4OID, pgtype.Float8OID, pgtype.NumericOID:
+		return data.FieldTypeNullableFloat64
+	case pgtype.DateOID, pgtype.TimestampOID, pgtype.TimestamptzOID:
+		return data.FieldTypeNullableTime
+	default:
+		return data.FieldTypeNullableString
+	}
+}
+
+// decodePostgresValue decodes a wire value with the driver's codecs into the
+// concrete value of its postgresFieldType, or nil for NULL.
+func decodePostgresValue(typeMap *pgtype.Map, field pgconn.FieldDescription, src []byte) (any, error) {
+	if src == nil {
+		return nil, nil
+	}
+	fieldType := postgresFieldType(field.DataTypeOID)
+	typ, ok := typeMap.TypeForOID(field.DataTypeOID)
+	if !ok || fieldType == data.FieldTypeNullableString && field.Format == pgtype.TextFormatCode {
+		return string(src), nil
+	}
+	value, err := typ.Codec.DecodeValue(typeMap, field.DataTypeOID, field.Format, src)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case pgtype.Numeric:
+		f, err := v.Float64Value()
+		if err != nil || !f.Valid {
+			return nil, nil
+		}
+		return f.Float64, nil
+	case time.Time:
+		return v.UTC(), nil
+	case pgtype.InfinityModifier:
+		return nil, nil
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case fmt.Stringer:
+		return v.String(), nil
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+// postgresError turns server errors into downstream Errors carrying the server
+// message, classified by SQLSTATE, and flags rejected credentials.
+func postgresError(err error, database string) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return backend.DownstreamError(err)
+	}
+	cause := fmt.Errorf("greptime postgres %s: %s", pgErr.Code, pgErr.Message)
+	greptimeErr := newError(0, kindFromSQLState(pgErr.Code), pgErr.Message, database, cause)
+	if greptimeErr.Kind == ErrorKindUnauthenticated {
+		return backend.DownstreamError(authError(AuthModeBasic, greptimeErr))
+	}
+	return backend.DownstreamError(greptimeErr)
+}
@@ -0,0 +1,309 @@
+package greptime
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/require"
+)
+
+// pgFrontend is a fake GreptimeDB PostgreSQL endpoint speaking just enough of
+// the wire protocol for simple queries; respond builds the reply to each query.
+type pgFrontend struct {
+	respond func(sql string) []pgproto3.BackendMessage
+
+	mu        sync.Mutex
+	startup   map[string]string
+	databases []string
+	password  string
+	queries   []string
+}
+
+func newPGFrontend(t *testing.T, respond func(sql string) []pgproto3.BackendMessage) (*pgFrontend, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+
+	f := &pgFrontend{respond: respond}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f, ln.Addr().String()
+}
+
+func (f *pgFrontend) serve(conn net.Conn) {
+	defer conn.Close()
+	backend := pgproto3.NewBackend(conn, conn)
+
+	msg, err := backend.ReceiveStartupMessage()
+	if err != nil {
+		return
+	}
+	if _, ok := msg.(*pgproto3.SSLRequest); ok {
+		if _, err := conn.Write([]byte("N")); err != nil {
+			return
+		}
+		if msg, err = backend.ReceiveStartupMessage(); err != nil {
+			return
+		}
+	}
+	startup, ok := msg.(*pgproto3.StartupMessage)
+	if !ok {
+		return
+	}
+
+	backend.Send(&pgproto3.AuthenticationCleartextPassword{})
+	if err := backend.Flush(); err != nil {
+		return
+	}
+	_ = backend.SetAuthType(pgproto3.AuthTypeCleartextPassword)
+	msg, err = backend.Receive()
+	if err != nil {
+		return
+	}
+	password, _ := msg.(*pgproto3.PasswordMessage)
+
+	f.mu.Lock()
+	f.startup = startup.Parameters
+	f.databases = append(f.databases, startup.Parameters["database"])
+	if password != nil {
+		f.password = password.Password
+	}
+	f.mu.Unlock()
+
+	backend.Send(&pgproto3.AuthenticationOk{})
+	backend.Send(&pgproto3.ParameterStatus{Name: "server_version", Value: "16.3-greptimedb"})
+	backend.Send(&pgproto3.BackendKeyData{ProcessID: 1, SecretKey: 1})
+	backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+	if err := backend.Flush(); err != nil {
+		return
+	}
+
+	for {
+		msg, err := backend.Receive()
+		if err != nil {
+			return
+		}
+		query, ok := msg.(*pgproto3.Query)
+		if !ok {
+			return
+		}
+		f.mu.Lock()
+		f.queries = append(f.queries, query.String)
+		f.mu.Unlock()
+		for _, reply := range f.respond(query.String) {
+			backend.Send(reply)
+		}
+		backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+		if err := backend.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func pgColumn(name string, oid uint32) pgproto3.FieldDescription {
+	return pgproto3.FieldDescription{Name: []byte(name), DataTypeOID: oid, DataTypeSize: -1, TypeModifier: -1}
+}
+
+func metricRows() []pgproto3.BackendMessage {
+	return []pgproto3.BackendMessage{
+		&pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{
+			pgColumn("ts", pgtype.TimestamptzOID),
+			pgColumn("host", pgtype.TextOID),
+			pgColumn("count", pgtype.Int8OID),
+			pgColumn("value", pgtype.Float8OID),
+			pgColumn("ok", pgtype.BoolOID),
+		}},
+		&pgproto3.DataRow{Values: [][]byte{[]byte("2024-01-01 00:00:00.123456+00"), []byte("a"), []byte("9007199254740993"), []byte("0.5"), []byte("t")}},
+		&pgproto3.DataRow{Values: [][]byte{[]byte("2024-01-01 00:01:00+00"), nil, []byte("2"), nil, []byte("f")}},
+		&pgproto3.DataRow{Values: [][]byte{[]byte("2024-01-01 00:02:00+00"), []byte("c"), nil, []byte("1.5"), nil}},
+		&pgproto3.CommandComplete{CommandTag: []byte("SELECT 3")},
+	}
+}
+
+func newTestPostgresClient(t *testing.T, settings PostgresSettings) *PostgresClient {
+	t.Helper()
+	client, err := NewPostgresClient(settings)
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+	return client
+}
+
+func TestPostgresClient_ExecuteSQL_MatchesHTTPFrames(t *testing.T) {
+	frontend, addr := newPGFrontend(t, func(string) []pgproto3.BackendMessage { return metricRows() })
+	client := newTestPostgresClient(t, PostgresSettings{
+		Address:         addr,
+		DefaultDatabase: "metrics",
+		Username:        "greptime",
+		Password:        "secret",
+	})
+
+	resp, err := client.ExecuteSQL(context.Background(), "SELECT * FROM cpu", nil)
+	require.NoError(t, err)
+	got, err := ResponseToFrames(resp, "A")
+	require.NoError(t, err)
+
+	// The same rows as the default HTTP transport decodes them from Arrow,
+	// keeping integers above 2^53 and microseconds.
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "ts", Type: &arrow.TimestampType{Unit: arrow.Microsecond}, Nullable: true},
+		{Name: "host", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "count", Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+		{Name: "value", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+		{Name: "ok", Type: arrow.FixedWidthTypes.Boolean, Nullable: true},
+	}, nil)
+	builder := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer builder.Release()
+	builder.Field(0).(*array.TimestampBuilder).AppendValues([]arrow.Timestamp{1704067200123456, 1704067260000000, 1704067320000000}, nil)
+	builder.Field(1).(*array.StringBuilder).AppendValues([]string{"a", "", "c"}, []bool{true, false, true})
+	builder.Field(2).(*array.Int64Builder).AppendValues([]int64{9007199254740993, 2, 0}, []bool{true, true, false})
+	builder.Field(3).(*array.Float64Builder).AppendValues([]float64{0.5, 0, 1.5}, []bool{true, false, true})
+	builder.Field(4).(*array.BooleanBuilder).AppendValues([]bool{true, false, false}, []bool{true, true, false})
+	rec := builder.NewRecord()
+	defer rec.Release()
+
+	var body bytes.Buffer
+	writer, err := ipc.NewFileWriter(&body, ipc.WithSchema(schema))
+	require.NoError(t, err)
+	require.NoError(t, writer.Write(rec))
+	require.NoError(t, writer.Close())
+	arrowResp, err := decodeArrowResponse(body.Bytes(), 0)
+	require.NoError(t, err)
+	setStatements(arrowResp, "SELECT * FROM cpu")
+	want, err := ResponseToFrames(arrowResp, "A")
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+	require.Equal(t, data.FieldTypeNullableInt64, got[0].Fields[2].Type())
+
+	frontend.mu.Lock()
+	defer frontend.mu.Unlock()
+	require.Equal(t, "metrics", frontend.startup["database"])
+	require.Equal(t, "greptime", frontend.startup["user"])
+	require.Equal(t, "secret", frontend.password)
+	require.Equal(t, []string{"SELECT * FROM cpu"}, frontend.queries)
+}
+
+func TestPostgresClient_ExecuteSQL_RowLimit(t *testing.T) {
+	_, addr := newPGFrontend(t, func(string) []pgproto3.BackendMessage { return metricRows() })
+	client := newTestPostgresClient(t, PostgresSettings{Address: addr, RowLimit: 2})
+
+	resp, err := client.ExecuteSQL(context.Background(), "SELECT * FROM cpu", nil)
+	require.NoError(t, err)
+	require.Equal(t, 2, resp.Output[0].Frame.Rows())
+	require.Equal(t, int64(1), resp.Output[0].DroppedRows)
+}
+
+func TestPostgresClient_ExecuteSQL_NoResultSet(t *testing.T) {
+	_, addr := newPGFrontend(t, func(string) []pgproto3.BackendMessage {
+		return []pgproto3.BackendMessage{&pgproto3.CommandComplete{CommandTag: []byte("INSERT 0 1")}}
+	})
+	client := newTestPostgresClient(t, PostgresSettings{Address: addr})
+
+	resp, err := client.ExecuteSQL(context.Background(), "INSERT INTO cpu VALUES (1, 2)", nil)
+	require.NoError(t, err)
+	require.Len(t, resp.Output, 1)
+	require.True(t, resp.Output[0].IsAffectedRows())
+	require.Equal(t, int64(1), *resp.Output[0].AffectedRows)
+}
+
+func TestPostgresClient_ExecuteSQL_SessionStatements(t *testing.T) {
+	frontend, addr := newPGFrontend(t, func(string) []pgproto3.BackendMessage {
+		return append([]pgproto3.BackendMessage{&pgproto3.CommandComplete{CommandTag: []byte("SET")}}, metricRows()...)
+	})
+	client := newTestPostgresClient(t, PostgresSettings{Address: addr, MaxConns: 1})
+
+	sql := "SET time_zone = 'Asia/Shanghai';\nSELECT * FROM cpu"
+	resp, err := client.ExecuteSQL(context.Background(), sql, nil)
+	require.NoError(t, err)
+	require.Len(t, resp.Output, 2)
+	require.True(t, resp.Output[0].IsAffectedRows())
+	require.Equal(t, "SET time_zone = 'Asia/Shanghai'", resp.Output[0].Statement)
+	require.Equal(t, "SELECT * FROM cpu", resp.Output[1].Statement)
+	require.Equal(t, 3, resp.Output[1].Frame.Rows())
+
+	// The changed connection is closed, so the next query gets a new one.
+	_, err = client.ExecuteSQL(context.Background(), "SELECT * FROM cpu", nil)
+	require.NoError(t, err)
+	frontend.mu.Lock()
+	defer frontend.mu.Unlock()
+	require.Equal(t, []string{sql, "SELECT * FROM cpu"}, frontend.queries)
+	require.Len(t, frontend.databases, 2)
+}
+
+func TestPostgresClient_Session(t *testing.T) {
+	frontend, addr := newPGFrontend(t, func(string) []pgproto3.BackendMessage { return metricRows() })
+	client := newTestPostgresClient(t, PostgresSettings{Address: addr, DefaultDatabase: "metrics", MaxConns: 1})
+
+	ctx := context.Background()
+	for _, database := range []string{"logs", "logs", ""} {
+		_, err := client.ExecuteSQL(WithDatabase(ctx, database), "SELECT * FROM cpu", nil)
+		require.NoError(t, err)
+	}
+	_, err := client.ExecuteSQL(WithTimezone(ctx, "Asia/Shanghai"), "SELECT * FROM cpu", nil)
+	require.NoError(t, err)
+	_, err = client.ExecuteSQL(WithDatabase(WithTimezone(ctx, "UTC"), "logs"), "SELECT * FROM cpu", nil)
+	require.NoError(t, err)
+
+	// The server's timezone cannot be set again, so the connection is replaced.
+	_, err = client.ExecuteSQL(ctx, "SELECT * FROM cpu", nil)
+	require.NoError(t, err)
+
+	frontend.mu.Lock()
+	defer frontend.mu.Unlock()
+	// One pool serves every database and timezone, switching the connection
+	// only when the session changes.
+	require.Equal(t, []string{"metrics", "metrics"}, frontend.databases)
+	require.Equal(t, []string{
+		`USE "logs"`, "SELECT * FROM cpu",
+		"SELECT * FROM cpu",
+		`USE "metrics"`, "SELECT * FROM cpu",
+		"SET TIME ZONE 'Asia/Shanghai'", "SELECT * FROM cpu",
+		`USE "logs"`, "SET TIME ZONE 'UTC'", "SELECT * FROM cpu",
+		"SELECT * FROM cpu",
+	}, frontend.queries)
+}
+
+func TestPostgresClient_Closed(t *testing.T) {
+	_, addr := newPGFrontend(t, func(string) []pgproto3.BackendMessage { return metricRows() })
+	client, err := NewPostgresClient(PostgresSettings{Address: addr})
+	require.NoError(t, err)
+	client.Close()
+
+	_, err = client.ExecuteSQL(context.Background(), "SELECT * FROM cpu", nil)
+	require.ErrorIs(t, err, errPostgresClosed)
+}
+
+func TestPostgresClient_ExecuteSQL_Error(t *testing.T) {
+	_, addr := newPGFrontend(t, func(string) []pgproto3.BackendMessage {
+		return []pgproto3.BackendMessage{&pgproto3.ErrorResponse{Severity: "ERROR", Code: "42P01", Message: "Table not found: cpu"}}
+	})
+	client := newTestPostgresClient(t, PostgresSettings{Address: addr})
+
+	_, err := client.ExecuteSQL(context.Background(), "SELECT * FROM cpu", nil)
+	require.EqualError(t, err, `table "cpu" not found in database "public"`)
+	var greptimeErr *Error
+	require.ErrorAs(t, err, &greptimeErr)
+	require.Equal(t, ErrorKindTableNotFound, greptimeErr.Kind)
+
+	statuses := client.CheckEndpoints(context.Background(), nil)
+	require.Len(t, statuses, 1)
+	require.False(t, statuses[0].Healthy)
+	require.Equal(t, addr, statuses[0].URL)
+}
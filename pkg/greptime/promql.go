@@ -0,0 +1,181 @@
+package greptime
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Prometheus API result types (data.resultType).
+const (
+	promResultMatrix = "matrix"
+	promResultVector = "vector"
+	promResultScalar = "scalar"
+	promResultString = "string"
+)
+
+// promMaxPoints mirrors Prometheus' limit on points per series in range queries.
+const promMaxPoints = 11000
+
+// PromQuery is a PromQL expression evaluated over a time range (or at End when Instant).
+type PromQuery struct {
+	Expr    string
+	Start   time.Time
+	End     time.Time
+	Step    time.Duration
+	Instant bool
+}
+
+// PromResponse mirrors the Prometheus HTTP API envelope returned by
+// GreptimeDB /v1/prometheus/api/v1/query and /query_range.
+type PromResponse struct {
+	Status    string   `json:"status"`
+	Data      PromData `json:"data"`
+	ErrorType string   `json:"errorType,omitempty"`
+	Error     string   `json:"error,omitempty"`
+	Warnings  []string `json:"warnings,omitempty"`
+}
+
+type PromData struct {
+	ResultType string          `json:"resultType"`
+	Result     json.RawMessage `json:"result"`
+}
+
+type promSeries struct {
+	Metric map[string]string `json:"metric"`
+	Values [][2]any          `json:"values"`
+	Value  *[2]any           `json:"value"`
+}
+
+// PromStep resolves the evaluation step for a range query: an explicit step
+// (a Go duration or a number of seconds) wins, otherwise the panel interval is
+// used. The step is raised so that no series exceeds promMaxPoints.
+func PromStep(step string, interval time.Duration, start, end time.Time) (time.Duration, error) {
+	resolved := interval
+	if s := strings.TrimSpace(step); s != "" {
+		if d, err := time.ParseDuration(s); err == nil {
+			resolved = d
+		} else if secs, err := strconv.ParseFloat(s, 64); err == nil {
+			resolved = time.Duration(secs * float64(time.Second))
+		} else {
+			return 0, fmt.Errorf("invalid step %q", step)
+		}
+	}
+	if resolved < time.Second {
+		resolved = time.Second
+	}
+	if span := end.Sub(start); span/resolved > promMaxPoints {
+		resolved = (span / promMaxPoints).Truncate(time.Second) + time.Second
+	}
+	return resolved, nil
+}
+
+// PromResponseToFrames converts a Prometheus API result into multi-frame time
+// series: one frame per series holding a time field and a labeled value field,
+// the same shape LongToMultiFrame produces for SQL results.
+func PromResponseToFrames(response *PromResponse, refID string) ([]*data.Frame, error) {
+	if response == nil {
+		return nil, fmt.Errorf("empty prometheus response")
+	}
+
+	var frames []*data.Frame
+	switch response.Data.ResultType {
+	case promResultMatrix, promResultVector:
+		var series []promSeries
+		if err := json.Unmarshal(response.Data.Result, &series); err != nil {
+			return nil, fmt.Errorf("decode prometheus %s: %w", response.Data.ResultType, err)
+		}
+		sort.SliceStable(series, func(i, j int) bool {
+			return labelKey(series[i].Metric) < labelKey(series[j].Metric)
+		})
+		frames = make([]*data.Frame, 0, len(series))
+		for _, s := range series {
+			samples := s.Values
+			if s.Value != nil {
+				samples = [][2]any{*s.Value}
+			}
+			frames = append(frames, promSeriesFrame(data.Labels(s.Metric), samples, refID))
+		}
+	case promResultScalar:
+		var sample [2]any
+		if err := json.Unmarshal(response.Data.Result, &sample); err != nil {
+			return nil, fmt.Errorf("decode prometheus scalar: %w", err)
+		}
+		frames = []*data.Frame{promSeriesFrame(nil, [][2]any{sample}, refID)}
+	case promResultString:
+		var sample [2]any
+		if err := json.Unmarshal(response.Data.Result, &sample); err != nil {
+			return nil, fmt.Errorf("decode prometheus string: %w", err)
+		}
+		ts, _ := promTime(sample[0])
+		text, _ := sample[1].(string)
+		frame := data.NewFrame("value",
+			data.NewField("time", nil, []time.Time{ts}),
+			data.NewField("value", nil, []string{text}),
+		)
+		frame.RefID = refID
+		frames = []*data.Frame{frame}
+	default:
+		return nil, fmt.Errorf("unsupported prometheus result type %q", response.Data.ResultType)
+	}
+
+	if len(frames) > 0 {
+		for _, warning := range response.Warnings {
+			frames[0].AppendNotices(data.Notice{Severity: data.NoticeSeverityWarning, Text: warning})
+		}
+	}
+	return frames, nil
+}
+
+func promSeriesFrame(labels data.Labels, samples [][2]any, refID string) *data.Frame {
+	times := make([]time.Time, 0, len(samples))
+	values := make([]*float64, 0, len(samples))
+	for _, sample := range samples {
+		ts, ok := promTime(sample[0])
+		if !ok {
+			continue
+		}
+		times = append(times, ts)
+		values = append(values, promValue(sample[1]))
+	}
+
+	timeField := data.NewField("time", nil, times)
+	timeField.SetConfig(&data.FieldConfig{})
+	if labels == nil {
+		labels = data.Labels{}
+	}
+	valueField := data.NewField("value", labels, values)
+	valueField.SetConfig(&data.FieldConfig{})
+
+	frame := data.NewFrame("value", timeField, valueField)
+	frame.RefID = refID
+	return frame
+}
+
+// promTime converts a Prometheus sample timestamp (float seconds) to time.Time.
+func promTime(v any) (time.Time, bool) {
+	secs, ok := v.(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(int64(math.Round(secs * 1000))), true
+}
+
+// promValue parses a Prometheus sample value; NaN and ±Inf become nulls like floatPtrAt.
+func promValue(v any) *float64 {
+	s, ok := v.(string)
+	if !ok {
+		return nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil
+	}
+	return &f
+}
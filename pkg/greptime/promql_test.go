@@ -0,0 +1,143 @@
+package greptime
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromResponseToFrames_Matrix(t *testing.T) {
+	raw := `{
+		"status": "success",
+		"data": {
+			"resultType": "matrix",
+			"result": [
+				{"metric": {"__name__": "cpu", "host": "b"}, "values": [[1700000000, "3"], [1700000060, "NaN"]]},
+				{"metric": {"__name__": "cpu", "host": "a"}, "values": [[1700000000, "1.5"], [1700000060.5, "2"]]}
+			]
+		}
+	}`
+	var response PromResponse
+	require.NoError(t, json.Unmarshal([]byte(raw), &response))
+
+	frames, err := PromResponseToFrames(&response, "A")
+	require.NoError(t, err)
+	require.Len(t, frames, 2)
+
+	// Series are ordered by labels, like LongToMultiFrame.
+	first := frames[0]
+	require.Equal(t, "A", first.RefID)
+	require.Len(t, first.Fields, 2)
+	require.Equal(t, data.FieldTypeTime, first.Fields[0].Type())
+	require.Equal(t, data.FieldTypeNullableFloat64, first.Fields[1].Type())
+	require.Equal(t, data.Labels{"__name__": "cpu", "host": "a"}, first.Fields[1].Labels)
+	require.Equal(t, time.UnixMilli(1700000060500), first.Fields[0].At(1))
+	require.Equal(t, 1.5, *first.Fields[1].At(0).(*float64))
+
+	// NaN samples become nulls.
+	require.Nil(t, frames[1].Fields[1].At(1))
+}
+
+func TestPromResponseToFrames_Vector(t *testing.T) {
+	raw := `{
+		"status": "success",
+		"warnings": ["partial result"],
+		"data": {
+			"resultType": "vector",
+			"result": [{"metric": {"job": "api"}, "value": [1700000000, "42"]}]
+		}
+	}`
+	var response PromResponse
+	require.NoError(t, json.Unmarshal([]byte(raw), &response))
+
+	frames, err := PromResponseToFrames(&response, "B")
+	require.NoError(t, err)
+	require.Len(t, frames, 1)
+	require.Equal(t, 1, frames[0].Rows())
+	require.Equal(t, 42.0, *frames[0].Fields[1].At(0).(*float64))
+	require.Equal(t, "partial result", frames[0].Meta.Notices[0].Text)
+}
+
+func TestPromResponseToFrames_Scalar(t *testing.T) {
+	response := PromResponse{Data: PromData{ResultType: "scalar", Result: json.RawMessage(`[1700000000, "7"]`)}}
+
+	frames, err := PromResponseToFrames(&response, "A")
+	require.NoError(t, err)
+	require.Len(t, frames, 1)
+	require.Empty(t, frames[0].Fields[1].Labels)
+	require.Equal(t, 7.0, *frames[0].Fields[1].At(0).(*float64))
+}
+
+func TestPromStep(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	step, err := PromStep("", 30*time.Second, start, start.Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 30*time.Second, step)
+
+	step, err = PromStep("5m", 30*time.Second, start, start.Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 5*time.Minute, step)
+
+	step, err = PromStep("15", 0, start, start.Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 15*time.Second, step)
+
+	// A 30-day range at 1s would exceed the points-per-series limit.
+	step, err = PromStep("1s", 0, start, start.Add(30*24*time.Hour))
+	require.NoError(t, err)
+	require.LessOrEqual(t, int64(30*24*time.Hour/step), int64(promMaxPoints))
+
+	_, err = PromStep("soon", 0, start, start.Add(time.Hour))
+	require.Error(t, err)
+}
+
+func TestClient_QueryPromQL(t *testing.T) {
+	var gotPath string
+	var gotForm url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		require.NoError(t, r.ParseForm())
+		gotForm = r.PostForm
+		if r.PostForm.Get("query") == "bad(" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"status":"error","errorType":"bad_data","error":"parse error"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[]}}`))
+	}))
+	defer ts.Close()
+
+	client := NewClient(ClientSettings{PrometheusURL: ts.URL + "/v1/prometheus/api/v1", DefaultDatabase: "metrics"})
+	defer client.Close()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	query := PromQuery{Expr: "rate(cpu[5m])", Start: start, End: start.Add(time.Hour), Step: 15 * time.Second}
+
+	response, err := client.QueryPromQL(context.Background(), query, nil)
+	require.NoError(t, err)
+	require.Equal(t, "matrix", response.Data.ResultType)
+	require.Equal(t, "/v1/prometheus/api/v1/query_range", gotPath)
+	require.Equal(t, "rate(cpu[5m])", gotForm.Get("query"))
+	require.Equal(t, "1704067200", gotForm.Get("start"))
+	require.Equal(t, "1704070800", gotForm.Get("end"))
+	require.Equal(t, "15", gotForm.Get("step"))
+	require.Equal(t, "metrics", gotForm.Get("db"))
+
+	query.Instant = true
+	_, err = client.QueryPromQL(context.Background(), query, nil)
+	require.NoError(t, err)
+	require.Equal(t, "/v1/prometheus/api/v1/query", gotPath)
+	require.Equal(t, "1704070800", gotForm.Get("time"))
+
+	query.Expr = "bad("
+	_, err = client.QueryPromQL(context.Background(), query, nil)
+	require.ErrorContains(t, err, "bad_data: parse error")
+}
@@ -2,6 +2,7 @@ package greptime
 
 import (
 	"encoding/json"
+	"regexp"
 	"strings"
 )
 
@@ -11,31 +12,80 @@ const (
 	QueryTypeLogs       = "logs"
 	QueryTypeTimeSeries = "timeseries"
 	QueryTypeTraces     = "traces"
+	// QueryTypePromQL evaluates Expr through the Prometheus-compatible HTTP API instead of /v1/sql.
+	QueryTypePromQL = "promql"
+	// QueryTypeExplain runs the SQL under EXPLAIN ANALYZE and renders the plan as a node graph.
+	QueryTypeExplain = "explain"
 )
 
 // QueryModel is the subset of GreptimeQuery JSON needed for response formatting.
 type QueryModel struct {
-	RawSQL         string          `json:"rawSql"`
-	EditorType     string          `json:"editorType,omitempty"`
-	QueryType      string          `json:"queryType,omitempty"`
-	Format         json.RawMessage `json:"format,omitempty"`
-	RefID          string          `json:"-"` // set from backend.DataQuery.RefID
-	BuilderOptions *BuilderOptions `json:"builderOptions,omitempty"`
-	Meta           *QueryMeta      `json:"meta,omitempty"`
+	RawSQL         string            `json:"rawSql"`
+	Expr           string            `json:"expr,omitempty"`          // PromQL expression (queryType promql)
+	Step           string            `json:"step,omitempty"`          // PromQL step; defaults to the panel interval
+	Instant        bool              `json:"instant,omitempty"`       // PromQL instant query at the range end
+	Database       string            `json:"database,omitempty"`      // overrides the datasource DefaultDatabase; must be allowed in settings
+	Hints          map[string]string `json:"hints,omitempty"`         // query hints added to, or overriding, the datasource custom settings
+	BypassCache    bool              `json:"bypassCache,omitempty"`   // always query GreptimeDB, skipping the result cache
+	SplitDuration  string            `json:"splitDuration,omitempty"` // e.g. "1d": run SQL over chunks of the time range in parallel
+	ResultMode     string            `json:"resultMode,omitempty"`    // "all" (default) or "last": which outputs of a multi-statement query to return
+	EditorType     string            `json:"editorType,omitempty"`
+	QueryType      string            `json:"queryType,omitempty"`
+	Format         json.RawMessage   `json:"format,omitempty"`
+	RefID          string            `json:"-"` // set from backend.DataQuery.RefID
+	BuilderOptions *BuilderOptions   `json:"builderOptions,omitempty"`
+	Meta           *QueryMeta        `json:"meta,omitempty"`
 }
 
 type QueryMeta struct {
 	BuilderOptions *BuilderOptions `json:"builderOptions,omitempty"`
+	Timezone       string          `json:"timezone,omitempty"` // dashboard timezone attached by the frontend
 }
 
+// BuilderOptions mirrors src/types/queryBuilder.ts QueryBuilderOptions; see
+// GenerateSQL.
 type BuilderOptions struct {
-	QueryType string             `json:"queryType,omitempty"`
-	Columns   []BuilderColumn    `json:"columns,omitempty"`
-	Meta      *BuilderOptionsMeta `json:"meta,omitempty"`
+	Database   string              `json:"database,omitempty"`
+	Table      string              `json:"table,omitempty"`
+	QueryType  string              `json:"queryType,omitempty"`
+	Mode       string              `json:"mode,omitempty"` // "list", "aggregate" or "trend"
+	Columns    []BuilderColumn     `json:"columns,omitempty"`
+	Aggregates []BuilderAggregate  `json:"aggregates,omitempty"`
+	Filters    []BuilderFilter     `json:"filters,omitempty"`
+	GroupBy    []string            `json:"groupBy,omitempty"`
+	OrderBy    []BuilderOrderBy    `json:"orderBy,omitempty"`
+	Limit      any                 `json:"limit,omitempty"` // a number; kept loose so odd values do not fail the whole query
+	Meta       *BuilderOptionsMeta `json:"meta,omitempty"`
 }
 
 type BuilderColumn struct {
+	Name       string `json:"name"`
+	Type       string `json:"type,omitempty"`
+	Alias      string `json:"alias,omitempty"`
+	Hint       string `json:"hint,omitempty"`
+	ColumnName string `json:"columnName,omitempty"`
+}
+
+type BuilderAggregate struct {
+	AggregateType string `json:"aggregateType"` // sum, avg, min, max, count or any
+	Column        string `json:"column"`
+	Alias         string `json:"alias,omitempty"`
+}
+
+type BuilderFilter struct {
+	Key       string `json:"key"`
+	MapKey    string `json:"mapKey,omitempty"`
+	Type      string `json:"type"`
+	Condition string `json:"condition"` // AND or OR
+	Operator  string `json:"operator"`
+	Hint      string `json:"hint,omitempty"`
+	// Value is a bool, number, string or []string depending on Type and Operator.
+	Value any `json:"value,omitempty"`
+}
+
+type BuilderOrderBy struct {
 	Name string `json:"name"`
+	Dir  string `json:"dir"` // ASC or DESC
 	Hint string `json:"hint,omitempty"`
 }
 
@@ -43,6 +93,7 @@ type BuilderOptionsMeta struct {
 	IsTraceIdMode     bool   `json:"isTraceIdMode,omitempty"`
 	TraceId           string `json:"traceId,omitempty"`
 	TraceDurationUnit string `json:"traceDurationUnit,omitempty"`
+	LogMessageLike    string `json:"logMessageLike,omitempty"`
 }
 
 // FormatOptions controls post-processing after ResponseToFrames.
@@ -59,6 +110,10 @@ func ResolveQueryType(model QueryModel) string {
 	if model.RefID == "Trace ID" {
 		return QueryTypeTraces
 	}
+	// EXPLAIN is chosen in the SQL editor and overrides builder options kept in meta.
+	if model.QueryType == QueryTypeExplain {
+		return QueryTypeExplain
+	}
 
 	builderOpts := model.BuilderOptions
 	if strings.EqualFold(model.EditorType, "sql") && model.Meta != nil && model.Meta.BuilderOptions != nil {
@@ -88,3 +143,26 @@ func IsTraceDetailQuery(model QueryModel) bool {
 	}
 	return ResolveQueryType(model) == QueryTypeTraces && builderOpts.Meta.IsTraceIdMode
 }
+
+// tqlPattern matches the leading keywords of a TQL statement, after any
+// leading comments. TQL EVAL (alias EVALUATE) returns time series; TQL EXPLAIN
+// and TQL ANALYZE return query plans.
+var tqlPattern = regexp.MustCompile(`(?is)^(?:\s+|--[^\n]*\n?|/\*.*?\*/)*TQL\s+(EVAL|EVALUATE|EXPLAIN|ANALYZE)\b`)
+
+// TQLCommand returns the upper-cased TQL command (EVAL, EXPLAIN, ANALYZE) of
+// the last statement of sql, or "" when it is not a TQL statement. EVALUATE
+// is reported as EVAL.
+func TQLCommand(sql string) string {
+	if statements := SplitStatements(sql); len(statements) > 1 {
+		sql = statements[len(statements)-1]
+	}
+	m := tqlPattern.FindStringSubmatch(sql)
+	if m == nil {
+		return ""
+	}
+	cmd := strings.ToUpper(m[1])
+	if cmd == "EVALUATE" {
+		return "EVAL"
+	}
+	return cmd
+}
@@ -0,0 +1,25 @@
+package greptime
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTQLCommand(t *testing.T) {
+	tests := map[string]string{
+		"TQL EVAL (0, 10, '5s') up":                    "EVAL",
+		"tql evaluate (0, 10, '5s') up":                "EVAL",
+		"  -- cpu by host\n TQL EVAL (0, 10, '5s') up": "EVAL",
+		"/* panel */ TQL EXPLAIN up":                   "EXPLAIN",
+		"TQL ANALYZE (0, 10, '5s') up":                 "ANALYZE",
+		"SELECT 'TQL EVAL' FROM t":                     "",
+		"TQLX EVAL up":                                 "",
+		"USE metrics; TQL EVAL (0, 10, '5s') up":       "EVAL",
+		"TQL EVAL (0, 10, '5s') up; SELECT 1":          "",
+		"":                                             "",
+	}
+	for sql, want := range tests {
+		require.Equal(t, want, TQLCommand(sql), sql)
+	}
+}
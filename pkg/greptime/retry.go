@@ -0,0 +1,136 @@
+package greptime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"time"
+)
+
+// RetryPolicy controls how read-only statements are retried after transient
+// failures: transport errors (connection resets, refused dials) and HTTP
+// statuses listed in RetryableStatusCodes. Zero fields take DefaultRetryPolicy
+// values; MaxAttempts of 1 or less than zero disables retries.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of tries, including the first one.
+	MaxAttempts int
+	// InitialBackoff is the base delay before the first retry; it doubles per retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between attempts.
+	MaxBackoff           time.Duration
+	RetryableStatusCodes []int
+}
+
+// DefaultRetryPolicy retries twice on gateway errors and frontend restarts.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 200 * time.Millisecond,
+	MaxBackoff:     2 * time.Second,
+	RetryableStatusCodes: []int{
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	},
+}
+
+// withDefaults fills unset fields from DefaultRetryPolicy.
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if p.MaxAttempts < 1 {
+		p.MaxAttempts = 1
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DefaultRetryPolicy.InitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultRetryPolicy.MaxBackoff
+	}
+	if p.MaxBackoff < p.InitialBackoff {
+		p.MaxBackoff = p.InitialBackoff
+	}
+	if p.RetryableStatusCodes == nil {
+		p.RetryableStatusCodes = DefaultRetryPolicy.RetryableStatusCodes
+	}
+	return p
+}
+
+// backoff returns the delay after the given failed attempt (1-based):
+// exponential growth capped at MaxBackoff, with equal jitter so that panels
+// refreshing together do not retry in lockstep.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, p.MaxBackoff)
+	half := d / 2
+	return half + rand.N(half+1)
+}
+
+// retryable reports whether err is a transient failure worth another attempt.
+func (p RetryPolicy) retryable(err error) bool {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return slices.Contains(p.RetryableStatusCodes, statusErr.StatusCode)
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) && !urlErr.Timeout()
+}
+
+// httpStatusError is a non-2xx /v1/sql response.
+type httpStatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("greptime http %d: %s", e.StatusCode, e.Message)
+}
+
+// readOnlyPattern matches statements that are safe to send twice, after any
+// leading comments (including the query tag). EXPLAIN is checked apart.
+var readOnlyPattern = regexp.MustCompile(`(?is)^(?:\s+|--[^\n]*\n?|/\*.*?\*/|\()*(SELECT|WITH|SHOW|DESC|DESCRIBE|TQL|VALUES)\b`)
+
+// IsReadOnlyStatement reports whether sql only reads data. TQL ANALYZE
+// executes the query but still does not write. EXPLAIN reads only when it
+// explains a query (SELECT, WITH, VALUES or TQL): EXPLAIN ANALYZE runs the
+// statement, so EXPLAIN ANALYZE INSERT writes. Leading session statements
+// (SET, USE) are allowed before the last statement, which must read.
+func IsReadOnlyStatement(sql string) bool {
+	statements := SplitStatements(sql)
+	if len(statements) == 0 {
+		return false
+	}
+	for _, statement := range statements[:len(statements)-1] {
+		if !IsSessionStatement(statement) && !isReadOnly(statement) {
+			return false
+		}
+	}
+	return isReadOnly(statements[len(statements)-1])
+}
+
+func isReadOnly(statement string) bool {
+	if explained, ok := explainedStatement(statement); ok {
+		return explainablePattern.MatchString(explained)
+	}
+	return readOnlyPattern.MatchString(statement)
+}
+
+// sleepContext waits for d or until ctx is done, reporting whether d elapsed.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,176 @@
+package greptime
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsReadOnlyStatement(t *testing.T) {
+	tests := map[string]bool{
+		"SELECT 1":                                  true,
+		"  select * from t":                         true,
+		"/* grafana_query_id=abc */ SELECT 1":       true,
+		"-- comment\nWITH x AS (SELECT 1) SELECT *": true,
+		"(SELECT 1) UNION (SELECT 2)":               true,
+		"SHOW TABLES":                               true,
+		"DESCRIBE TABLE t":                          true,
+		"EXPLAIN ANALYZE SELECT 1":                  true,
+		"EXPLAIN VERBOSE (SELECT 1)":                true,
+		"EXPLAIN ANALYZE INSERT INTO t VALUES (1)":  false,
+		"/* tag */ EXPLAIN ANALYZE DELETE FROM t":   false,
+		"EXPLAIN DROP TABLE t":                      false,
+		"TQL ANALYZE (0, 10, '5s') up":              true,
+		"TQL EVAL (0, 10, '5s') up":                 true,
+		"SELECT 1;":                                 true,
+		"SELECT 1; DELETE FROM t":                   false,
+		"SET time_zone = 'UTC'; SELECT 1":           true,
+		"USE public; SHOW TABLES":                   true,
+		"SELECT 1; SET time_zone = 'UTC'":           false,
+		"SELECT ';'; DELETE FROM t":                 false,
+		"SELECT 'a;b' -- x;y":                       true,
+		"INSERT INTO t VALUES (1)":                  false,
+		"DELETE FROM t":                             false,
+		"CREATE TABLE t (ts TIMESTAMP TIME INDEX)":  false,
+		"SELECTED": false,
+	}
+	for sql, want := range tests {
+		require.Equal(t, want, IsReadOnlyStatement(sql), sql)
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond}.withDefaults()
+	for i := 0; i < 50; i++ {
+		d := policy.backoff(1)
+		require.GreaterOrEqual(t, d, 50*time.Millisecond)
+		require.LessOrEqual(t, d, 100*time.Millisecond)
+
+		d = policy.backoff(5)
+		require.GreaterOrEqual(t, d, 150*time.Millisecond)
+		require.LessOrEqual(t, d, 300*time.Millisecond)
+	}
+}
+
+func TestRetryPolicy_WithDefaults(t *testing.T) {
+	require.Equal(t, DefaultRetryPolicy, RetryPolicy{}.withDefaults())
+	require.Equal(t, 1, RetryPolicy{MaxAttempts: -1}.withDefaults().MaxAttempts)
+	require.Empty(t, RetryPolicy{RetryableStatusCodes: []int{}}.withDefaults().RetryableStatusCodes)
+}
+
+// flakyServer fails the first failures requests with status (or by dropping
+// the connection when status is 0), then answers with a one-row result.
+func flakyServer(t *testing.T, failures int32, status int) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			if status == 0 {
+				conn, _, err := w.(http.Hijacker).Hijack()
+				require.NoError(t, err)
+				_ = conn.Close()
+				return
+			}
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte("upstream unavailable"))
+			return
+		}
+		_, _ = w.Write([]byte(`{"code":0,"output":[{"records":{"schema":{"column_schemas":[{"name":"v","data_type":"Int64"}]},"rows":[[1]]}}]}`))
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &calls
+}
+
+var fastRetry = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+
+func TestClient_ExecuteSQL_RetriesTransientFailures(t *testing.T) {
+	t.Run("gateway error", func(t *testing.T) {
+		ts, calls := flakyServer(t, 2, http.StatusServiceUnavailable)
+		client := NewClient(ClientSettings{SQLURL: ts.URL, ResponseFormat: ResponseFormatJSON, Retry: fastRetry})
+		defer client.Close()
+
+		response, err := client.ExecuteSQL(context.Background(), "SELECT v FROM t", nil)
+		require.NoError(t, err)
+		require.Equal(t, int32(3), calls.Load())
+		require.Len(t, response.Retries, 2)
+		require.Contains(t, response.Retries[0], "attempt 1 failed: greptime http 503")
+
+		frames, err := ResponseToFrames(response, "A")
+		require.NoError(t, err)
+		require.Len(t, frames[0].Meta.Notices, 2)
+		require.Contains(t, frames[0].Meta.Notices[1].Text, "Query was retried: attempt 2 failed")
+	})
+
+	t.Run("connection reset", func(t *testing.T) {
+		ts, calls := flakyServer(t, 1, 0)
+		client := NewClient(ClientSettings{SQLURL: ts.URL, ResponseFormat: ResponseFormatJSON, Retry: fastRetry})
+		defer client.Close()
+
+		response, err := client.ExecuteSQL(context.Background(), "SELECT v FROM t", nil)
+		require.NoError(t, err)
+		require.Equal(t, int32(2), calls.Load())
+		require.Len(t, response.Retries, 1)
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		ts, calls := flakyServer(t, 10, http.StatusBadGateway)
+		client := NewClient(ClientSettings{SQLURL: ts.URL, Retry: fastRetry})
+		defer client.Close()
+
+		_, err := client.ExecuteSQL(context.Background(), "SELECT v FROM t", nil)
+		require.ErrorContains(t, err, "greptime http 502")
+		require.Equal(t, int32(3), calls.Load())
+	})
+}
+
+func TestClient_ExecuteSQL_DoesNotRetry(t *testing.T) {
+	t.Run("writes", func(t *testing.T) {
+		ts, calls := flakyServer(t, 1, http.StatusServiceUnavailable)
+		client := NewClient(ClientSettings{SQLURL: ts.URL, Retry: fastRetry})
+		defer client.Close()
+
+		_, err := client.ExecuteSQL(context.Background(), "INSERT INTO t VALUES (1)", nil)
+		require.Error(t, err)
+		require.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("non-retryable status", func(t *testing.T) {
+		ts, calls := flakyServer(t, 1, http.StatusInternalServerError)
+		client := NewClient(ClientSettings{SQLURL: ts.URL, Retry: fastRetry})
+		defer client.Close()
+
+		_, err := client.ExecuteSQL(context.Background(), "SELECT v FROM t", nil)
+		require.ErrorContains(t, err, "greptime http 500")
+		require.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		ts, calls := flakyServer(t, 1, http.StatusServiceUnavailable)
+		client := NewClient(ClientSettings{SQLURL: ts.URL, Retry: RetryPolicy{MaxAttempts: 1}})
+		defer client.Close()
+
+		_, err := client.ExecuteSQL(context.Background(), "SELECT v FROM t", nil)
+		require.Error(t, err)
+		require.Equal(t, int32(1), calls.Load())
+	})
+}
+
+func TestClient_ExecuteSQL_RetryRespectsQueryTimeout(t *testing.T) {
+	ts, calls := flakyServer(t, 100, http.StatusServiceUnavailable)
+	client := NewClient(ClientSettings{
+		SQLURL:       ts.URL,
+		QueryTimeout: 100 * time.Millisecond,
+		Retry:        RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Second, MaxBackoff: time.Second},
+	})
+	defer client.Close()
+
+	start := time.Now()
+	_, err := client.ExecuteSQL(context.Background(), "SELECT v FROM t", nil)
+	require.ErrorContains(t, err, "greptime http 503")
+	require.Less(t, time.Since(start), 900*time.Millisecond, "backoff must stop at the query timeout")
+	require.Equal(t, int32(1), calls.Load())
+}
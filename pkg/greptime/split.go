@@ -0,0 +1,387 @@
+package greptime
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// MaxTimeRangeChunks bounds how many chunks SplitTimeRange produces; longer
+// ranges get proportionally larger chunks.
+const MaxTimeRangeChunks = 64
+
+// SplitTimeRange cuts tr into consecutive chunks of size (rounded up to a
+// multiple of step). Boundaries fall on multiples of size since the Unix epoch,
+// like date_bin buckets, so no bucket of width step straddles two chunks.
+// Adjacent chunks share their boundary; see MergeChunkFrames.
+func SplitTimeRange(tr backend.TimeRange, size, step time.Duration) []backend.TimeRange {
+	span := tr.To.Sub(tr.From)
+	if size <= 0 || span <= 0 {
+		return []backend.TimeRange{tr}
+	}
+	size = roundUp(size, step)
+	if minSize := roundUp(span/MaxTimeRangeChunks, size); minSize > size {
+		size = minSize
+	}
+
+	var chunks []backend.TimeRange
+	from := tr.From
+	for from.Before(tr.To) {
+		to := alignDown(from, size).Add(size)
+		if !to.Before(tr.To) {
+			to = tr.To
+		}
+		chunks = append(chunks, backend.TimeRange{From: from, To: to})
+		from = to
+	}
+	return chunks
+}
+
+// CanSplitSQL reports whether running sql over the chunks of a split time
+// range and joining the results gives its result over the whole range. After
+// any SET or USE statements, sql must be a TQL EVAL, which evaluates every
+// step on its own, or a query that groups by a time bucket (date_bin,
+// date_trunc, $__timeInterval) or by the column of its time filter, without a
+// top-level LIMIT, OFFSET or set operation. Aggregates over the whole range,
+// such as count(*), and limited results cannot be joined from chunks.
+func CanSplitSQL(sql string) bool {
+	statements := SplitStatements(sql)
+	if len(statements) == 0 {
+		return false
+	}
+	for _, statement := range statements[:len(statements)-1] {
+		if !IsSessionStatement(statement) {
+			return false
+		}
+	}
+	statement := stripComments(statements[len(statements)-1])
+	if TQLCommand(statement) == "EVAL" {
+		return true
+	}
+
+	top := topLevelSQL(statement)
+	if unsplittablePattern.MatchString(top) {
+		return false
+	}
+	groupBy := groupByPattern.FindStringSubmatch(top)
+	if groupBy == nil {
+		return false
+	}
+	var items []string
+	if m := selectListPattern.FindStringSubmatch(top); m != nil {
+		items = strings.Split(m[1], ",")
+	}
+	timeColumns := timeFilterColumns(statement)
+	isTime := func(expr string) bool {
+		return timeBucketPattern.MatchString(expr) || slices.ContainsFunc(timeColumns, func(column string) bool {
+			return sameIdentifier(expr, column)
+		})
+	}
+
+	for _, key := range strings.Split(groupBy[1], ",") {
+		key = strings.TrimSpace(key)
+		if isTime(key) {
+			return true
+		}
+		if n, err := strconv.Atoi(key); err == nil {
+			if n >= 1 && n <= len(items) {
+				if expr, _ := selectItem(items[n-1]); isTime(expr) {
+					return true
+				}
+			}
+			continue
+		}
+		for _, item := range items {
+			if expr, alias := selectItem(item); alias != "" && sameIdentifier(alias, key) && isTime(expr) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var (
+	// unsplittablePattern matches top-level clauses whose result depends on
+	// all rows of the range.
+	unsplittablePattern = regexp.MustCompile(`(?i)\b(LIMIT|OFFSET|FETCH|UNION|INTERSECT|EXCEPT)\b`)
+	groupByPattern      = regexp.MustCompile(`(?is)\bGROUP\s+BY\b(.*?)(?:\bHAVING\b|\bORDER\s+BY\b|\bWINDOW\b|$)`)
+	selectListPattern   = regexp.MustCompile(`(?is)\bSELECT\s+(?:DISTINCT\s+)?(.*?)\bFROM\b`)
+	selectAliasPattern  = regexp.MustCompile("(?is)^(.+?)\\s+(?:AS\\s+)?(\"[^\"]*\"|`[^`]*`|[A-Za-z_]\\w*)$")
+	timeBucketPattern   = regexp.MustCompile(`(?i)^(date_bin|date_trunc|\$__timeInterval(_ms)?)\s*\(`)
+	timeFilterPattern   = regexp.MustCompile(`\$__(?:timeFilter(?:_ms)?|dateTimeFilter|dt)\(([^)]*)\)`)
+)
+
+// topLevelSQL blanks the string literals, comments and parenthesized parts of
+// statement, keeping the outer parentheses and quoted identifiers, so clauses
+// of the statement itself can be matched apart from those of subqueries or
+// function arguments.
+func topLevelSQL(statement string) string {
+	out := []byte(statement)
+	blank := func(from, to int) {
+		for i := from; i < to; i++ {
+			out[i] = ' '
+		}
+	}
+	depth := 0
+	for i := 0; i < len(statement); i++ {
+		switch c := statement[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			end := len(statement)
+			if n := strings.IndexByte(statement[i+1:], c); n >= 0 {
+				end = i + n + 2
+			}
+			if c == '\'' || depth > 0 {
+				blank(i, end)
+			}
+			i = end - 1
+		case strings.HasPrefix(statement[i:], "--"):
+			end := len(statement)
+			if n := strings.IndexByte(statement[i:], '\n'); n >= 0 {
+				end = i + n
+			}
+			blank(i, end)
+			i = end - 1
+		case strings.HasPrefix(statement[i:], "/*"):
+			end := len(statement)
+			if n := strings.Index(statement[i+2:], "*/"); n >= 0 {
+				end = i + n + 4
+			}
+			blank(i, end)
+			i = end - 1
+		case c == '(':
+			depth++
+			if depth > 1 {
+				blank(i, i+1)
+			}
+		case c == ')':
+			if depth > 1 {
+				blank(i, i+1)
+			}
+			depth = max(depth-1, 0)
+		case depth > 0:
+			blank(i, i+1)
+		}
+	}
+	return string(out)
+}
+
+// selectItem splits a select list item into its expression and alias.
+func selectItem(item string) (string, string) {
+	item = strings.TrimSpace(item)
+	if m := selectAliasPattern.FindStringSubmatch(item); m != nil {
+		return strings.TrimSpace(m[1]), m[2]
+	}
+	return item, ""
+}
+
+// timeFilterColumns returns the columns statement filters on the time range.
+func timeFilterColumns(statement string) []string {
+	var columns []string
+	for _, m := range timeFilterPattern.FindAllStringSubmatch(statement, -1) {
+		for _, column := range strings.Split(m[1], ",") {
+			if column = strings.TrimSpace(column); column != "" {
+				columns = append(columns, column)
+			}
+		}
+	}
+	return columns
+}
+
+// sameIdentifier compares two possibly quoted or table-qualified identifiers.
+func sameIdentifier(a, b string) bool {
+	unquote := func(s string) string {
+		s = strings.TrimSpace(s)
+		if i := strings.LastIndexByte(s, '.'); i >= 0 {
+			s = s[i+1:]
+		}
+		return strings.Trim(s, "\"`")
+	}
+	a, b = unquote(a), unquote(b)
+	return a != "" && strings.EqualFold(a, b)
+}
+
+func roundUp(d, step time.Duration) time.Duration {
+	if step <= 0 || d%step == 0 {
+		return d
+	}
+	return (d/step + 1) * step
+}
+
+// alignDown returns the last multiple of size since the Unix epoch not after t.
+func alignDown(t time.Time, size time.Duration) time.Time {
+	n := t.UnixNano()
+	rem := n % int64(size)
+	if rem < 0 {
+		rem += int64(size)
+	}
+	return time.Unix(0, n-rem).In(t.Location())
+}
+
+// MergeChunkFrames joins the frames returned for the chunks of a split time
+// range (in chronological order) into one frame per result set. Time filters
+// include both ends, so rows at a chunk's end are dropped from every chunk but
+// the last: the next chunk returns them, or complete buckets for them.
+// Results sorted by descending time are joined newest chunk first.
+func MergeChunkFrames(chunks [][]*data.Frame, ranges []backend.TimeRange) ([]*data.Frame, error) {
+	if len(chunks) == 0 {
+		return nil, nil
+	}
+	if len(chunks) != len(ranges) {
+		return nil, fmt.Errorf("merge chunks: %d results for %d time ranges", len(chunks), len(ranges))
+	}
+
+	order := make([]int, len(chunks))
+	for i := range order {
+		order[i] = i
+	}
+	if descendingChunks(chunks) {
+		for i, j := 0, len(order)-1; i < j; i, j = i+1, j-1 {
+			order[i], order[j] = order[j], order[i]
+		}
+	}
+
+	var count int
+	for _, frames := range chunks {
+		count = max(count, len(frames))
+	}
+	merged := make([]*data.Frame, 0, count)
+	for n := 0; n < count; n++ {
+		var out *data.Frame
+		for _, c := range order {
+			if n >= len(chunks[c]) || chunks[c][n] == nil {
+				continue
+			}
+			frame := chunks[c][n]
+			var end *time.Time
+			if c < len(chunks)-1 {
+				end = &ranges[c].To
+			}
+			if out == nil || (len(out.Fields) == 0 && out.Rows() == 0) {
+				out = emptyCopy(frame)
+			} else if err := sameSchema(out, frame); err != nil {
+				return nil, fmt.Errorf("merge chunks: result %d: %w", n+1, err)
+			}
+			appendChunk(out, frame, end)
+		}
+		if out != nil {
+			merged = append(merged, out)
+		}
+	}
+	return merged, nil
+}
+
+// LimitMergedRows applies rowLimit to a frame merged from time range chunks,
+// each of which may hold rowLimit rows, keeping its first rows. dropped counts
+// the rows the chunks left out already. The row limit warnings of the chunks
+// are replaced by one for the merged frame.
+func LimitMergedRows(frame *data.Frame, rowLimit, dropped int64) {
+	if rows := int64(frame.Rows()); rowLimit > 0 && rows > rowLimit {
+		for _, field := range frame.Fields {
+			for row := field.Len() - 1; row >= int(rowLimit); row-- {
+				field.Delete(row)
+			}
+		}
+		dropped += rows - rowLimit
+	}
+	if frame.Meta != nil {
+		frame.Meta.Notices = slices.DeleteFunc(frame.Meta.Notices, func(n data.Notice) bool {
+			var kept, chunkDropped int64
+			_, err := fmt.Sscanf(n.Text, rowLimitNotice, &kept, &chunkDropped)
+			return err == nil
+		})
+	}
+	appendRowLimitNotice(frame, dropped)
+}
+
+// emptyCopy returns a frame with the fields, name and metadata of frame but
+// no rows.
+func emptyCopy(frame *data.Frame) *data.Frame {
+	out := frame.EmptyCopy()
+	if frame.Meta != nil {
+		meta := *frame.Meta
+		meta.Notices = append([]data.Notice(nil), frame.Meta.Notices...)
+		out.Meta = &meta
+	}
+	return out
+}
+
+func sameSchema(a, b *data.Frame) error {
+	if len(a.Fields) != len(b.Fields) {
+		return fmt.Errorf("%d columns, then %d", len(a.Fields), len(b.Fields))
+	}
+	for i := range a.Fields {
+		if a.Fields[i].Name != b.Fields[i].Name || a.Fields[i].Type() != b.Fields[i].Type() {
+			return fmt.Errorf("column %d is %s %s, then %s %s", i+1,
+				a.Fields[i].Name, a.Fields[i].Type().ItemTypeString(), b.Fields[i].Name, b.Fields[i].Type().ItemTypeString())
+		}
+	}
+	return nil
+}
+
+// appendChunk appends the rows of frame to out, skipping rows at or after
+// end when end is set, and collects notices out does not have yet.
+func appendChunk(out, frame *data.Frame, end *time.Time) {
+	timeIdx := -1
+	if end != nil {
+		timeIdx = timeFieldIndex(frame)
+	}
+	for row := 0; row < frame.Rows(); row++ {
+		if timeIdx >= 0 {
+			if t := timeAt(frame.Fields[timeIdx], row); !t.IsZero() && !t.Before(*end) {
+				continue
+			}
+		}
+		for i, field := range frame.Fields {
+			out.Fields[i].Append(field.At(row))
+		}
+	}
+
+	if frame.Meta == nil {
+		return
+	}
+	if out.Meta == nil {
+		out.Meta = &data.FrameMeta{}
+	}
+	for _, notice := range frame.Meta.Notices {
+		if !slices.ContainsFunc(out.Meta.Notices, func(n data.Notice) bool { return n.Text == notice.Text }) {
+			out.Meta.Notices = append(out.Meta.Notices, notice)
+		}
+	}
+}
+
+// descendingChunks reports whether results are sorted newest first, judged
+// by the first chunk frame whose time column differs between its first and
+// last rows.
+func descendingChunks(chunks [][]*data.Frame) bool {
+	for _, frames := range chunks {
+		for _, frame := range frames {
+			if frame == nil || frame.Rows() < 2 {
+				continue
+			}
+			idx := timeFieldIndex(frame)
+			if idx < 0 {
+				continue
+			}
+			first, last := timeAt(frame.Fields[idx], 0), timeAt(frame.Fields[idx], frame.Rows()-1)
+			if !first.IsZero() && !last.IsZero() && !first.Equal(last) {
+				return first.After(last)
+			}
+		}
+	}
+	return false
+}
+
+func timeFieldIndex(frame *data.Frame) int {
+	for i, field := range frame.Fields {
+		if field.Type() == data.FieldTypeTime || field.Type() == data.FieldTypeNullableTime {
+			return i
+		}
+	}
+	return -1
+}
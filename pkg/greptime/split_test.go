@@ -0,0 +1,150 @@
+package greptime
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+)
+
+func day(d, h int) time.Time {
+	return time.Date(2024, 1, d, h, 0, 0, 0, time.UTC)
+}
+
+func TestSplitTimeRange(t *testing.T) {
+	tr := backend.TimeRange{From: day(1, 5), To: day(3, 12)}
+	require.Equal(t, []backend.TimeRange{
+		{From: day(1, 5), To: day(2, 0)},
+		{From: day(2, 0), To: day(3, 0)},
+		{From: day(3, 0), To: day(3, 12)},
+	}, SplitTimeRange(tr, 24*time.Hour, time.Minute))
+
+	// Chunks grow to a multiple of the bucket width: 5h → 2 × 3h buckets.
+	chunks := SplitTimeRange(backend.TimeRange{From: day(1, 0), To: day(1, 12)}, 5*time.Hour, 3*time.Hour)
+	require.Equal(t, []backend.TimeRange{
+		{From: day(1, 0), To: day(1, 6)},
+		{From: day(1, 6), To: day(1, 12)},
+	}, chunks)
+
+	// A year in hourly chunks is capped.
+	year := backend.TimeRange{From: day(1, 0), To: day(1, 0).AddDate(1, 0, 0)}
+	chunks = SplitTimeRange(year, time.Hour, time.Minute)
+	require.LessOrEqual(t, len(chunks), MaxTimeRangeChunks)
+	require.Equal(t, year.From, chunks[0].From)
+	require.Equal(t, year.To, chunks[len(chunks)-1].To)
+
+	require.Equal(t, []backend.TimeRange{tr}, SplitTimeRange(tr, 0, time.Minute))
+}
+
+func TestCanSplitSQL(t *testing.T) {
+	for sql, want := range map[string]bool{
+		"SELECT date_bin('1h', ts) AS t, host, avg(v) FROM cpu WHERE $__timeFilter(ts) GROUP BY t, host":                   true,
+		"SELECT date_bin('$__interval', ts) as \"time\", count(*) FROM cpu WHERE $__timeFilter(ts) GROUP BY time":          true,
+		"SELECT $__timeInterval(ts) AS t, max(v) FROM cpu WHERE $__timeFilter(ts) GROUP BY 1 ORDER BY 1":                   true,
+		"SELECT host, date_trunc('day', ts), sum(v) FROM cpu WHERE $__timeFilter(ts) GROUP BY host, date_trunc('day', ts)": true,
+		"SELECT \"ts\" AS \"time\", max(v) FROM cpu WHERE $__timeFilter(\"ts\") GROUP BY host, ts":                         true,
+		"SET time_zone = 'UTC'; SELECT date_bin('1h', ts) t, avg(v) FROM cpu WHERE $__timeFilter(ts) GROUP BY t":           true,
+		"TQL EVAL ($__tqlStart, $__tqlEnd, '1m') rate(cpu[5m])":                                                            true,
+
+		"SELECT ts, v FROM cpu WHERE $__timeFilter(ts)":                                                                   false,
+		"SELECT count(*) FROM cpu WHERE $__timeFilter(ts)":                                                                false,
+		"SELECT host, count(*) FROM cpu WHERE $__timeFilter(ts) GROUP BY host":                                            false,
+		"SELECT date_bin('1h', ts) AS t, avg(v) FROM cpu WHERE $__timeFilter(ts) GROUP BY 1 LIMIT 10":                     false,
+		"SELECT date_bin('1h', ts) AS t, avg(v) FROM cpu WHERE $__timeFilter(ts) GROUP BY t OFFSET 5":                     false,
+		"SELECT t, v FROM (SELECT date_bin('1h', ts) AS t, avg(v) AS v FROM cpu GROUP BY t) WHERE $__timeFilter(t)":       false,
+		"SELECT host, max(v) FROM cpu WHERE $__timeFilter(ts) AND host IN (SELECT host FROM h GROUP BY ts) GROUP BY host": false,
+		"DELETE FROM cpu; SELECT date_bin('1h', ts) AS t, avg(v) FROM cpu GROUP BY t":                                     false,
+		"TQL ANALYZE ($__tqlStart, $__tqlEnd, '1m') up":                                                                   false,
+	} {
+		require.Equal(t, want, CanSplitSQL(sql), sql)
+	}
+	// LIMIT in a subquery or string literal does not limit the result.
+	require.True(t, CanSplitSQL("SELECT date_bin('1h', ts) AS t, max(v) FROM cpu WHERE $__timeFilter(ts) AND host IN (SELECT host FROM top LIMIT 3) AND note != 'limit' GROUP BY t"))
+}
+
+func TestLimitMergedRows(t *testing.T) {
+	frame := chunkFrame([]time.Time{day(1, 0), day(1, 12), day(2, 0), day(2, 12)}, []float64{1, 2, 3, 4},
+		"Results have been limited to 2 rows because the SQL row limit was reached; 1 rows were dropped", "other")
+	LimitMergedRows(frame, 3, 2)
+	require.Equal(t, 3, frame.Rows())
+	require.Equal(t, 3.0, frame.Fields[1].At(2))
+	var texts []string
+	for _, notice := range frame.Meta.Notices {
+		texts = append(texts, notice.Text)
+	}
+	require.Equal(t, []string{"other", "Results have been limited to 3 rows because the SQL row limit was reached; 3 rows were dropped"}, texts)
+
+	// Without a limit, only the rows the chunks dropped are reported.
+	frame = chunkFrame([]time.Time{day(1, 0)}, []float64{1})
+	LimitMergedRows(frame, 0, 0)
+	require.Nil(t, frame.Meta)
+}
+
+func chunkFrame(times []time.Time, values []float64, notices ...string) *data.Frame {
+	frame := data.NewFrame("Result 1", data.NewField("ts", nil, times), data.NewField("v", nil, values))
+	for _, text := range notices {
+		frame.AppendNotices(data.Notice{Severity: data.NoticeSeverityWarning, Text: text})
+	}
+	return frame
+}
+
+func TestMergeChunkFrames(t *testing.T) {
+	ranges := []backend.TimeRange{
+		{From: day(1, 0), To: day(2, 0)},
+		{From: day(2, 0), To: day(3, 0)},
+	}
+	chunks := [][]*data.Frame{
+		// The partial bucket at the chunk end is dropped.
+		{chunkFrame([]time.Time{day(1, 0), day(1, 12), day(2, 0)}, []float64{1, 2, 99}, "limited")},
+		{chunkFrame([]time.Time{day(2, 0), day(2, 12), day(3, 0)}, []float64{3, 4, 5}, "limited")},
+	}
+
+	merged, err := MergeChunkFrames(chunks, ranges)
+	require.NoError(t, err)
+	require.Len(t, merged, 1)
+	require.Equal(t, "Result 1", merged[0].Name)
+	require.Equal(t, 5, merged[0].Rows())
+	var values []float64
+	for i := 0; i < merged[0].Rows(); i++ {
+		values = append(values, merged[0].Fields[1].At(i).(float64))
+	}
+	require.Equal(t, []float64{1, 2, 3, 4, 5}, values)
+	require.Len(t, merged[0].Meta.Notices, 1)
+	require.Equal(t, 3, chunks[0][0].Rows(), "chunk frames are left untouched")
+}
+
+func TestMergeChunkFrames_Descending(t *testing.T) {
+	ranges := []backend.TimeRange{
+		{From: day(1, 0), To: day(2, 0)},
+		{From: day(2, 0), To: day(3, 0)},
+	}
+	chunks := [][]*data.Frame{
+		{chunkFrame([]time.Time{day(2, 0), day(1, 12), day(1, 0)}, []float64{99, 2, 1})},
+		{chunkFrame([]time.Time{day(3, 0), day(2, 12), day(2, 0)}, []float64{5, 4, 3})},
+	}
+
+	merged, err := MergeChunkFrames(chunks, ranges)
+	require.NoError(t, err)
+	var values []float64
+	for i := 0; i < merged[0].Rows(); i++ {
+		values = append(values, merged[0].Fields[1].At(i).(float64))
+	}
+	require.Equal(t, []float64{5, 4, 3, 2, 1}, values)
+}
+
+func TestMergeChunkFrames_SchemaMismatch(t *testing.T) {
+	ranges := []backend.TimeRange{
+		{From: day(1, 0), To: day(2, 0)},
+		{From: day(2, 0), To: day(3, 0)},
+	}
+	other := data.NewFrame("Result 1", data.NewField("ts", nil, []time.Time{day(2, 1)}), data.NewField("v", nil, []string{"x"}))
+	_, err := MergeChunkFrames([][]*data.Frame{{chunkFrame([]time.Time{day(1, 1)}, []float64{1})}, {other}}, ranges)
+	require.ErrorContains(t, err, "column 2 is v float64, then v string")
+
+	// An empty chunk without columns does not conflict.
+	merged, err := MergeChunkFrames([][]*data.Frame{{data.NewFrame("Result 1")}, {other}}, ranges)
+	require.NoError(t, err)
+	require.Equal(t, 1, merged[0].Rows())
+}
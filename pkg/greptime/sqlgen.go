@@ -0,0 +1,652 @@
+package greptime
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Builder modes mirrored from src/types/queryBuilder.ts BuilderMode.
+const (
+	builderModeAggregate = "aggregate"
+	builderModeTrend     = "trend"
+)
+
+// Column hints used only by the SQL generator; see traces.go for the others.
+const (
+	hintLogLevel   = "log_level"
+	hintLogMessage = "log_message"
+	hintLogLabels  = "log_labels"
+)
+
+// Filter operators mirrored from src/types/queryBuilder.ts FilterOperator.
+const (
+	filterIsAnything                    = "IS ANYTHING"
+	filterIsEmpty                       = "IS EMPTY"
+	filterIsNotEmpty                    = "IS NOT EMPTY"
+	filterIsNull                        = "IS NULL"
+	filterIsNotNull                     = "IS NOT NULL"
+	filterLike                          = "LIKE"
+	filterNotLike                       = "NOT LIKE"
+	filterMatchesTerm                   = "@@"
+	filterNotMatchesTerm                = "NOT @@"
+	filterMatchesTermCaseInsensitive    = "CI @@"
+	filterNotMatchesTermCaseInsensitive = "NOT CI @@"
+	filterIn                            = "IN"
+	filterNotIn                         = "NOT IN"
+	filterWithinTimeRange               = "WITH IN DASHBOARD TIME RANGE"
+	filterOutsideTimeRange              = "OUTSIDE DASHBOARD TIME RANGE"
+)
+
+// logColumnAliases are the aliases the Logs panel expects for hinted columns.
+var logColumnAliases = map[string]string{
+	hintTime:       "timestamp",
+	hintLogMessage: "body",
+	hintLogLevel:   "level",
+	hintLogLabels:  "labels",
+	hintTraceID:    "trace_id",
+}
+
+// GenerateSQL builds the SQL of a query builder query, so queries saved
+// without rawSql (alert rules, public dashboards, recorded queries) still run.
+// It is a port of src/data/sqlGenerator.ts generateSql and must produce the
+// same SQL; testdata/sqlgen.golden.json is checked against both. It returns
+// "" for query types the builder does not generate.
+func GenerateSQL(opts *BuilderOptions) string {
+	if opts == nil {
+		return ""
+	}
+	// Generators may rewrite column names and aliases.
+	options := *opts
+	options.Columns = append([]BuilderColumn(nil), opts.Columns...)
+	options.OrderBy = append([]BuilderOrderBy(nil), opts.OrderBy...)
+
+	traceIDMode := options.Meta != nil && options.Meta.IsTraceIdMode && options.Meta.TraceId != ""
+	switch {
+	case options.QueryType == QueryTypeTraces && traceIDMode:
+		return generateTraceIDQuery(&options)
+	case options.QueryType == QueryTypeTraces:
+		return generateTraceSearchQuery(&options)
+	case options.QueryType == QueryTypeLogs:
+		return generateLogsQuery(&options)
+	case options.QueryType == QueryTypeTimeSeries && options.Mode != builderModeTrend:
+		return generateSimpleTimeSeriesQuery(&options)
+	case options.QueryType == QueryTypeTimeSeries:
+		return generateAggregateTimeSeriesQuery(&options, opts)
+	case options.QueryType == QueryTypeTable:
+		return generateTableQuery(&options)
+	default:
+		return ""
+	}
+}
+
+func generateTraceSearchQuery(options *BuilderOptions) string {
+	var selectParts []string
+	aliases := []struct{ hint, alias string }{
+		{hintTraceID, "traceID"},
+		{hintTraceServiceName, "serviceName"},
+		{hintTraceOperation, "operationName"},
+		{hintTime, "startTime"},
+	}
+	for _, a := range aliases {
+		if col := columnByHint(options, a.hint); col != nil {
+			selectParts = append(selectParts, fmt.Sprintf(`%s as "%s"`, escapeIdentifier(col.Name), a.alias))
+		}
+	}
+	if col := columnByHint(options, hintTraceDuration); col != nil {
+		var unit string
+		if options.Meta != nil {
+			unit = options.Meta.TraceDurationUnit
+		}
+		selectParts = append(selectParts, traceDurationSelect(escapeIdentifier(col.Name), unit))
+	}
+
+	parts := []string{"SELECT", strings.Join(selectParts, ", "), "FROM", tableIdentifier(options.Database, options.Table)}
+	if filters := builderFilters(options); filters != "" {
+		parts = append(parts, "WHERE", filters)
+	}
+	return finishQuery(options, parts)
+}
+
+func generateTraceIDQuery(options *BuilderOptions) string {
+	parts := []string{"SELECT *", "FROM", tableIdentifier(options.Database, options.Table), "WHERE"}
+	parts = append(parts, fmt.Sprintf("trace_id = %s", quoteString(options.Meta.TraceId)))
+	if filters := builderFilters(options); filters != "" {
+		parts = append(parts, "AND", filters)
+	}
+	return finishQuery(options, parts)
+}
+
+func generateLogsQuery(options *BuilderOptions) string {
+	var selectParts []string
+	// The Logs panel relies on the order: time first, then the message.
+	var logMessage *BuilderColumn
+	for _, hint := range []string{hintTime, hintLogMessage, hintLogLevel, hintLogLabels, hintTraceID} {
+		col := columnByHint(options, hint)
+		if col == nil || col.Name == "" {
+			continue
+		}
+		col.Alias = logColumnAliases[hint]
+		selectParts = append(selectParts, columnIdentifier(*col))
+		if hint == hintLogMessage {
+			logMessage = col
+		}
+	}
+	for _, col := range options.Columns {
+		if col.Hint == "" && strings.TrimSpace(col.Name) != "" {
+			selectParts = append(selectParts, columnIdentifier(col))
+		}
+	}
+
+	parts := []string{"SELECT", strings.Join(selectParts, ", "), "FROM", tableIdentifier(options.Database, options.Table)}
+	filters := builderFilters(options)
+	messageLike := ""
+	if logMessage != nil && options.Meta != nil {
+		messageLike = options.Meta.LogMessageLike
+	}
+	if filters != "" || messageLike != "" {
+		parts = append(parts, "WHERE")
+	}
+	if filters != "" {
+		parts = append(parts, filters)
+	}
+	if messageLike != "" {
+		if filters != "" {
+			parts = append(parts, "AND")
+		}
+		parts = append(parts, fmt.Sprintf("(%s LIKE '%%%s%%')", escapeIdentifier(logMessage.Name), strings.ReplaceAll(messageLike, "'", "''")))
+	}
+	return finishQuery(options, parts)
+}
+
+func generateSimpleTimeSeriesQuery(options *BuilderOptions) string {
+	var selectParts []string
+	selectNames := map[string]bool{}
+	timeColumn := columnByHint(options, hintTime)
+	if timeColumn != nil && timeColumn.Name != "" {
+		timeColumn.Alias = "time"
+		selectParts = append(selectParts, columnIdentifier(*timeColumn))
+		selectNames[timeColumn.Alias] = true
+	}
+	for _, col := range options.Columns {
+		if col.Hint == hintTime {
+			continue
+		}
+		selectParts = append(selectParts, columnIdentifier(col))
+		selectNames[cmp.Or(col.Alias, col.Name)] = true
+	}
+
+	var aggregateParts []string
+	for _, agg := range options.Aggregates {
+		name := fmt.Sprintf("%s(%s)", agg.AggregateType, agg.Column)
+		aggregateParts = append(aggregateParts, name+aggregateAlias(agg))
+		selectNames[cmp.Or(strings.ReplaceAll(agg.Alias, " ", "_"), name)] = true
+	}
+	for _, g := range options.GroupBy {
+		if !selectNames[g] {
+			selectParts = append(selectParts, g)
+		}
+	}
+	// Aggregates come after the group-by columns.
+	selectParts = append(selectParts, aggregateParts...)
+
+	parts := []string{"SELECT", strings.Join(selectParts, ", "), "FROM", tableIdentifier(options.Database, options.Table)}
+	if filters := builderFilters(options); filters != "" {
+		parts = append(parts, "WHERE", filters)
+	}
+
+	hasAggregates := len(options.Aggregates) > 0
+	if hasAggregates || len(options.GroupBy) > 0 {
+		parts = append(parts, "GROUP BY")
+	}
+	if len(options.GroupBy) > 0 {
+		groupBy := escapeIdentifiersIfNeeded(options.GroupBy)
+		if timeColumn != nil {
+			groupBy += ", " + escapeIdentifierIfNeeded(cmp.Or(timeColumn.ColumnName, timeColumn.Name))
+		}
+		parts = append(parts, groupBy)
+	} else if hasAggregates && timeColumn != nil {
+		parts = append(parts, timeColumn.Name)
+	}
+	return finishQuery(options, parts)
+}
+
+// generateAggregateTimeSeriesQuery buckets the time column with date_bin.
+// original holds the options before the generator rewrote their columns.
+func generateAggregateTimeSeriesQuery(options, original *BuilderOptions) string {
+	var selectParts []string
+	timeColumn := columnByHint(options, hintTime)
+	if timeColumn != nil && timeColumn.Name != "" {
+		rawTimeName := timeColumn.Name
+		timeColumn.Name = fmt.Sprintf("date_bin('$__interval', %s)", rawTimeName)
+		timeColumn.Alias = "time"
+		selectParts = append(selectParts, columnIdentifier(*timeColumn))
+
+		// GreptimeDB only orders by grouped columns, and the raw time column
+		// is grouped as the time bucket.
+		for i, o := range options.OrderBy {
+			if o.Hint == hintTime || o.Name == rawTimeName {
+				options.OrderBy[i] = BuilderOrderBy{Name: "time", Dir: o.Dir, Hint: hintTime}
+			}
+		}
+	}
+
+	var rawTimeName string
+	if col := columnByHint(original, hintTime); col != nil {
+		rawTimeName = col.Name
+	}
+	var groupBy []string
+	for _, g := range options.GroupBy {
+		if g != rawTimeName {
+			groupBy = append(groupBy, g)
+		}
+	}
+	selectParts = append(selectParts, groupBy...)
+	for _, agg := range options.Aggregates {
+		selectParts = append(selectParts, fmt.Sprintf("%s(%s)", agg.AggregateType, escapeIdentifier(agg.Column))+aggregateAlias(agg))
+	}
+
+	parts := []string{"SELECT", strings.Join(selectParts, ", "), "FROM", tableIdentifier(options.Database, options.Table)}
+	if filters := builderFilters(options); filters != "" {
+		parts = append(parts, "WHERE", filters)
+	}
+
+	parts = append(parts, "GROUP BY")
+	if len(groupBy) > 0 {
+		clause := escapeIdentifiersIfNeeded(groupBy)
+		if timeColumn != nil {
+			clause += ", " + timeColumn.Alias
+		}
+		parts = append(parts, clause)
+	} else if timeColumn != nil {
+		parts = append(parts, timeColumn.Alias)
+	}
+	// A LIMIT applies across all series, so it is only added when set.
+	return finishQuery(options, parts)
+}
+
+func generateTableQuery(options *BuilderOptions) string {
+	aggregateMode := options.Mode == builderModeAggregate
+	var selectParts []string
+	for _, col := range options.Columns {
+		selectParts = append(selectParts, columnIdentifier(col))
+	}
+	if aggregateMode {
+		// Group-by columns are not selected automatically; users pick them.
+		for _, agg := range options.Aggregates {
+			selectParts = append(selectParts, fmt.Sprintf("%s(%s)", agg.AggregateType, escapeIdentifier(agg.Column))+aggregateAlias(agg))
+		}
+	}
+
+	parts := []string{"SELECT", strings.Join(selectParts, ", "), "FROM", tableIdentifier(options.Database, options.Table)}
+	if filters := builderFilters(options); filters != "" {
+		parts = append(parts, "WHERE", filters)
+	}
+	if aggregateMode && len(options.GroupBy) > 0 {
+		parts = append(parts, "GROUP BY", escapeIdentifiersIfNeeded(options.GroupBy))
+	}
+	return finishQuery(options, parts)
+}
+
+// finishQuery appends the ORDER BY and LIMIT clauses and joins parts.
+func finishQuery(options *BuilderOptions, parts []string) string {
+	if orderBy := builderOrderBy(options); orderBy != "" {
+		parts = append(parts, "ORDER BY", orderBy)
+	}
+	if limit := builderLimit(options.Limit); limit != "" {
+		parts = append(parts, limit)
+	}
+	return concatQueryParts(parts)
+}
+
+// columnByHint returns the first column with hint, nil when there is none.
+func columnByHint(options *BuilderOptions, hint string) *BuilderColumn {
+	for i := range options.Columns {
+		if options.Columns[i].Hint == hint {
+			return &options.Columns[i]
+		}
+	}
+	return nil
+}
+
+func aggregateAlias(agg BuilderAggregate) string {
+	if agg.Alias == "" {
+		return ""
+	}
+	return " as " + strings.ReplaceAll(agg.Alias, " ", "_")
+}
+
+// columnIdentifier quotes a selected column, leaving expressions as written,
+// and adds its alias.
+func columnIdentifier(col BuilderColumn) string {
+	if strings.TrimSpace(col.Name) == "" {
+		return ""
+	}
+	name := col.Name
+	if !isExpression(name, "(", ")", `"`) {
+		name = escapeIdentifier(name)
+	}
+	if col.Alias != "" && col.Alias != col.Name && escapeIdentifier(col.Alias) != name {
+		return fmt.Sprintf(`%s as "%s"`, name, col.Alias)
+	}
+	return name
+}
+
+// isExpression reports whether s contains any of markers or an AS alias,
+// i.e. is more than a plain column name.
+func isExpression(s string, markers ...string) bool {
+	for _, m := range markers {
+		if strings.Contains(s, m) {
+			return true
+		}
+	}
+	return strings.Contains(strings.ToLower(s), " as ")
+}
+
+func tableIdentifier(database, table string) string {
+	sep := "."
+	if database == "" || table == "" {
+		sep = ""
+	}
+	return escapeIdentifier(database) + sep + escapeIdentifier(table)
+}
+
+func escapeIdentifier(id string) string {
+	if id == "*" || id == "" {
+		return id
+	}
+	return `"` + id + `"`
+}
+
+var simpleLowerIdentifier = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// escapeIdentifierIfNeeded quotes identifiers that would otherwise lose
+// their case, leaving expressions and simple lower-case names alone.
+func escapeIdentifierIfNeeded(id string) string {
+	if id == "" || isExpression(id, "(", ")", `"`, "[", "]") || simpleLowerIdentifier.MatchString(id) {
+		return id
+	}
+	return escapeIdentifier(id)
+}
+
+func escapeIdentifiersIfNeeded(ids []string) string {
+	escaped := make([]string, len(ids))
+	for i, id := range ids {
+		escaped[i] = escapeIdentifierIfNeeded(id)
+	}
+	return strings.Join(escaped, ", ")
+}
+
+// escapeValue quotes a filter value as a string literal, unless it holds a
+// macro, a function call or is already quoted.
+func escapeValue(value string) string {
+	if strings.ContainsAny(value, "$()") {
+		return value
+	}
+	if len(value) >= 1 && ((value[0] == '\'' && value[len(value)-1] == '\'') || (value[0] == '"' && value[len(value)-1] == '"')) {
+		return value
+	}
+	return quoteString(value)
+}
+
+func quoteString(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// traceDurationSelect converts the duration column to milliseconds, as the
+// Trace panel requires.
+func traceDurationSelect(column, unit string) string {
+	switch unit {
+	case "seconds":
+		return column + ` * 1000 AS "duration"`
+	case "microseconds":
+		return "FLOOR(" + column + `) * 0.001 AS "duration"`
+	case "nanoseconds":
+		return "FLOOR(" + column + ` * 0.000001) AS "duration"`
+	default:
+		return column + ` AS "duration"`
+	}
+}
+
+// concatQueryParts joins the non-empty parts with spaces.
+func concatQueryParts(parts []string) string {
+	var b strings.Builder
+	for i, p := range parts {
+		if p == "" {
+			continue
+		}
+		b.WriteString(p)
+		if i != len(parts)-1 {
+			b.WriteByte(' ')
+		}
+	}
+	return b.String()
+}
+
+func builderOrderBy(options *BuilderOptions) string {
+	var parts []string
+	for _, o := range options.OrderBy {
+		name := o.Name
+		if o.Hint != "" {
+			if col := columnByHint(options, o.Hint); col != nil {
+				name = cmp.Or(col.Alias, col.Name)
+			}
+		}
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		parts = append(parts, escapeIdentifier(name)+" "+o.Dir)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// builderLimit returns the LIMIT clause for a positive limit, else "".
+func builderLimit(limit any) string {
+	var n float64
+	switch v := limit.(type) {
+	case float64:
+		n = v
+	case string:
+		n, _ = strconv.ParseFloat(strings.TrimSpace(v), 64)
+	}
+	if n <= 0 || math.IsNaN(n) {
+		return ""
+	}
+	return "LIMIT " + jsString(n)
+}
+
+// builderFilters returns the WHERE conditions, without the keyword.
+func builderFilters(options *BuilderOptions) string {
+	var built []string
+	for _, filter := range options.Filters {
+		if filter.Operator == filterIsAnything {
+			continue
+		}
+
+		column, typ := filter.Key, filter.Type
+		if filter.Hint != "" {
+			if col := columnByHint(options, filter.Hint); col != nil {
+				column = cmp.Or(col.ColumnName, col.Name)
+				typ = cmp.Or(col.Type, typ)
+			}
+		}
+		if strings.TrimSpace(column) == "" {
+			continue
+		}
+		// Quote plain names to keep their case.
+		if !isExpression(column, "(", ")", `"`, "[", "]") {
+			column = escapeIdentifier(column)
+		}
+		if filter.MapKey != "" {
+			column += "['" + filter.MapKey + "']"
+		}
+
+		op := filter.Operator
+		matchesTerm := op == filterMatchesTerm || op == filterNotMatchesTerm ||
+			op == filterMatchesTermCaseInsensitive || op == filterNotMatchesTermCaseInsensitive
+		caseInsensitive := op == filterMatchesTermCaseInsensitive || op == filterNotMatchesTermCaseInsensitive
+		if caseInsensitive {
+			column = "lower(" + column + ")"
+		}
+
+		var parts []string
+		timeRange := isDateType(typ) && (op == filterWithinTimeRange || op == filterOutsideTimeRange)
+		if !timeRange {
+			parts = append(parts, column)
+		}
+
+		negate := false
+		switch op {
+		case filterIsEmpty, filterIsNotEmpty, filterWithinTimeRange:
+			op = ""
+		case filterNotMatchesTerm, filterNotMatchesTermCaseInsensitive:
+			op, negate = filterMatchesTerm, true
+		case filterMatchesTermCaseInsensitive:
+			op = filterMatchesTerm
+		case filterNotLike:
+			op, negate = filterLike, true
+		case filterOutsideTimeRange:
+			op, negate = "", true
+		}
+		if op != "" {
+			parts = append(parts, op)
+		}
+
+		switch {
+		case filter.Operator == filterIsNull || filter.Operator == filterIsNotNull:
+		case filter.Operator == filterIsEmpty:
+			parts = append(parts, "= ''")
+		case filter.Operator == filterIsNotEmpty:
+			parts = append(parts, "!= ''")
+		case isBooleanType(typ):
+			parts = append(parts, jsString(filter.Value))
+		case isNumberType(typ):
+			parts = append(parts, jsString(valueOr(filter.Value, "0")))
+		case isDateType(typ):
+			switch {
+			case timeRange:
+				parts = append(parts, "$__timeFilter("+column+")")
+			case filter.Value == "GRAFANA_START_TIME":
+				parts = append(parts, "$__fromTime")
+			case filter.Value == "GRAFANA_END_TIME":
+				parts = append(parts, "$__toTime")
+			default:
+				parts = append(parts, escapeValue(jsString(valueOr(filter.Value, "TODAY"))))
+			}
+		case isStringType(typ) && (filter.Operator == filterIn || filter.Operator == filterNotIn):
+			parts = append(parts, "("+multiValue(filter.Value)+")")
+		case isStringType(typ) && (filter.Operator == filterLike || filter.Operator == filterNotLike):
+			parts = append(parts, "'%"+strings.ReplaceAll(jsString(valueOr(filter.Value, "")), "'", "''")+"%'")
+		case isStringType(typ) && matchesTerm:
+			term := jsString(valueOr(filter.Value, ""))
+			if caseInsensitive {
+				term = strings.ToLower(term)
+			}
+			parts = append(parts, escapeValue(term))
+		default:
+			parts = append(parts, escapeValue(jsString(valueOr(filter.Value, ""))))
+		}
+
+		if negate {
+			parts = append([]string{"NOT", "("}, parts...)
+			parts = append(parts, ")")
+		}
+		parts = append([]string{"("}, parts...)
+		if len(built) > 0 {
+			parts = append([]string{filter.Condition}, parts...)
+		}
+		parts = append(parts, ")")
+		built = append(built, concatQueryParts(parts))
+	}
+	return concatQueryParts(built)
+}
+
+// multiValue lists the values of an IN filter.
+func multiValue(value any) string {
+	values, ok := value.([]any)
+	if !ok {
+		return jsString(value)
+	}
+	escaped := make([]string, len(values))
+	for i, v := range values {
+		escaped[i] = escapeValue(strings.TrimSpace(jsString(v)))
+	}
+	return strings.Join(escaped, ", ")
+}
+
+// valueOr returns fallback for the values JavaScript treats as false.
+func valueOr(value, fallback any) any {
+	switch v := value.(type) {
+	case nil:
+		return fallback
+	case bool:
+		if !v {
+			return fallback
+		}
+	case float64:
+		if v == 0 || math.IsNaN(v) {
+			return fallback
+		}
+	case string:
+		if v == "" {
+			return fallback
+		}
+	}
+	return value
+}
+
+// jsString formats a JSON value like JavaScript's String(), so filter values
+// render as in the frontend generator.
+func jsString(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "undefined"
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1e21 {
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			if item != nil {
+				items[i] = jsString(item)
+			}
+		}
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// stripTypeModifiers drops Nullable(...) and LowCardinality(...) wrappers.
+func stripTypeModifiers(typ string) string {
+	typ = strings.ToLower(typ)
+	return strings.NewReplacer("(", "", ")", "", "nullable", "", "lowcardinality", "").Replace(typ)
+}
+
+func isBooleanType(typ string) bool {
+	return strings.HasPrefix(strings.ToLower(typ), "boolean")
+}
+
+func isNumberType(typ string) bool {
+	typ = strings.ToLower(typ)
+	return strings.Contains(typ, "int") || strings.Contains(typ, "float") || strings.Contains(typ, "decimal")
+}
+
+func isDateType(typ string) bool {
+	typ = strings.ToLower(typ)
+	return strings.HasPrefix(typ, "date") || strings.HasPrefix(typ, "timestamp") || strings.HasPrefix(typ, "nullable(date")
+}
+
+func isStringType(typ string) bool {
+	typ = stripTypeModifiers(typ)
+	return (typ == "string" || strings.HasPrefix(typ, "fixedstring")) && !(isBooleanType(typ) || isNumberType(typ) || isDateType(typ))
+}
@@ -0,0 +1,57 @@
+package greptime
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// sqlgenCase is a case of testdata/sqlgen.golden.json, which
+// src/data/sqlGenerator.golden.test.ts checks against the TypeScript
+// generator.
+type sqlgenCase struct {
+	Name    string          `json:"name"`
+	Options *BuilderOptions `json:"options"`
+	SQL     string          `json:"sql"`
+}
+
+func TestGenerateSQL_Golden(t *testing.T) {
+	raw, err := os.ReadFile("testdata/sqlgen.golden.json")
+	require.NoError(t, err)
+	var cases []sqlgenCase
+	require.NoError(t, json.Unmarshal(raw, &cases))
+	require.NotEmpty(t, cases)
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			require.Equal(t, c.SQL, GenerateSQL(c.Options))
+		})
+	}
+}
+
+func TestGenerateSQL_LeavesOptionsUntouched(t *testing.T) {
+	opts := &BuilderOptions{
+		Table:     "cpu",
+		QueryType: QueryTypeTimeSeries,
+		Mode:      builderModeTrend,
+		Columns:   []BuilderColumn{{Name: "ts", Hint: hintTime}},
+		OrderBy:   []BuilderOrderBy{{Name: "ts", Dir: "ASC"}},
+	}
+	first := GenerateSQL(opts)
+	require.Equal(t, "ts", opts.Columns[0].Name)
+	require.Empty(t, opts.Columns[0].Alias)
+	require.Equal(t, "ts", opts.OrderBy[0].Name)
+	require.Equal(t, first, GenerateSQL(opts))
+
+	require.Empty(t, GenerateSQL(nil))
+}
+
+func TestBuilderLimit(t *testing.T) {
+	require.Equal(t, "LIMIT 100", builderLimit(float64(100)))
+	require.Equal(t, "LIMIT 100", builderLimit("100"))
+	require.Empty(t, builderLimit(float64(-1)))
+	require.Empty(t, builderLimit(nil))
+	require.Empty(t, builderLimit(true))
+}
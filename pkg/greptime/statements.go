@@ -0,0 +1,147 @@
+package greptime
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const (
+	// ResultModeAll returns every result set of a multi-statement query,
+	// leaving out the affected-row counts of statements such as SET or USE
+	// unless no statement returned rows.
+	ResultModeAll = "all"
+	// ResultModeLast returns the output of the last statement only.
+	ResultModeLast = "last"
+)
+
+// maxStatementNameLength bounds frame names derived from statements.
+const maxStatementNameLength = 60
+
+// SplitStatements splits sql into its statements at semicolons outside
+// string literals, quoted identifiers and comments. Statements keep their
+// comments and are trimmed; empty statements are dropped.
+func SplitStatements(sql string) []string {
+	var statements []string
+	start := 0
+	for i := 0; i < len(sql); i++ {
+		switch c := sql[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			// Doubled quotes escape themselves, which this loop handles as
+			// two adjacent literals.
+			if end := strings.IndexByte(sql[i+1:], c); end >= 0 {
+				i += end + 1
+			} else {
+				i = len(sql)
+			}
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			if end := strings.IndexByte(sql[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(sql)
+			}
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			if end := strings.Index(sql[i+2:], "*/"); end >= 0 {
+				i += end + 3
+			} else {
+				i = len(sql)
+			}
+		case c == ';':
+			statements = appendStatement(statements, sql[start:i])
+			start = i + 1
+		}
+	}
+	if start < len(sql) {
+		statements = appendStatement(statements, sql[start:])
+	}
+	return statements
+}
+
+func appendStatement(statements []string, statement string) []string {
+	statement = strings.TrimSpace(statement)
+	if stripComments(statement) == "" {
+		return statements
+	}
+	return append(statements, statement)
+}
+
+var leadingCommentPattern = regexp.MustCompile(`^(?:\s+|--[^\n]*(?:\n|$)|/\*(?s:.*?)\*/)+`)
+
+// stripComments removes the comments (including the query tag) and
+// whitespace before the first keyword of statement.
+func stripComments(statement string) string {
+	return leadingCommentPattern.ReplaceAllString(statement, "")
+}
+
+var sessionStatementPattern = regexp.MustCompile(`(?i)^(SET|USE)\b`)
+
+// IsSessionStatement reports whether statement only changes the state of the
+// session, such as SET time_zone or USE, so that the statements after it in
+// the same request run with that state.
+func IsSessionStatement(statement string) bool {
+	return sessionStatementPattern.MatchString(stripComments(statement))
+}
+
+// StatementName names the frame of a statement's output: its text without
+// leading comments, on one line and shortened to maxStatementNameLength.
+func StatementName(statement string) string {
+	name := strings.Join(strings.Fields(stripComments(statement)), " ")
+	if runes := []rune(name); len(runes) > maxStatementNameLength {
+		name = string(runes[:maxStatementNameLength-1]) + "…"
+	}
+	return name
+}
+
+// setStatements records which statement produced each output, when each
+// statement of sql, a single one included, produced one output.
+func setStatements(response *Response, sql string) {
+	if response == nil {
+		return
+	}
+	statements := SplitStatements(sql)
+	if len(statements) == 0 || len(statements) != len(response.Output) {
+		return
+	}
+	for i := range response.Output {
+		response.Output[i].Statement = statements[i]
+	}
+}
+
+// SelectOutputs keeps the outputs of response that mode asks for; see
+// ResultModeAll and ResultModeLast. An empty mode means ResultModeAll.
+func SelectOutputs(response *Response, mode string) {
+	if response == nil || len(response.Output) < 2 {
+		return
+	}
+	if mode == ResultModeLast {
+		response.Output = response.Output[len(response.Output)-1:]
+		return
+	}
+
+	results := make([]Output, 0, len(response.Output))
+	for _, output := range response.Output {
+		if !output.IsAffectedRows() {
+			results = append(results, output)
+		}
+	}
+	if len(results) > 0 {
+		response.Output = results
+	}
+}
+
+// affectedRowsFrame reports the rows a statement without a result set changed.
+func affectedRowsFrame(affected int64) *data.Frame {
+	return data.NewFrame("", data.NewField("affected_rows", nil, []int64{affected}))
+}
+
+// outputName names the frame of the i-th output.
+func outputName(output Output, i int) string {
+	if output.Statement != "" {
+		if name := StatementName(output.Statement); name != "" {
+			return name
+		}
+	}
+	return fmt.Sprintf("Result %d", i+1)
+}
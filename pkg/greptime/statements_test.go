@@ -0,0 +1,90 @@
+package greptime
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := map[string][]string{
+		"SELECT 1":                               {"SELECT 1"},
+		"SELECT 1;":                              {"SELECT 1"},
+		" USE logs ;\n SELECT 1 ; ; ":            {"USE logs", "SELECT 1"},
+		"SELECT 'a;b', \"c;d\", `e;f`; SELECT 2": {"SELECT 'a;b', \"c;d\", `e;f`", "SELECT 2"},
+		"SELECT 'it''s; fine'":                   {"SELECT 'it''s; fine'"},
+		"SELECT 1 -- one; two\n; SELECT 2":       {"SELECT 1 -- one; two", "SELECT 2"},
+		"/* a; b */ SELECT 1; /* trailing */":    {"/* a; b */ SELECT 1"},
+		"":                                       nil,
+	}
+	for sql, want := range tests {
+		require.Equal(t, want, SplitStatements(sql), sql)
+	}
+}
+
+func TestStatementName(t *testing.T) {
+	require.Equal(t, "SELECT host, avg(cpu) FROM monitor GROUP BY host",
+		StatementName("/* grafana_query_id=abc */ -- load\nSELECT host, avg(cpu)\n  FROM monitor\n  GROUP BY host"))
+	long := StatementName("SELECT " + strings.Repeat("a", 80) + " FROM t")
+	require.Len(t, []rune(long), maxStatementNameLength)
+	require.Equal(t, "…", string([]rune(long)[maxStatementNameLength-1:]))
+}
+
+func TestIsSessionStatement(t *testing.T) {
+	require.True(t, IsSessionStatement("SET time_zone = 'UTC'"))
+	require.True(t, IsSessionStatement("-- switch\nuse logs"))
+	require.False(t, IsSessionStatement("SELECT 'SET'"))
+	require.False(t, IsSessionStatement("SETTINGS"))
+}
+
+func affectedOutput(n int64) Output {
+	return Output{AffectedRows: &n, Frame: affectedRowsFrame(n)}
+}
+
+func TestSelectOutputs(t *testing.T) {
+	result := Output{Frame: affectedRowsFrame(0), Statement: "SELECT 1"}
+	result.Frame.Name = "result"
+
+	response := &Response{Output: []Output{affectedOutput(0), result, affectedOutput(2)}}
+	SelectOutputs(response, "")
+	require.Equal(t, []Output{result}, response.Output)
+
+	response = &Response{Output: []Output{affectedOutput(0), result, affectedOutput(2)}}
+	SelectOutputs(response, ResultModeLast)
+	require.Equal(t, []Output{affectedOutput(2)}, response.Output)
+
+	// Without any result set the affected-row counts are kept.
+	response = &Response{Output: []Output{affectedOutput(1), affectedOutput(2)}}
+	SelectOutputs(response, ResultModeAll)
+	require.Len(t, response.Output, 2)
+}
+
+func TestClient_ExecuteSQL_MultipleStatements(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"code":0,"output":[{"affectedrows":0},` +
+			`{"records":{"schema":{"column_schemas":[{"name":"v","data_type":"Int64"}]},"rows":[[1],[2]]}},{"affectedrows":4}]}`))
+	}))
+	defer ts.Close()
+	client := NewClient(ClientSettings{SQLURL: ts.URL + "/v1/sql", ResponseFormat: ResponseFormatJSON})
+	defer client.Close()
+
+	response, err := client.ExecuteSQL(context.Background(), "SET time_zone = 'UTC';\nSELECT v FROM t; DELETE FROM t", nil)
+	require.NoError(t, err)
+	require.Len(t, response.Output, 3)
+	require.Equal(t, int64(0), *response.Output[0].AffectedRows)
+	require.Nil(t, response.Output[1].AffectedRows)
+	require.Equal(t, int64(4), *response.Output[2].AffectedRows)
+
+	frames, err := ResponseToFrames(response, "A")
+	require.NoError(t, err)
+	require.Equal(t, "SET time_zone = 'UTC'", frames[0].Name)
+	require.Equal(t, "SELECT v FROM t", frames[1].Name)
+	require.Equal(t, 2, frames[1].Rows())
+	require.Equal(t, "DELETE FROM t", frames[2].Name)
+	require.Equal(t, "affected_rows", frames[2].Fields[0].Name)
+	require.Equal(t, int64(4), frames[2].Fields[0].At(0))
+}
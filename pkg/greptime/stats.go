@@ -0,0 +1,96 @@
+package greptime
+
+import (
+	"encoding/json"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// headerMetrics carries the per-query metrics as a JSON object for non-JSON
+// response formats.
+const headerMetrics = "x-greptime-metrics"
+
+// parseMetricsHeader decodes an x-greptime-metrics value, returning nil when
+// it is absent or malformed.
+func parseMetricsHeader(v string) map[string]float64 {
+	var metrics map[string]any
+	if json.Unmarshal([]byte(v), &metrics) != nil {
+		return nil
+	}
+	return numericMetrics(metrics)
+}
+
+// numericMetrics keeps the numeric values of metrics.
+func numericMetrics(metrics map[string]any) map[string]float64 {
+	out := map[string]float64{}
+	for name, v := range metrics {
+		if f, ok := v.(float64); ok {
+			out[name] = f
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// QueryStats returns the statistics shown in Grafana's Query Inspector for
+// resp: server execution time, latency (the time ExecuteSQL took, including
+// retries), response size, row count and the metrics GreptimeDB reported.
+func QueryStats(resp *Response, latency time.Duration) []data.QueryStat {
+	if resp == nil {
+		return nil
+	}
+	stats := []data.QueryStat{
+		queryStat("Server execution time", "ms", float64(resp.ExecutionTimeMs)),
+		queryStat("End-to-end latency", "ms", float64(latency.Milliseconds())),
+	}
+	if resp.ResponseBytes > 0 {
+		stats = append(stats, queryStat("Response size", "decbytes", float64(resp.ResponseBytes)))
+	}
+
+	var rows int64
+	for _, output := range resp.Output {
+		if output.Frame != nil {
+			rows += int64(output.Frame.Rows())
+		} else {
+			rows += int64(len(output.Records.Rows))
+		}
+	}
+	stats = append(stats, queryStat("Rows", "", float64(rows)))
+
+	names := make([]string, 0, len(resp.Metrics))
+	for name := range resp.Metrics {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		// greptime_exec_read_cost → "Exec read cost"
+		display := strings.ReplaceAll(strings.TrimPrefix(name, "greptime_"), "_", " ")
+		if display != "" {
+			display = strings.ToUpper(display[:1]) + display[1:]
+		}
+		stats = append(stats, queryStat(display, "", resp.Metrics[name]))
+	}
+	return stats
+}
+
+func queryStat(name, unit string, value float64) data.QueryStat {
+	return data.QueryStat{FieldConfig: data.FieldConfig{DisplayName: name, Unit: unit}, Value: value}
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,73 @@
+package greptime
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+)
+
+func statValues(stats []data.QueryStat) map[string]float64 {
+	values := map[string]float64{}
+	for _, stat := range stats {
+		values[stat.DisplayName] = stat.Value
+	}
+	return values
+}
+
+func TestClient_ResponseStats_JSON(t *testing.T) {
+	body := `{"code":0,"execution_time_ms":12,"resp_metrics":{"greptime_exec_read_cost":42,"label":"x"},
+		"output":[{"records":{"schema":{"column_schemas":[{"name":"n","data_type":"Int64"}]},"rows":[[1],[2],[3]]}}]}`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	defer ts.Close()
+	client := NewClient(ClientSettings{SQLURL: ts.URL, ResponseFormat: ResponseFormatJSON})
+	defer client.Close()
+
+	resp, err := client.ExecuteSQL(context.Background(), "SELECT n FROM t", nil)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(body)), resp.ResponseBytes)
+	require.Equal(t, map[string]float64{"greptime_exec_read_cost": 42}, resp.Metrics)
+
+	require.Equal(t, map[string]float64{
+		"Server execution time": 12,
+		"End-to-end latency":    1500,
+		"Response size":         float64(len(body)),
+		"Rows":                  3,
+		"Exec read cost":        42,
+	}, statValues(QueryStats(resp, 1500*time.Millisecond)))
+}
+
+func TestClient_ResponseStats_ArrowHeaders(t *testing.T) {
+	body := writeMetricArrow(t, 5, 5)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/arrow")
+		w.Header().Set(headerExecutionTime, "7")
+		w.Header().Set(headerMetrics, `{"greptime_exec_read_cost":100}`)
+		_, _ = w.Write(body)
+	}))
+	defer ts.Close()
+	client := NewClient(ClientSettings{SQLURL: ts.URL})
+	defer client.Close()
+
+	resp, err := client.ExecuteSQL(context.Background(), "SELECT * FROM cpu", nil)
+	require.NoError(t, err)
+
+	values := statValues(QueryStats(resp, 0))
+	require.Equal(t, float64(7), values["Server execution time"])
+	require.Equal(t, float64(len(body)), values["Response size"])
+	require.Equal(t, float64(5), values["Rows"])
+	require.Equal(t, float64(100), values["Exec read cost"])
+}
+
+func TestQueryStats_NoResultSet(t *testing.T) {
+	stats := QueryStats(&Response{ExecutionTimeMs: 3}, time.Millisecond)
+	require.Equal(t, map[string]float64{"Server execution time": 3, "End-to-end latency": 1, "Rows": 0}, statValues(stats))
+	require.Equal(t, "ms", stats[0].Unit)
+	require.Nil(t, QueryStats(nil, 0))
+}
@@ -0,0 +1,29 @@
+package greptime
+
+import (
+	"context"
+	"strings"
+)
+
+// timezoneHeader sets the session timezone of an HTTP request.
+const timezoneHeader = "x-greptime-timezone"
+
+type timezoneKey struct{}
+
+// WithTimezone returns a context whose queries run with timezone (an IANA
+// name such as "Asia/Shanghai", or an offset such as "+08:00") as the session
+// timezone, which date_bin buckets and DATE conversions follow. An empty
+// timezone keeps the server default.
+func WithTimezone(ctx context.Context, timezone string) context.Context {
+	timezone = strings.TrimSpace(timezone)
+	if timezone == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, timezoneKey{}, timezone)
+}
+
+// queryTimezone returns the WithTimezone timezone of ctx, or "".
+func queryTimezone(ctx context.Context) string {
+	timezone, _ := ctx.Value(timezoneKey{}).(string)
+	return timezone
+}
@@ -361,7 +361,7 @@ func statusCodeAt(field *data.Field, row int) *float64 {
 		return nil
 	}
 	// Already numeric statusCode (0/2).
-	if ms, ok := numericAt(field, row); ok && (field.Type() == data.FieldTypeFloat64 || field.Type() == data.FieldTypeNullableFloat64) {
+	if ms, ok := numericAt(field, row); ok && field.Type().Numeric() {
 		return &ms
 	}
 	s := strings.ToUpper(stringAt(field, row))
@@ -394,6 +394,13 @@ func numericAt(field *data.Field, row int) (float64, bool) {
 		return float64(*t), true
 	case int:
 		return float64(t), true
+	case uint64:
+		return float64(t), true
+	case *uint64:
+		if t == nil {
+			return 0, false
+		}
+		return float64(*t), true
 	case json.Number:
 		f, err := t.Float64()
 		return f, err == nil
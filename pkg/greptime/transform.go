@@ -111,6 +111,9 @@ func toFloat64(value any) (float64, bool) {
 }
 
 // ResponseToFrames converts Greptime /v1/sql JSON to long-format Grafana DataFrames.
+// Outputs already decoded from Arrow are passed through with the same naming:
+// after their statement when known, else "Result N". Affected-row counts
+// become one-row frames with an affected_rows column.
 func ResponseToFrames(response *Response, refID string) ([]*data.Frame, error) {
 	if response == nil {
 		return nil, fmt.Errorf("empty greptime response")
@@ -125,106 +128,196 @@ func ResponseToFrames(response *Response, refID string) ([]*data.Frame, error) {
 
 	frames := make([]*data.Frame, 0, len(response.Output))
 	for i, resultSet := range response.Output {
-		columnSchemas := resultSet.Records.Schema.ColumnSchemas
-		rows := resultSet.Records.Rows
-		numCols := len(columnSchemas)
-		numRows := len(rows)
-
-		frameName := fmt.Sprintf("Result %d", i+1)
-		if numCols == 0 {
-			frame := data.NewFrame(frameName)
+		frameName := outputName(resultSet, i)
+		if resultSet.Frame == nil && resultSet.IsAffectedRows() {
+			resultSet.Frame = affectedRowsFrame(*resultSet.AffectedRows)
+		}
+		if resultSet.Frame != nil {
+			frame := resultSet.Frame
+			frame.Name = frameName
 			frame.RefID = refID
+			appendRowLimitNotice(frame, resultSet.DroppedRows)
+			appendByteLimitNotice(frame, resultSet.ByteLimitReached)
 			frames = append(frames, frame)
 			continue
 		}
 
-		columnValues := make([][]any, numCols)
-		for colIndex := range columnValues {
-			columnValues[colIndex] = make([]any, numRows)
-		}
-
-		for rowIndex, row := range rows {
-			if len(row) != numCols {
-				continue
-			}
-			for colIndex, cell := range row {
-				colSchema := columnSchemas[colIndex]
-				fieldType := mapGreptimeTypeToGrafana(colSchema.DataType)
-				if fieldType == data.FieldTypeTime {
-					if ms, ok := toMilliseconds(cell, colSchema.DataType); ok {
-						columnValues[colIndex][rowIndex] = time.UnixMilli(ms)
-						continue
-					}
-				}
-				columnValues[colIndex][rowIndex] = cell
-			}
+		builder := newFrameBuilder(resultSet.Records.Schema.ColumnSchemas, len(resultSet.Records.Rows))
+		for _, row := range resultSet.Records.Rows {
+			builder.appendRow(row)
 		}
 
-		fields := make([]*data.Field, numCols)
-		for colIndex, colSchema := range columnSchemas {
-			fieldName := colSchema.Name
-			if fieldName == "" {
-				fieldName = fmt.Sprintf("column_%d", colIndex+1)
-			}
-			fieldType := mapGreptimeTypeToGrafana(colSchema.DataType)
-			fields[colIndex] = newField(fieldName, fieldType, columnValues[colIndex])
-			fields[colIndex].SetConfig(&data.FieldConfig{})
-		}
-
-		frame := data.NewFrame(frameName, fields...)
+		frame := builder.frame()
+		frame.Name = frameName
 		frame.RefID = refID
+		appendRowLimitNotice(frame, resultSet.DroppedRows)
 		frames = append(frames, frame)
 	}
 
+	appendRetryNotices(frames, response.Retries)
 	return frames, nil
 }
 
-func newField(name string, fieldType data.FieldType, values []any) *data.Field {
-	switch fieldType {
+// appendRetryNotices records transient failures that were retried, so users
+// can see flakiness even when the query eventually succeeded.
+func appendRetryNotices(frames []*data.Frame, retries []string) {
+	if len(frames) == 0 {
+		return
+	}
+	for _, retry := range retries {
+		frames[0].AppendNotices(data.Notice{
+			Severity: data.NoticeSeverityInfo,
+			Text:     "Query was retried: " + retry,
+		})
+	}
+}
+
+// rowLimitNotice is the text of the warning appendRowLimitNotice adds.
+const rowLimitNotice = "Results have been limited to %d rows because the SQL row limit was reached; %d rows were dropped"
+
+// appendRowLimitNotice warns that a result set was truncated by the row limit.
+func appendRowLimitNotice(frame *data.Frame, dropped int64) {
+	if dropped <= 0 {
+		return
+	}
+	frame.AppendNotices(data.Notice{
+		Severity: data.NoticeSeverityWarning,
+		Text:     fmt.Sprintf(rowLimitNotice, frame.Rows(), dropped),
+	})
+}
+
+// appendByteLimitNotice warns that decoding stopped at the response size limit.
+func appendByteLimitNotice(frame *data.Frame, reached bool) {
+	if !reached {
+		return
+	}
+	frame.AppendNotices(data.Notice{
+		Severity: data.NoticeSeverityWarning,
+		Text:     fmt.Sprintf("Results have been truncated to %d rows because the response exceeded the size limit", frame.Rows()),
+	})
+}
+
+// frameBuilder accumulates /v1/sql JSON rows into typed columns.
+// JSON numbers are float64, so numeric columns become float64 fields and times
+// are truncated to milliseconds; the Arrow format keeps int64, uint64 and full
+// timestamp precision instead (see arrowRecordsToFrame).
+// It backs both ResponseToFrames and the streaming decoder so they produce identical frames.
+type frameBuilder struct {
+	columns []*columnBuilder
+}
+
+func newFrameBuilder(columnSchemas []ColumnSchema, capacity int) *frameBuilder {
+	columns := make([]*columnBuilder, len(columnSchemas))
+	for colIndex, colSchema := range columnSchemas {
+		columns[colIndex] = newColumnBuilder(colIndex, colSchema, capacity)
+	}
+	return &frameBuilder{columns: columns}
+}
+
+// appendRow adds one JSON row. Rows whose width does not match the schema
+// become an empty row rather than shifting values into the wrong columns.
+func (b *frameBuilder) appendRow(row []any) {
+	if len(row) != len(b.columns) {
+		for _, col := range b.columns {
+			col.append(nil)
+		}
+		return
+	}
+	for colIndex, cell := range row {
+		b.columns[colIndex].append(cell)
+	}
+}
+
+func (b *frameBuilder) frame() *data.Frame {
+	if len(b.columns) == 0 {
+		return data.NewFrame("")
+	}
+	fields := make([]*data.Field, len(b.columns))
+	for colIndex, col := range b.columns {
+		fields[colIndex] = col.field()
+	}
+	return data.NewFrame("", fields...)
+}
+
+// columnBuilder converts JSON cells of one column into a Grafana field of the
+// type given by mapGreptimeTypeToGrafana.
+type columnBuilder struct {
+	name      string
+	dataType  string
+	fieldType data.FieldType
+
+	times   []time.Time
+	floats  []*float64
+	bools   []*bool
+	strings []*string
+}
+
+func newColumnBuilder(colIndex int, colSchema ColumnSchema, capacity int) *columnBuilder {
+	name := colSchema.Name
+	if name == "" {
+		name = fmt.Sprintf("column_%d", colIndex+1)
+	}
+	b := &columnBuilder{
+		name:      name,
+		dataType:  colSchema.DataType,
+		fieldType: mapGreptimeTypeToGrafana(colSchema.DataType),
+	}
+	switch b.fieldType {
 	case data.FieldTypeTime:
-		times := make([]time.Time, len(values))
-		for i, v := range values {
-			if t, ok := v.(time.Time); ok {
-				times[i] = t
-			}
+		b.times = make([]time.Time, 0, capacity)
+	case data.FieldTypeFloat64:
+		b.floats = make([]*float64, 0, capacity)
+	case data.FieldTypeBool:
+		b.bools = make([]*bool, 0, capacity)
+	default:
+		b.strings = make([]*string, 0, capacity)
+	}
+	return b
+}
+
+func (b *columnBuilder) append(cell any) {
+	switch b.fieldType {
+	case data.FieldTypeTime:
+		var t time.Time
+		if v, ok := cell.(time.Time); ok {
+			// Decoded by a driver (e.g. Postgres); keep the precision of JSON cells.
+			t = time.UnixMilli(v.UnixMilli())
+		} else if ms, ok := toMilliseconds(cell, b.dataType); ok {
+			t = time.UnixMilli(ms)
 		}
-		return data.NewField(name, nil, times)
+		b.times = append(b.times, t)
 	case data.FieldTypeFloat64:
-		nums := make([]*float64, len(values))
-		for i, v := range values {
-			if v == nil {
-				continue
-			}
-			if f, ok := toFloat64(v); ok {
-				nums[i] = &f
-			}
+		var num *float64
+		if f, ok := toFloat64(cell); ok {
+			num = &f
 		}
-		return data.NewField(name, nil, nums)
+		b.floats = append(b.floats, num)
 	case data.FieldTypeBool:
-		bools := make([]*bool, len(values))
-		for i, v := range values {
-			if v == nil {
-				continue
-			}
-			if b, ok := v.(bool); ok {
-				bools[i] = &b
-			}
+		var val *bool
+		if v, ok := cell.(bool); ok {
+			val = &v
 		}
-		return data.NewField(name, nil, bools)
-	case data.FieldTypeString:
-		strs := make([]*string, len(values))
-		for i, v := range values {
-			strs[i] = stringifyCell(v)
-		}
-		return data.NewField(name, nil, strs)
+		b.bools = append(b.bools, val)
 	default:
-		// Never pass raw []any (may contain nested slices/maps) — Grafana panics on []interface{}.
-		strs := make([]*string, len(values))
-		for i, v := range values {
-			strs[i] = stringifyCell(v)
-		}
-		return data.NewField(name, nil, strs)
+		// Never store raw []any (may contain nested slices/maps) — Grafana panics on []interface{}.
+		b.strings = append(b.strings, stringifyCell(cell))
+	}
+}
+
+func (b *columnBuilder) field() *data.Field {
+	var field *data.Field
+	switch b.fieldType {
+	case data.FieldTypeTime:
+		field = data.NewField(b.name, nil, b.times)
+	case data.FieldTypeFloat64:
+		field = data.NewField(b.name, nil, b.floats)
+	case data.FieldTypeBool:
+		field = data.NewField(b.name, nil, b.bools)
+	default:
+		field = data.NewField(b.name, nil, b.strings)
 	}
+	field.SetConfig(&data.FieldConfig{})
+	return field
 }
 
 func errorFrame(refID, message string) []*data.Frame {
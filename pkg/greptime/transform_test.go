@@ -2,6 +2,7 @@ package greptime
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 	"time"
 
@@ -278,6 +279,31 @@ func TestResponseToFrames_MultiOutput(t *testing.T) {
 	require.Equal(t, "hello", *frames[1].Fields[0].At(0).(*string))
 }
 
+func TestResponseToFrames_SingleStatementName(t *testing.T) {
+	raw := `{
+		"code": 0,
+		"output": [{
+			"records": {
+				"schema": {
+					"column_schemas": [
+						{"name": "value", "data_type": "Float64"}
+					]
+				},
+				"rows": [[1.0]]
+			}
+		}]
+	}`
+
+	var response Response
+	require.NoError(t, json.Unmarshal([]byte(raw), &response))
+	setStatements(&response, "-- cpu usage\nSELECT value\n  FROM cpu;")
+
+	frames, err := ResponseToFrames(&response, "A")
+	require.NoError(t, err)
+	require.Len(t, frames, 1)
+	require.Equal(t, "SELECT value FROM cpu", frames[0].Name)
+}
+
 func TestResponseToFrames_EmptyRows(t *testing.T) {
 	raw := `{
 		"code": 0,
@@ -457,3 +483,32 @@ func TestResponseToFrames_IntTypes(t *testing.T) {
 	require.Equal(t, float64(200), *frame.Fields[1].At(1).(*float64))
 	require.Equal(t, float64(300), *frame.Fields[1].At(2).(*float64))
 }
+
+func TestResponseToFrames_RowLimitNotice(t *testing.T) {
+	raw := `{
+		"code": 0,
+		"output": [{
+			"records": {
+				"schema": {
+					"column_schemas": [
+						{"name": "id", "data_type": "Int64"}
+					]
+				},
+				"rows": [[1], [2], [3], [4], [5]]
+			}
+		}]
+	}`
+
+	response, err := decodeJSONResponse(strings.NewReader(raw), decodeLimits{RowLimit: 2})
+	require.NoError(t, err)
+
+	frames, err := ResponseToFrames(response, "A")
+	require.NoError(t, err)
+	require.Len(t, frames, 1)
+	require.Equal(t, 2, frames[0].Rows())
+	require.NotNil(t, frames[0].Meta)
+	require.Len(t, frames[0].Meta.Notices, 1)
+	require.Equal(t, data.NoticeSeverityWarning, frames[0].Meta.Notices[0].Severity)
+	require.Contains(t, frames[0].Meta.Notices[0].Text, "limited to 2 rows")
+	require.Contains(t, frames[0].Meta.Notices[0].Text, "3 rows were dropped")
+}
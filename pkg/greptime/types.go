@@ -1,15 +1,47 @@
 package greptime
 
+import (
+	"crypto/x509"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
 // Response mirrors GreptimeDB POST /v1/sql JSON (subset used by the plugin).
 type Response struct {
 	Code            int      `json:"code"`
 	ExecutionTimeMs int64    `json:"execution_time_ms,omitempty"`
 	Output          []Output `json:"output,omitempty"`
 	Error           string   `json:"error,omitempty"`
+	// Metrics are the per-query metrics GreptimeDB reports, e.g. rows scanned.
+	Metrics map[string]float64 `json:"-"`
+	// ResponseBytes counts the body bytes received, zero when unknown.
+	ResponseBytes int64 `json:"-"`
+	// PeerCertificates is the server's TLS certificate chain, nil without TLS.
+	PeerCertificates []*x509.Certificate `json:"-"`
+	// Retries describes the failed attempts that preceded this response.
+	Retries []string `json:"-"`
 }
 
 type Output struct {
 	Records Records `json:"records"`
+	// AffectedRows is the row count reported by statements without a result
+	// set, such as INSERT, SET or USE; nil for result sets.
+	AffectedRows *int64 `json:"affectedrows,omitempty"`
+	// Statement is the statement of a multi-statement query that produced
+	// this output, empty when unknown.
+	Statement string `json:"-"`
+	// Frame holds typed columns decoded from an Arrow IPC response; Records is empty then.
+	Frame *data.Frame `json:"-"`
+	// DroppedRows counts rows discarded by the client row limit while decoding.
+	DroppedRows int64 `json:"-"`
+	// ByteLimitReached is set when decoding stopped at the response size limit.
+	ByteLimitReached bool `json:"-"`
+}
+
+// IsAffectedRows reports whether the output is an affected-row count rather
+// than a result set.
+func (o Output) IsAffectedRows() bool {
+	return o.AffectedRows != nil
 }
 
 type Records struct {
@@ -5,6 +5,8 @@ import (
 	"regexp"
 	"strings"
 	"time"
+	// Embedded so timezone names resolve on hosts without a zoneinfo database.
+	_ "time/tzdata"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
@@ -32,9 +34,30 @@ func expandQuotedIntervalMacros(sql string, resolvedInterval string) string {
 	return sql
 }
 
+// LoadTimezone resolves a Grafana timezone name: an IANA name, or empty or
+// "utc" for UTC.
+func LoadTimezone(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.EqualFold(name, "utc") {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, backend.DownstreamError(fmt.Errorf("invalid timezone %q: %w", name, err))
+	}
+	return loc, nil
+}
+
 // InterpolateSQL expands Grafana time macros in raw SQL using Greptime dialect.
 // Same role as sqlds.Interpolate + driver.Macros() in the ClickHouse plugin.
-func InterpolateSQL(rawSQL string, timeRange backend.TimeRange, interval time.Duration, maxDataPoints int64) (string, error) {
+// Dates and timestamps are rendered in timezone (see LoadTimezone).
+func InterpolateSQL(rawSQL string, timeRange backend.TimeRange, interval time.Duration, maxDataPoints int64, timezone string) (string, error) {
+	loc, err := LoadTimezone(timezone)
+	if err != nil {
+		return "", err
+	}
+	timeRange = backend.TimeRange{From: timeRange.From.In(loc), To: timeRange.To.In(loc)}
+
 	resolvedInterval := ResolveGreptimePanelInterval(interval, timeRange, maxDataPoints)
 	// Expand quoted/bare $__interval before sqlutil (see expandQuotedIntervalMacros).
 	rawSQL = expandQuotedIntervalMacros(rawSQL, resolvedInterval)
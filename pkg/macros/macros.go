@@ -3,6 +3,7 @@ package macros
 import (
 	"fmt"
 	"math"
+	"regexp"
 	"strings"
 	"time"
 
@@ -10,16 +11,17 @@ import (
 	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
 )
 
-// timeToDate converts a time.Time to a Greptime date literal.
+// timeToDate converts a time.Time to a Greptime date literal in the location of t.
 // ClickHouse equivalent: toDate('YYYY-MM-DD')
 func timeToDate(t time.Time) string {
-	return fmt.Sprintf("'%s'", t.UTC().Format("2006-01-02"))
+	return fmt.Sprintf("'%s'", t.Format("2006-01-02"))
 }
 
-// timeToDateTime converts a time.Time to a Greptime timestamp literal (ms precision).
+// timeToDateTime converts a time.Time to a Greptime timestamp literal (ms precision)
+// carrying the UTC offset of its location, e.g. 'Z' or '+08:00'.
 // ClickHouse equivalent: toDateTime(unix)
 func timeToDateTime(t time.Time) string {
-	return fmt.Sprintf("'%s'", t.UTC().Format("2006-01-02T15:04:05.000Z"))
+	return fmt.Sprintf("'%s'", t.Format("2006-01-02T15:04:05.000Z07:00"))
 }
 
 // timeToDateTime64 is the millisecond-precision counterpart of timeToDateTime.
@@ -134,6 +136,43 @@ func IntervalSeconds(query *sqlutil.Query, args []string) (string, error) {
 	return fmt.Sprintf("%d", int(seconds)), nil
 }
 
+// TQLStart returns the range start in epoch seconds, rounded down, for TQL EVAL.
+func TQLStart(query *sqlutil.Query, args []string) (string, error) {
+	return fmt.Sprintf("%d", int64(math.Floor(float64(query.TimeRange.From.UnixMilli())/1000))), nil
+}
+
+// TQLEnd returns the range end in epoch seconds, rounded up, for TQL EVAL.
+func TQLEnd(query *sqlutil.Query, args []string) (string, error) {
+	return fmt.Sprintf("%d", int64(math.Ceil(float64(query.TimeRange.To.UnixMilli())/1000))), nil
+}
+
+// TQLStep returns the panel interval as a quoted TQL step literal, e.g. '1m'.
+func TQLStep(query *sqlutil.Query, args []string) (string, error) {
+	return fmt.Sprintf("'%s'", ResolveGreptimePanelInterval(query.Interval, query.TimeRange, query.MaxDataPoints)), nil
+}
+
+// TQLRange expands $__tqlRange to the "start, end, step" arguments of
+// TQL EVAL, so panels can write TQL EVAL ($__tqlRange) <promql>.
+// An optional argument overrides the step: $__tqlRange(30s).
+func TQLRange(query *sqlutil.Query, args []string) (string, error) {
+	if len(args) > 1 {
+		return "", backend.DownstreamError(fmt.Errorf("%w: expected at most 1 argument, received %d", sqlutil.ErrorBadArgumentCount, len(args)))
+	}
+	start, _ := TQLStart(query, nil)
+	end, _ := TQLEnd(query, nil)
+	step, _ := TQLStep(query, nil)
+	if len(args) == 1 && strings.TrimSpace(args[0]) != "" {
+		step = fmt.Sprintf("'%s'", RemoveQuotesInArgs([]string{strings.TrimSpace(args[0])})[0])
+	}
+	return fmt.Sprintf("%s, %s, %s", start, end, step), nil
+}
+
+// Timezone expands $__timezone to the query's timezone as a string literal,
+// e.g. 'Asia/Shanghai', or 'UTC' when none is set (see InterpolateSQL).
+func Timezone(query *sqlutil.Query, args []string) (string, error) {
+	return fmt.Sprintf("'%s'", query.TimeRange.From.Location()), nil
+}
+
 // quoteIdentifier wraps a column name in double quotes unless it is a
 // SQL expression (contains parentheses). Existing quotes are stripped first
 // so both $__timeFilter(col) and $__timeFilter("col") produce "col".
@@ -183,4 +222,20 @@ var Macros = sqlutil.Macros{
 	"timeInterval":    TimeInterval,
 	"timeInterval_ms": TimeIntervalMs,
 	"interval_s":      IntervalSeconds,
+	"tqlRange":        TQLRange,
+	"tqlStart":        TQLStart,
+	"tqlEnd":          TQLEnd,
+	"tqlStep":         TQLStep,
+	"timezone":        Timezone,
+}
+
+// timeRangeMacroPattern matches the macros that restrict rows to the panel
+// time range. $__dateFilter is left out: it only filters whole days.
+var timeRangeMacroPattern = regexp.MustCompile(`\$__(timeFilter(_ms)?|fromTime(_ms)?|toTime(_ms)?|dateTimeFilter|dt|tqlRange|tqlStart|tqlEnd)\b`)
+
+// UsesTimeRange reports whether rawSQL limits its rows to the panel time
+// range through macros, so running it over parts of the range returns the
+// matching parts of its result.
+func UsesTimeRange(rawSQL string) bool {
+	return timeRangeMacroPattern.MatchString(rawSQL)
 }
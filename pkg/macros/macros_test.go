@@ -140,6 +140,25 @@ func TestMacroIntervalSeconds(t *testing.T) {
 	assert.Equal(t, "20", got)
 }
 
+func TestMacroTQLRange(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	query := sqlutil.Query{
+		TimeRange:     backend.TimeRange{From: from, To: from.Add(2 * time.Hour)},
+		MaxDataPoints: 1000,
+	}
+	got, err := TQLRange(&query, []string{})
+	require.NoError(t, err)
+	// Without a panel interval the step is derived from the range and max data points.
+	assert.Equal(t, "1704067200, 1704074400, '7s'", got)
+
+	got, err = TQLRange(&query, []string{"'30s'"})
+	require.NoError(t, err)
+	assert.Equal(t, "1704067200, 1704074400, '30s'", got)
+
+	_, err = TQLRange(&query, []string{"1m", "2m"})
+	assert.ErrorIs(t, err, sqlutil.ErrorBadArgumentCount)
+}
+
 // TestInterpolate mirrors ClickHouse's TestInterpolate: end-to-end macro expansion.
 func TestInterpolate(t *testing.T) {
 	from, _ := time.Parse("2006-01-02T15:04:05.000Z", "2014-11-12T11:45:26.123Z")
@@ -197,6 +216,21 @@ func TestInterpolate(t *testing.T) {
 			input:  "WITH cte AS (SELECT $__interval_s) SELECT * FROM cte",
 			output: "WITH cte AS (SELECT 20) SELECT * FROM cte",
 		},
+		{
+			name:   "tqlRange",
+			input:  "TQL EVAL ($__tqlRange) rate(http_requests_total[5m])",
+			output: "TQL EVAL (1415792726, 1447328727, '20s') rate(http_requests_total[5m])",
+		},
+		{
+			name:   "tqlRange with step",
+			input:  "TQL EVAL ($__tqlRange(1m)) sum by (host) (cpu)",
+			output: "TQL EVAL (1415792726, 1447328727, '1m') sum by (host) (cpu)",
+		},
+		{
+			name:   "tqlStart, tqlEnd and tqlStep",
+			input:  "TQL EVAL ($__tqlStart, $__tqlEnd, $__tqlStep) cpu",
+			output: "TQL EVAL (1415792726, 1447328727, '20s') cpu",
+		},
 		{
 			name:   "preserve dashboard variable",
 			input:  "SELECT * FROM foo WHERE bar = '${table:sqlstring}'",
@@ -206,13 +240,31 @@ func TestInterpolate(t *testing.T) {
 
 	for i, tc := range tests {
 		t.Run(fmt.Sprintf("[%d/%d] %s", i+1, len(tests), tc.name), func(t *testing.T) {
-			got, err := InterpolateSQL(tc.input, tr, interval, 1000)
+			got, err := InterpolateSQL(tc.input, tr, interval, 1000, "")
 			require.NoError(t, err)
 			assert.Equal(t, tc.output, got)
 		})
 	}
 }
 
+func TestInterpolate_Timezone(t *testing.T) {
+	from, _ := time.Parse("2006-01-02T15:04:05.000Z", "2024-03-01T20:00:00.000Z")
+	to, _ := time.Parse("2006-01-02T15:04:05.000Z", "2024-03-02T20:00:00.000Z")
+	tr := backend.TimeRange{From: from, To: to}
+
+	got, err := InterpolateSQL("SELECT $__timezone WHERE $__timeFilter(ts) AND $__dateFilter(d)", tr, time.Minute, 1000, "Asia/Shanghai")
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT 'Asia/Shanghai' WHERE \"ts\" >= '2024-03-02T04:00:00.000+08:00' AND \"ts\" <= '2024-03-03T04:00:00.000+08:00'"+
+		" AND \"d\" >= '2024-03-02' AND \"d\" <= '2024-03-03'", got)
+
+	got, err = InterpolateSQL("SELECT $__timezone, $__fromTime", tr, time.Minute, 1000, "utc")
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT 'UTC', '2024-03-01T20:00:00.000Z'", got)
+
+	_, err = InterpolateSQL("SELECT 1", tr, time.Minute, 1000, "Mars/Olympus")
+	require.ErrorContains(t, err, "invalid timezone")
+}
+
 func TestMacroToTimeFilterMs(t *testing.T) {
 	from, _ := time.Parse("2006-01-02T15:04:05.000Z", "2014-11-12T11:45:26.371Z")
 	to, _ := time.Parse("2006-01-02T15:04:05.000Z", "2015-11-12T11:45:26.371Z")
@@ -286,3 +338,16 @@ func TestQuoteIdentifier(t *testing.T) {
 			"quoteIdentifier(%q)", tc.input)
 	}
 }
+
+func TestUsesTimeRange(t *testing.T) {
+	for sql, want := range map[string]bool{
+		"SELECT * FROM cpu WHERE $__timeFilter(ts)":                    true,
+		"SELECT * FROM cpu WHERE ts >= $__fromTime AND ts < $__toTime": true,
+		"TQL EVAL ($__tqlRange) cpu":                                   true,
+		"SELECT * FROM cpu WHERE $__dateFilter(d)":                     false,
+		"SELECT * FROM cpu WHERE ts > now() - interval '1 hour'":       false,
+		"SELECT date_bin('$__interval', ts) FROM cpu":                  false,
+	} {
+		assert.Equal(t, want, UsesTimeRange(sql), sql)
+	}
+}
@@ -0,0 +1,273 @@
+package plugin
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+
+	"github.com/GreptimeTeam/greptimedb-grafana-datasource/pkg/greptime"
+	"github.com/GreptimeTeam/greptimedb-grafana-datasource/pkg/macros"
+)
+
+// defaultCacheMaxSizeMB is the cache memory cap used when CacheTTL is set
+// without CacheMaxSize.
+const defaultCacheMaxSizeMB = 64
+
+// resultCache keeps recent query results in memory so dashboard refreshes
+// that cannot see new data skip GreptimeDB. Results are stored Arrow-encoded:
+// every hit decodes fresh frames, and the encoded size is what counts against
+// maxBytes. The least recently used entries are evicted first.
+type resultCache struct {
+	ttl      time.Duration
+	maxBytes int64
+	now      func() time.Time
+
+	mu      sync.Mutex
+	bytes   int64
+	entries map[string]*list.Element
+	lru     *list.List // front is the most recently used
+}
+
+// cacheEntry is an encoded query result: the frames ResponseToFrames
+// produced, the statement and affected rows of each output, and the response
+// fields QueryStats reads. Decoding it gives every reader its own frames.
+//
+// Frames are encoded without their notices. The retries, dropped rows and
+// byte limit of the run that produced them are kept beside the frames, so
+// ResponseToFrames adds the notices again for callers sharing that run, while
+// cached copies leave them out (see forCache).
+type cacheEntry struct {
+	key      string
+	frames   [][]byte
+	outputs  []greptime.Output // without frames; nil when frames do not match the outputs
+	response greptime.Response
+	stored   time.Time
+}
+
+// newCacheEntry encodes resp and its frames.
+func newCacheEntry(resp *greptime.Response, frames []*data.Frame) (*cacheEntry, error) {
+	entry := &cacheEntry{response: greptime.Response{
+		Code:            resp.Code,
+		ExecutionTimeMs: resp.ExecutionTimeMs,
+		Metrics:         resp.Metrics,
+		ResponseBytes:   resp.ResponseBytes,
+		Retries:         resp.Retries,
+	}}
+	for _, frame := range frames {
+		stripped := *frame
+		if frame.Meta != nil {
+			meta := *frame.Meta
+			meta.Notices, meta.Stats = nil, nil
+			stripped.Meta = &meta
+		}
+		encoded, err := stripped.MarshalArrow()
+		if err != nil {
+			return nil, err
+		}
+		entry.frames = append(entry.frames, encoded)
+	}
+	if len(resp.Output) == len(frames) {
+		for _, output := range resp.Output {
+			entry.outputs = append(entry.outputs, greptime.Output{
+				AffectedRows:     output.AffectedRows,
+				Statement:        output.Statement,
+				DroppedRows:      output.DroppedRows,
+				ByteLimitReached: output.ByteLimitReached,
+			})
+		}
+	}
+	return entry, nil
+}
+
+// forCache returns a copy of e without the retries, dropped rows and byte
+// limit of its run, whose notices would otherwise be replayed on every hit.
+func (e *cacheEntry) forCache() *cacheEntry {
+	cached := *e
+	cached.response.Retries = nil
+	cached.outputs = slices.Clone(e.outputs)
+	for i := range cached.outputs {
+		cached.outputs[i].DroppedRows, cached.outputs[i].ByteLimitReached = 0, false
+	}
+	return &cached
+}
+
+// decode returns a new response holding copies of the frames as its outputs.
+func (e *cacheEntry) decode() (*greptime.Response, error) {
+	resp := e.response
+	resp.Output = make([]greptime.Output, 0, len(e.frames))
+	for i, encoded := range e.frames {
+		frame, err := data.UnmarshalArrowFrame(encoded)
+		if err != nil {
+			return nil, err
+		}
+		var output greptime.Output
+		if i < len(e.outputs) {
+			output = e.outputs[i]
+		}
+		output.Frame = frame
+		resp.Output = append(resp.Output, output)
+	}
+	return &resp, nil
+}
+
+func (e *cacheEntry) size() int64 {
+	n := int64(len(e.key))
+	for _, frame := range e.frames {
+		n += int64(len(frame))
+	}
+	return n
+}
+
+func newResultCache(ttl time.Duration, maxBytes int64) *resultCache {
+	return &resultCache{
+		ttl:      ttl,
+		maxBytes: maxBytes,
+		now:      time.Now,
+		entries:  map[string]*list.Element{},
+		lru:      list.New(),
+	}
+}
+
+// lookup returns a copy of the response cached under key and its age. A nil
+// cache or empty key never hits.
+func (c *resultCache) lookup(key string) (*greptime.Response, time.Duration, bool) {
+	if c == nil || key == "" {
+		return nil, 0, false
+	}
+	c.mu.Lock()
+	elem, ok := c.entries[key]
+	if !ok {
+		c.mu.Unlock()
+		return nil, 0, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	age := c.now().Sub(entry.stored)
+	if age >= c.ttl {
+		c.remove(elem)
+		c.mu.Unlock()
+		return nil, 0, false
+	}
+	c.lru.MoveToFront(elem)
+	c.mu.Unlock()
+
+	resp, err := entry.decode()
+	if err != nil {
+		return nil, 0, false
+	}
+	return resp, age, true
+}
+
+// store caches a copy of entry under key. Results larger than the whole cache
+// are not stored.
+func (c *resultCache) store(key string, entry *cacheEntry) {
+	stored := *entry
+	stored.key, stored.stored = key, c.now()
+	size := stored.size()
+	if size > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	c.entries[key] = c.lru.PushFront(&stored)
+	c.bytes += size
+	for c.bytes > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove drops elem; c.mu must be held.
+func (c *resultCache) remove(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*cacheEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.size()
+}
+
+// newResultCache builds the cache from CacheTTL (seconds) and CacheMaxSize
+// (megabytes). It returns nil, disabling caching, when CacheTTL is unset or 0.
+func (ds *GreptimeDatasource) newResultCache() (*resultCache, error) {
+	v := strings.TrimSpace(ds.settings.CacheTTL)
+	if v == "" {
+		return nil, nil
+	}
+	ttl, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, backend.DownstreamError(fmt.Errorf("could not parse cacheTTL value: %w", err))
+	}
+	if ttl <= 0 {
+		return nil, nil
+	}
+	maxSize := defaultCacheMaxSizeMB
+	if v := strings.TrimSpace(ds.settings.CacheMaxSize); v != "" {
+		if maxSize, err = strconv.Atoi(v); err != nil || maxSize <= 0 {
+			return nil, backend.DownstreamError(fmt.Errorf("invalid cacheMaxSize value %q: expected a positive number of megabytes", v))
+		}
+	}
+	return newResultCache(time.Duration(ttl)*time.Second, int64(maxSize)<<20), nil
+}
+
+// cacheKey identifies the result of sql for the cache. The SQL is interpolated
+// again over the time range aligned to the query interval, so refreshes within
+// the same interval share a key. It returns "" for queries that must not be
+// cached: bypassed, EXPLAIN or non-read-only ones.
+func (ds *GreptimeDatasource) cacheKey(query backend.DataQuery, model queryModel, sql string, forwarded http.Header) string {
+	if ds.cache == nil || model.BypassCache || greptime.ResolveQueryType(model) == greptime.QueryTypeExplain || !greptime.IsReadOnlyStatement(sql) {
+		return ""
+	}
+
+	step := max(query.Interval, time.Second)
+	aligned := backend.TimeRange{From: query.TimeRange.From.Truncate(step), To: query.TimeRange.To.Truncate(step)}
+	keySQL, err := macros.InterpolateSQL(strings.TrimSpace(model.RawSQL), aligned, query.Interval, query.MaxDataPoints, ds.timezone(model))
+	if err != nil {
+		return ""
+	}
+	return ds.resultKey(keySQL, model, forwarded)
+}
+
+// resultKey hashes everything besides the statement that determines its
+// result: database, timezone, query hints and the forwarded headers.
+func (ds *GreptimeDatasource) resultKey(sql string, model queryModel, forwarded http.Header) string {
+	database := strings.TrimSpace(model.Database)
+	if database == "" {
+		database = ds.defaultDatabase()
+	}
+	parts := []string{sql, database, ds.timezone(model)}
+	for _, name := range slices.Sorted(maps.Keys(model.Hints)) {
+		parts = append(parts, "hint:"+name+"="+model.Hints[name])
+	}
+	// Forwarded headers carry the user's identity; results are never shared
+	// between users the server might authorize differently.
+	for _, name := range slices.Sorted(maps.Keys(forwarded)) {
+		parts = append(parts, fmt.Sprintf("header:%s=%q", name, forwarded[name]))
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// markCached records on every frame that it was served from the cache.
+func markCached(frames []*data.Frame, age time.Duration) {
+	for _, frame := range frames {
+		if frame.Meta == nil {
+			frame.Meta = &data.FrameMeta{}
+		}
+		frame.Meta.Notices = append(frame.Meta.Notices, data.Notice{
+			Severity: data.NoticeSeverityInfo,
+			Text:     fmt.Sprintf("Served from the query cache (%s old)", age.Truncate(time.Second)),
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GreptimeTeam/greptimedb-grafana-datasource/pkg/greptime"
+)
+
+func TestQueryData_Cache(t *testing.T) {
+	var requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		_, _ = w.Write([]byte(`{"code":0,"execution_time_ms":5,"output":[{"records":{"schema":{"column_schemas":[{"name":"ts","data_type":"TimestampMillisecond"},{"name":"v","data_type":"Float64"}]},"rows":[[1704067200000,1.5],[1704067260000,2.5]]}}]}`))
+	}))
+	defer ts.Close()
+
+	ds := newTestDatasource(t, Settings{Host: ts.URL, CacheTTL: "60", AllowedDatabases: []string{"other"}, ResponseFormat: "json"})
+	sql := "SELECT ts, v FROM cpu WHERE $__timeFilter(ts)"
+	run := func(query backend.DataQuery, headers map[string]string) backend.DataResponse {
+		t.Helper()
+		resp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{Queries: []backend.DataQuery{query}, Headers: headers})
+		require.NoError(t, err)
+		dr := resp.Responses[query.RefID]
+		require.NoError(t, dr.Error)
+		return dr
+	}
+
+	first := run(makeDataQuery("A", sql, "sql", "table", nil), nil)
+	require.Equal(t, int32(1), requests.Load())
+
+	// A refresh 20s later falls in the same one-minute interval.
+	later := makeDataQuery("B", sql, "sql", "table", nil)
+	later.TimeRange.From = later.TimeRange.From.Add(20 * time.Second)
+	later.TimeRange.To = later.TimeRange.To.Add(20 * time.Second)
+	second := run(later, nil)
+	require.Equal(t, int32(1), requests.Load())
+
+	require.Len(t, second.Frames, 1)
+	assert.Equal(t, "B", second.Frames[0].RefID)
+	assert.Equal(t, first.Frames[0].Rows(), second.Frames[0].Rows())
+	v, _ := second.Frames[0].Fields[1].ConcreteAt(1)
+	assert.Equal(t, 2.5, v)
+	require.NotEmpty(t, second.Frames[0].Meta.Notices)
+	notice := second.Frames[0].Meta.Notices[len(second.Frames[0].Meta.Notices)-1]
+	assert.Equal(t, data.NoticeSeverityInfo, notice.Severity)
+	assert.Contains(t, notice.Text, "Served from the query cache")
+	assert.Contains(t, second.Frames[0].Meta.ExecutedQueryString, "2024-01-01T00:00:20.000Z", "the executed query keeps the requested range")
+	for _, stat := range second.Frames[0].Meta.Stats {
+		if stat.DisplayName == "Server execution time" {
+			assert.Equal(t, float64(5), stat.Value)
+		}
+	}
+	for _, frame := range first.Frames {
+		for _, n := range frame.Meta.Notices {
+			assert.NotContains(t, n.Text, "query cache")
+		}
+	}
+
+	// Another interval, another user or an explicit bypass queries GreptimeDB.
+	next := makeDataQuery("C", sql, "sql", "table", nil)
+	next.TimeRange.To = next.TimeRange.To.Add(time.Minute)
+	run(next, nil)
+	require.Equal(t, int32(2), requests.Load())
+	run(makeDataQuery("D", sql, "sql", "table", nil), map[string]string{"Authorization": "Bearer other"})
+	require.Equal(t, int32(3), requests.Load())
+	run(makeDataQuery("E", sql, "sql", "table", map[string]any{"bypassCache": true}), nil)
+	require.Equal(t, int32(4), requests.Load())
+	run(makeDataQuery("F", sql, "sql", "table", map[string]any{"database": "other"}), nil)
+	require.Equal(t, int32(5), requests.Load())
+}
+
+// TestQueryData_CacheHitNotices verifies that a cache hit carries only the
+// cache notice, not those of the run that filled the cache.
+func TestQueryData_CacheHitNotices(t *testing.T) {
+	var requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"code":0,"output":[{"records":{"schema":{"column_schemas":[{"name":"v","data_type":"Float64"}]},"rows":[[1],[2],[3]]}}]}`))
+	}))
+	defer ts.Close()
+
+	ds := newTestDatasource(t, Settings{Host: ts.URL, CacheTTL: "60", RowLimit: 2, RetryBackoff: "1", ResponseFormat: "json"})
+	run := func() []data.Notice {
+		t.Helper()
+		resp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+			Queries: []backend.DataQuery{makeDataQuery("A", "SELECT v FROM cpu", "sql", "table", nil)},
+		})
+		require.NoError(t, err)
+		dr := resp.Responses["A"]
+		require.NoError(t, dr.Error)
+		require.Len(t, dr.Frames, 1)
+		require.Equal(t, 2, dr.Frames[0].Rows())
+		return dr.Frames[0].Meta.Notices
+	}
+
+	var texts []string
+	for _, notice := range run() {
+		texts = append(texts, notice.Text)
+	}
+	require.Len(t, texts, 2)
+	assert.Contains(t, texts[0], "rows were dropped")
+	assert.Contains(t, texts[1], "Query was retried")
+
+	notices := run()
+	require.Equal(t, int32(2), requests.Load())
+	require.Len(t, notices, 1)
+	assert.Contains(t, notices[0].Text, "Served from the query cache")
+}
+
+func TestQueryData_CacheDisabled(t *testing.T) {
+	var requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		_, _ = w.Write([]byte(`{"code":0,"output":[]}`))
+	}))
+	defer ts.Close()
+
+	ds := newTestDatasource(t, Settings{Host: ts.URL})
+	require.Nil(t, ds.cache)
+	for range 2 {
+		_, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+			Queries: []backend.DataQuery{makeDataQuery("A", "SELECT 1", "sql", "table", nil)},
+		})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(2), requests.Load())
+}
+
+func TestNewResultCache_Settings(t *testing.T) {
+	ds := &GreptimeDatasource{settings: Settings{CacheTTL: "30"}}
+	cache, err := ds.newResultCache()
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, cache.ttl)
+	assert.Equal(t, int64(defaultCacheMaxSizeMB)<<20, cache.maxBytes)
+
+	ds.settings = Settings{CacheTTL: "0", CacheMaxSize: "10"}
+	cache, err = ds.newResultCache()
+	require.NoError(t, err)
+	assert.Nil(t, cache)
+
+	ds.settings = Settings{CacheTTL: "soon"}
+	_, err = ds.newResultCache()
+	assert.ErrorContains(t, err, "could not parse cacheTTL value")
+
+	ds.settings = Settings{CacheTTL: "30", CacheMaxSize: "-1"}
+	_, err = ds.newResultCache()
+	assert.ErrorContains(t, err, "invalid cacheMaxSize value")
+}
+
+func TestResultCache_ExpiryAndEviction(t *testing.T) {
+	entry := func(resp *greptime.Response, n int) *cacheEntry {
+		e, err := newCacheEntry(resp, []*data.Frame{data.NewFrame("", data.NewField("v", nil, make([]float64, n)))})
+		require.NoError(t, err)
+		return e
+	}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := newResultCache(time.Minute, 1<<20)
+	cache.now = func() time.Time { return now }
+
+	cache.store("a", entry(&greptime.Response{ExecutionTimeMs: 7}, 10))
+	resp, age, ok := cache.lookup("a")
+	require.True(t, ok)
+	assert.Equal(t, time.Duration(0), age)
+	assert.Equal(t, int64(7), resp.ExecutionTimeMs)
+	require.Len(t, resp.Output, 1)
+	assert.Equal(t, 10, resp.Output[0].Frame.Rows())
+
+	now = now.Add(time.Minute)
+	_, _, ok = cache.lookup("a")
+	assert.False(t, ok, "entries expire after the TTL")
+	assert.Zero(t, cache.bytes)
+
+	// Three entries fit in the cap; storing a fourth evicts the least
+	// recently used one.
+	cache.store("a", entry(&greptime.Response{}, 40000))
+	cache.store("b", entry(&greptime.Response{}, 40000))
+	cache.store("c", entry(&greptime.Response{}, 40000))
+	_, _, ok = cache.lookup("a")
+	require.True(t, ok)
+	cache.store("d", entry(&greptime.Response{}, 40000))
+	_, _, ok = cache.lookup("b")
+	assert.False(t, ok)
+	for _, key := range []string{"a", "c", "d"} {
+		_, _, ok = cache.lookup(key)
+		assert.True(t, ok, key)
+	}
+	assert.LessOrEqual(t, cache.bytes, cache.maxBytes)
+
+	// A result larger than the cache is not stored.
+	cache.store("huge", entry(&greptime.Response{}, 200000))
+	_, _, ok = cache.lookup("huge")
+	assert.False(t, ok)
+}
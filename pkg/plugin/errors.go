@@ -3,12 +3,19 @@ package plugin
 import "github.com/pkg/errors"
 
 var (
-	ErrorMessageInvalidJSON       = errors.New("could not parse json")
-	ErrorMessageInvalidHost       = errors.New("invalid server host. Either empty or not set")
-	ErrorMessageInvalidPort       = errors.New("invalid port")
-	ErrorMessageInvalidUserName   = errors.New("username is either empty or not set")
-	ErrorMessageInvalidPassword   = errors.New("password is either empty or not set")
-	ErrorMessageInvalidProtocol   = errors.New("protocol is invalid, use native or http")
-	ErrorInvalidClientCertificate = errors.New("tls: failed to find any PEM data in certificate input")
-	ErrorInvalidCACertificate     = errors.New("failed to parse TLS CA PEM certificate")
+	ErrorMessageInvalidJSON          = errors.New("could not parse json")
+	ErrorMessageInvalidHost          = errors.New("invalid server host. Either empty or not set")
+	ErrorMessageInvalidPort          = errors.New("invalid port")
+	ErrorMessageInvalidUserName      = errors.New("username is either empty or not set")
+	ErrorMessageInvalidPassword      = errors.New("password is either empty or not set")
+	ErrorMessageInvalidProtocol      = errors.New("protocol is invalid, use http, native or postgres")
+	ErrorInvalidClientCertificate    = errors.New("tls: failed to find any PEM data in certificate input")
+	ErrorInvalidCACertificate        = errors.New("failed to parse TLS CA PEM certificate")
+	ErrorPromQLRequiresHTTP          = errors.New("PromQL queries require the http protocol")
+	ErrorMessageInvalidAuthMode      = errors.New("auth mode is invalid, use basic, bearer or oauth")
+	ErrorMessageInvalidBearerToken   = errors.New("bearer token is either empty or not set")
+	ErrorMessageAuthModeUnsupported  = errors.New("bearer and oauth authentication require the http or native protocol")
+	ErrorDatabaseNotAllowed          = errors.New("database is not in the datasource's allowed databases")
+	ErrorMessageInvalidTimezone      = errors.New("timezone is invalid, use an IANA name such as Europe/Berlin")
+	ErrorMessageInvalidCustomSetting = errors.New("custom setting is not a valid query hint")
 )
@@ -7,14 +7,18 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"runtime/debug"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/instancemgmt"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/pkg/errors"
 
 	"github.com/GreptimeTeam/greptimedb-grafana-datasource/pkg/greptime"
 	"github.com/GreptimeTeam/greptimedb-grafana-datasource/pkg/macros"
@@ -23,83 +27,311 @@ import (
 type queryModel = greptime.QueryModel
 
 // GreptimeDatasource implements Grafana backend query handling for GreptimeDB.
+// The client is created once per datasource instance so that pooled
+// connections are shared by every QueryData and CheckHealth call.
 type GreptimeDatasource struct {
 	settings Settings
+	client   greptime.Querier
+	cache    *resultCache // nil when the result cache is disabled
+	inflight inflightGroup
 }
 
+var _ instancemgmt.InstanceDisposer = (*GreptimeDatasource)(nil)
+
 func NewGreptimeDatasource(ctx context.Context, config backend.DataSourceInstanceSettings) (instancemgmt.Instance, error) {
 	settings, err := LoadSettings(ctx, config)
 	if err != nil {
 		return nil, err
 	}
-	return &GreptimeDatasource{settings: settings}, nil
+	return newGreptimeDatasource(settings)
 }
 
-func (ds *GreptimeDatasource) QueryData(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
-	client, err := ds.newClient(ctx)
+func newGreptimeDatasource(settings Settings) (*GreptimeDatasource, error) {
+	ds := &GreptimeDatasource{settings: settings}
+	cache, err := ds.newResultCache()
 	if err != nil {
 		return nil, err
 	}
+	ds.cache = cache
+	client, err := ds.newClient()
+	if err != nil {
+		return nil, err
+	}
+	ds.client = client
+	return ds, nil
+}
 
+// Dispose closes idle connections when Grafana replaces this instance
+// (e.g. after the datasource configuration changed).
+func (ds *GreptimeDatasource) Dispose() {
+	if ds.client != nil {
+		ds.client.Close()
+	}
+}
+
+// QueryData runs the queries of req concurrently, at most MaxOpenConns at a
+// time, so a panel with several refIds waits for the slowest query rather than
+// the sum of all. Each refId gets its own response or error.
+func (ds *GreptimeDatasource) QueryData(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
 	forwarded := req.GetHTTPHeaders()
+	responses := make([]backend.DataResponse, len(req.Queries))
+
+	limit := make(querySlots, ds.maxConcurrentQueries())
+	var wg sync.WaitGroup
+	for i, query := range req.Queries {
+		wg.Add(1)
+		limit <- struct{}{}
+		slot := &querySlot{slots: limit}
+		go func() {
+			defer wg.Done()
+			defer slot.release()
+			defer func() {
+				if r := recover(); r != nil {
+					log.DefaultLogger.Error("greptime query panicked", "refId", query.RefID, "panic", r, "stack", string(debug.Stack()))
+					responses[i] = errorResponse(backend.PluginError(fmt.Errorf("query %s failed unexpectedly: %v", query.RefID, r)))
+				}
+			}()
+			responses[i] = ds.query(context.WithValue(ctx, querySlotKey{}, slot), query, forwarded)
+		}()
+	}
+	wg.Wait()
+
 	response := backend.NewQueryDataResponse()
+	for i, query := range req.Queries {
+		response.Responses[query.RefID] = responses[i]
+	}
+	return response, nil
+}
 
-	for _, query := range req.Queries {
-		var model queryModel
-		if err := json.Unmarshal(query.JSON, &model); err != nil {
-			response.Responses[query.RefID] = backend.DataResponse{Error: backend.DownstreamError(err)}
-			continue
-		}
-		model.RefID = query.RefID
+// query runs a single query of a QueryData request.
+func (ds *GreptimeDatasource) query(ctx context.Context, query backend.DataQuery, forwarded http.Header) backend.DataResponse {
+	var model queryModel
+	if err := json.Unmarshal(query.JSON, &model); err != nil {
+		return errorResponse(backend.DownstreamError(err))
+	}
+	model.RefID = query.RefID
 
-		sql := strings.TrimSpace(model.RawSQL)
-		if sql == "" {
-			response.Responses[query.RefID] = backend.DataResponse{
-				Frames: []*data.Frame{},
-			}
-			continue
+	queryCtx, err := ds.queryContext(ctx, model)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if greptime.ResolveQueryType(model) == greptime.QueryTypePromQL {
+		return ds.queryPromQL(queryCtx, query, model, forwarded)
+	}
+
+	// Alert rules, public dashboards and recorded queries do not run the
+	// frontend, so builder queries may arrive without their generated SQL.
+	if strings.TrimSpace(model.RawSQL) == "" && !strings.EqualFold(model.EditorType, "sql") {
+		model.RawSQL = greptime.GenerateSQL(model.BuilderOptions)
+	}
+	sql := strings.TrimSpace(model.RawSQL)
+	if sql == "" {
+		return backend.DataResponse{
+			Frames: []*data.Frame{},
 		}
+	}
+
+	switch model.ResultMode {
+	case "", greptime.ResultModeAll, greptime.ResultModeLast:
+	default:
+		return errorResponse(backend.DownstreamError(fmt.Errorf("invalid resultMode %q: expected %q or %q",
+			model.ResultMode, greptime.ResultModeAll, greptime.ResultModeLast)))
+	}
+
+	ranges, interval, err := ds.splitRanges(query, model)
+	if err != nil {
+		return errorResponse(err)
+	}
 
-		sql, err = macros.InterpolateSQL(sql, query.TimeRange, query.Interval, query.MaxDataPoints)
+	start := time.Now()
+	var result fetchResult
+	if len(ranges) > 1 {
+		result, err = ds.fetchSplit(queryCtx, query, model, ranges, interval, forwarded)
 		if err != nil {
-			response.Responses[query.RefID] = backend.DataResponse{Error: err}
-			continue
+			return errorResponse(err)
 		}
-
-		greptime.LogExecutedSQL(query.RefID, sql)
-		greptimeResp, err := client.ExecuteSQL(ctx, sql, forwarded)
+	} else {
+		sql, err := macros.InterpolateSQL(sql, query.TimeRange, query.Interval, query.MaxDataPoints, ds.timezone(model))
 		if err != nil {
-			response.Responses[query.RefID] = backend.DataResponse{Error: err}
-			continue
+			return errorResponse(err)
+		}
+		if greptime.ResolveQueryType(model) == greptime.QueryTypeExplain {
+			if sql, err = greptime.ExplainSQL(sql); err != nil {
+				return errorResponse(backend.DownstreamError(err))
+			}
+		}
+		if result, err = ds.fetch(queryCtx, query, model, sql, forwarded); err != nil {
+			return errorResponse(err)
 		}
+		if result.cached {
+			markCached(result.frames, result.cacheAge)
+		}
+	}
+	latency := time.Since(start)
+	frames, sql := result.frames, result.sql
+
+	queryType := greptime.ResolveQueryType(model)
+	if greptime.TQLCommand(sql) == "EVAL" {
+		// TQL EVAL returns greptime_timestamp/greptime_value plus label columns.
+		queryType = greptime.QueryTypeTimeSeries
+	}
 
-		frames, err := greptime.ResponseToFrames(greptimeResp, query.RefID)
+	formatOpts := greptime.FormatOptions{
+		QueryType:      queryType,
+		ContextColumns: ds.settings.LogsContextColumns,
+		TraceDetail:    greptime.IsTraceDetailQuery(model),
+	}
+	if builderOpts := greptime.ResolveBuilderOptions(model); builderOpts != nil {
+		formatOpts.TraceColumns = builderOpts.Columns
+		if builderOpts.Meta != nil {
+			formatOpts.TraceDuration = builderOpts.Meta.TraceDurationUnit
+		}
+	}
+	frames = greptime.FormatFrames(frames, formatOpts)
+	setExecutedQueryString(frames, sql)
+	setQueryStats(frames, append(greptime.QueryStats(result.response, latency), result.stats...))
+
+	return backend.DataResponse{Frames: frames}
+}
+
+// fetchResult is the result of a SQL query, before formatting.
+type fetchResult struct {
+	sql      string
+	response *greptime.Response
+	frames   []*data.Frame
+	cached   bool
+	cacheAge time.Duration
+	stats    []data.QueryStat // added to the QueryStats of response
+}
+
+// fetch returns the result of sql from the result cache, or else from
+// GreptimeDB, caching it when possible.
+func (ds *GreptimeDatasource) fetch(ctx context.Context, query backend.DataQuery, model queryModel, sql string, forwarded http.Header) (fetchResult, error) {
+	result := fetchResult{sql: sql}
+	cacheKey := ds.cacheKey(query, model, sql, forwarded)
+	result.response, result.cacheAge, result.cached = ds.cache.lookup(cacheKey)
+	if !result.cached {
+		var entry *cacheEntry
+		var err error
+		result.response, entry, err = ds.execute(ctx, query.RefID, sql, model, forwarded, cacheKey != "")
 		if err != nil {
-			response.Responses[query.RefID] = backend.DataResponse{Error: backend.DownstreamError(err)}
-			continue
+			return result, err
 		}
+		if cacheKey != "" && entry != nil {
+			ds.cache.store(cacheKey, entry.forCache())
+		}
+	}
+
+	greptime.SelectOutputs(result.response, model.ResultMode)
+	var err error
+	if result.frames, err = greptime.ResponseToFrames(result.response, query.RefID); err != nil {
+		return result, backend.PluginError(err)
+	}
+	return result, nil
+}
+
+// querySlots bounds the queries of one request, and the time range chunks of
+// its split queries, that run at once. Each running query or chunk holds one
+// slot; QueryData puts the slot of each query in its context.
+type querySlots chan struct{}
+
+// querySlot is the slot a query holds in its request's querySlots. Only the
+// first release frees it, so a split query can hand its slot to its chunks
+// before QueryData releases it when the query returns.
+type querySlot struct {
+	slots querySlots
+	once  sync.Once
+}
+
+func (s *querySlot) release() {
+	s.once.Do(func() { <-s.slots })
+}
+
+type querySlotKey struct{}
+
+// maxConcurrentQueries bounds how many queries of one request run at once,
+// matching the connection pool size.
+func (ds *GreptimeDatasource) maxConcurrentQueries() int {
+	if n, err := strconv.Atoi(strings.TrimSpace(ds.settings.MaxOpenConns)); err == nil && n > 0 {
+		return n
+	}
+	return defaultMaxOpenConns
+}
 
-		formatOpts := greptime.FormatOptions{
-			QueryType:      greptime.ResolveQueryType(model),
-			ContextColumns: ds.settings.LogsContextColumns,
-			TraceDetail:    greptime.IsTraceDetailQuery(model),
+// queryContext applies the query's database, timezone and hints to ctx,
+// rejecting databases missing from the settings' allow-list and invalid hints.
+func (ds *GreptimeDatasource) queryContext(ctx context.Context, model queryModel) (context.Context, error) {
+	if database := strings.TrimSpace(model.Database); database != "" {
+		if !ds.settings.isAllowedDatabase(database) {
+			return ctx, backend.DownstreamError(fmt.Errorf("%w: %s", ErrorDatabaseNotAllowed, database))
 		}
-		if builderOpts := greptime.ResolveBuilderOptions(model); builderOpts != nil {
-			formatOpts.TraceColumns = builderOpts.Columns
-			if builderOpts.Meta != nil {
-				formatOpts.TraceDuration = builderOpts.Meta.TraceDurationUnit
-			}
+		ctx = greptime.WithDatabase(ctx, database)
+	}
+	for name, value := range model.Hints {
+		if err := greptime.ValidateHint(name, value); err != nil {
+			return ctx, err
 		}
-		frames = greptime.FormatFrames(frames, formatOpts)
-		setExecutedQueryString(frames, sql)
+	}
+	ctx = greptime.WithHints(ctx, model.Hints)
+	return greptime.WithTimezone(ctx, ds.timezone(model)), nil
+}
 
-		response.Responses[query.RefID] = backend.DataResponse{Frames: frames}
+// timezone returns the query's session timezone: the dashboard timezone sent
+// by the frontend, else the datasource default, else "" for the server default.
+func (ds *GreptimeDatasource) timezone(model queryModel) string {
+	timezone := ds.settings.Timezone
+	if model.Meta != nil && strings.TrimSpace(model.Meta.Timezone) != "" {
+		timezone = strings.TrimSpace(model.Meta.Timezone)
+	}
+	// Grafana names UTC "utc".
+	if strings.EqualFold(timezone, "utc") {
+		return "UTC"
 	}
+	return timezone
+}
 
-	return response, nil
+// queryPromQL runs a PromQL query over the panel's time range and returns
+// labeled multi-frame time series.
+func (ds *GreptimeDatasource) queryPromQL(ctx context.Context, query backend.DataQuery, model queryModel, forwarded http.Header) backend.DataResponse {
+	expr := strings.TrimSpace(model.Expr)
+	if expr == "" {
+		return backend.DataResponse{Frames: []*data.Frame{}}
+	}
+
+	step, err := greptime.PromStep(model.Step, query.Interval, query.TimeRange.From, query.TimeRange.To)
+	if err != nil {
+		return errorResponse(backend.DownstreamError(err))
+	}
+
+	client, ok := ds.client.(*greptime.Client)
+	if !ok {
+		return errorResponse(backend.DownstreamError(ErrorPromQLRequiresHTTP))
+	}
+
+	greptime.LogExecutedPromQL(query.RefID, expr)
+	promResp, err := client.QueryPromQL(ctx, greptime.PromQuery{
+		Expr:    expr,
+		Start:   query.TimeRange.From,
+		End:     query.TimeRange.To,
+		Step:    step,
+		Instant: model.Instant,
+	}, forwarded)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	frames, err := greptime.PromResponseToFrames(promResp, query.RefID)
+	if err != nil {
+		return errorResponse(backend.PluginError(err))
+	}
+	setExecutedQueryString(frames, expr)
+	return backend.DataResponse{Frames: frames}
 }
 
-func setExecutedQueryString(frames []*data.Frame, sql string) {
+// setQueryStats attaches stats to the first frame, so the Query Inspector
+// lists them once per query.
+func setQueryStats(frames []*data.Frame, stats []data.QueryStat) {
 	for _, frame := range frames {
 		if frame == nil {
 			continue
@@ -107,69 +339,241 @@ func setExecutedQueryString(frames []*data.Frame, sql string) {
 		if frame.Meta == nil {
 			frame.Meta = &data.FrameMeta{}
 		}
-		frame.Meta.ExecutedQueryString = sql
+		frame.Meta.Stats = append(frame.Meta.Stats, stats...)
+		return
 	}
 }
 
-func (ds *GreptimeDatasource) CheckHealth(ctx context.Context, req *backend.CheckHealthRequest) (*backend.CheckHealthResult, error) {
-	client, err := ds.newClient(ctx)
-	if err != nil {
-		return &backend.CheckHealthResult{
-			Status:  backend.HealthStatusError,
-			Message: err.Error(),
-		}, nil
+// errorResponse returns a DataResponse failing with err, carrying its error
+// source and the HTTP status matching the GreptimeDB error.
+func errorResponse(err error) backend.DataResponse {
+	response := backend.ErrorResponseWithErrorSource(err)
+	response.Status = greptime.ErrorStatus(err)
+	if errors.Is(err, ErrorDatabaseNotAllowed) {
+		response.Status = backend.StatusForbidden
 	}
+	return response
+}
 
-	greptime.LogExecutedSQL("health", "SELECT 1")
-	if err := client.Ping(ctx, req.GetHTTPHeaders()); err != nil {
-		log.DefaultLogger.Error("greptime health check failed", "error", err)
-		return &backend.CheckHealthResult{
-			Status:  backend.HealthStatusError,
-			Message: err.Error(),
-		}, nil
+func setExecutedQueryString(frames []*data.Frame, sql string) {
+	for _, frame := range frames {
+		if frame == nil {
+			continue
+		}
+		if frame.Meta == nil {
+			frame.Meta = &data.FrameMeta{}
+		}
+		frame.Meta.ExecutedQueryString = sql
 	}
-
-	return &backend.CheckHealthResult{
-		Status:  backend.HealthStatusOk,
-		Message: "Database connection OK",
-	}, nil
 }
 
-func (ds *GreptimeDatasource) newClient(ctx context.Context) (*greptime.Client, error) {
+func (ds *GreptimeDatasource) newClient() (greptime.Querier, error) {
 	tlsConfig, err := ds.tlsConfig()
 	if err != nil {
 		return nil, err
 	}
 
-	timeout := 60 * time.Second
-	if t, err := strconv.Atoi(strings.TrimSpace(ds.settings.QueryTimeout)); err == nil && t > 0 {
-		timeout = time.Duration(t) * time.Second
+	timeout := ds.queryTimeout()
+	switch ds.settings.Transport() {
+	case ProtocolNative:
+		return ds.newFlightClient(tlsConfig, timeout)
+	case ProtocolPostgres:
+		return ds.newPostgresClient(tlsConfig, timeout)
 	}
 
-	transport := http.DefaultTransport.(*http.Transport).Clone()
-	transport.TLSClientConfig = tlsConfig
+	transport, err := ds.newTransport(tlsConfig)
+	if err != nil {
+		return nil, err
+	}
 
-	if dialCtx, err := getPDCDialContext(ds.settings); err != nil {
+	var connMaxLifetime time.Duration
+	if m, err := strconv.Atoi(strings.TrimSpace(ds.settings.ConnMaxLifetime)); err == nil && m > 0 {
+		connMaxLifetime = time.Duration(m) * time.Minute
+	}
+
+	retry, err := ds.retryPolicy()
+	if err != nil {
 		return nil, err
-	} else if dialCtx != nil {
-		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
-			return dialCtx(ctx, addr)
-		}
 	}
 
 	return greptime.NewClient(greptime.ClientSettings{
 		SQLURL:                ds.settings.SQLURL(),
+		PrometheusURL:         ds.settings.PrometheusURL(),
+		Endpoints:             ds.settings.EndpointURLs(),
+		EndpointSelection:     ds.settings.EndpointSelection,
 		DefaultDatabase:       ds.settings.DefaultDatabase,
+		AuthMode:              ds.settings.AuthMode,
 		Username:              ds.settings.Username,
 		Password:              ds.settings.Password,
+		BearerToken:           ds.settings.BearerToken,
 		HttpHeaders:           ds.settings.HttpHeaders,
 		ForwardGrafanaHeaders: ds.settings.ForwardGrafanaHeaders,
+		Hints:                 ds.settings.Hints(),
 		QueryTimeout:          timeout,
+		RowLimit:              ds.settings.RowLimit,
+		ResponseFormat:        ds.settings.ResponseFormat,
+		MaxResponseBytes:      ds.settings.MaxResponseBytes,
+		ConnMaxLifetime:       connMaxLifetime,
 		TLSConfig:             tlsConfig,
 		Transport:             transport,
+		Retry:                 retry,
 	}), nil
 }
 
+// newFlightClient connects to the native Arrow Flight endpoint.
+func (ds *GreptimeDatasource) newFlightClient(tlsConfig *tls.Config, timeout time.Duration) (greptime.Querier, error) {
+	dialer, err := ds.pdcDialer()
+	if err != nil {
+		return nil, err
+	}
+	return greptime.NewFlightClient(greptime.FlightSettings{
+		Address:               ds.settings.GRPCAddress(),
+		DefaultDatabase:       ds.settings.DefaultDatabase,
+		AuthMode:              ds.settings.AuthMode,
+		Username:              ds.settings.Username,
+		Password:              ds.settings.Password,
+		BearerToken:           ds.settings.BearerToken,
+		HttpHeaders:           ds.settings.HttpHeaders,
+		ForwardGrafanaHeaders: ds.settings.ForwardGrafanaHeaders,
+		Hints:                 ds.settings.Hints(),
+		QueryTimeout:          timeout,
+		RowLimit:              ds.settings.RowLimit,
+		TLSConfig:             withoutPort(tlsConfig),
+		Dialer:                dialer,
+	})
+}
+
+// newPostgresClient connects to the PostgreSQL wire-protocol endpoint.
+// MaxOpenConns and ConnMaxLifetime size its pool like the HTTP transport.
+func (ds *GreptimeDatasource) newPostgresClient(tlsConfig *tls.Config, timeout time.Duration) (greptime.Querier, error) {
+	dialer, err := ds.pdcDialer()
+	if err != nil {
+		return nil, err
+	}
+	var maxConns int32
+	if n, err := strconv.ParseInt(strings.TrimSpace(ds.settings.MaxOpenConns), 10, 32); err == nil && n > 0 {
+		maxConns = int32(n)
+	}
+	var connMaxLifetime time.Duration
+	if m, err := strconv.Atoi(strings.TrimSpace(ds.settings.ConnMaxLifetime)); err == nil && m > 0 {
+		connMaxLifetime = time.Duration(m) * time.Minute
+	}
+	return greptime.NewPostgresClient(greptime.PostgresSettings{
+		Address:         ds.settings.PostgresAddress(),
+		DefaultDatabase: ds.settings.DefaultDatabase,
+		Username:        ds.settings.Username,
+		Password:        ds.settings.Password,
+		QueryTimeout:    timeout,
+		RowLimit:        ds.settings.RowLimit,
+		MaxConns:        maxConns,
+		ConnMaxLifetime: connMaxLifetime,
+		TLSConfig:       withoutPort(tlsConfig),
+		Dialer:          dialer,
+	})
+}
+
+// pdcDialer returns a dialer through the secure SOCKS proxy bounded by
+// DialTimeout, or nil when PDC is disabled.
+func (ds *GreptimeDatasource) pdcDialer() (func(context.Context, string) (net.Conn, error), error) {
+	dialCtx, err := getPDCDialContext(ds.settings)
+	if err != nil || dialCtx == nil {
+		return nil, err
+	}
+	dialTimeout := ds.dialTimeout()
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		ctx, cancel := context.WithTimeout(ctx, dialTimeout)
+		defer cancel()
+		return dialCtx(ctx, addr)
+	}, nil
+}
+
+// withoutPort strips the port getTLSConfig may copy from Host into ServerName.
+func withoutPort(tlsConfig *tls.Config) *tls.Config {
+	if tlsConfig != nil {
+		if host, _, err := net.SplitHostPort(tlsConfig.ServerName); err == nil {
+			tlsConfig.ServerName = host
+		}
+	}
+	return tlsConfig
+}
+
+func (ds *GreptimeDatasource) queryTimeout() time.Duration {
+	if t, err := strconv.Atoi(strings.TrimSpace(ds.settings.QueryTimeout)); err == nil && t > 0 {
+		return time.Duration(t) * time.Second
+	}
+	return 60 * time.Second
+}
+
+func (ds *GreptimeDatasource) dialTimeout() time.Duration {
+	if t, err := strconv.Atoi(strings.TrimSpace(ds.settings.DialTimeout)); err == nil && t > 0 {
+		return time.Duration(t) * time.Second
+	}
+	return 10 * time.Second
+}
+
+// retryPolicy converts the retry settings; unset values keep the client defaults.
+func (ds *GreptimeDatasource) retryPolicy() (greptime.RetryPolicy, error) {
+	var policy greptime.RetryPolicy
+	if v := strings.TrimSpace(ds.settings.RetryMaxAttempts); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return policy, backend.DownstreamError(fmt.Errorf("could not parse retryMaxAttempts value: %w", err))
+		}
+		// 0 would mean "default"; an explicit 0 disables retries like 1.
+		policy.MaxAttempts = max(n, 1)
+	}
+	if ms, err := strconv.Atoi(strings.TrimSpace(ds.settings.RetryBackoff)); err == nil && ms > 0 {
+		policy.InitialBackoff = time.Duration(ms) * time.Millisecond
+	}
+	if ms, err := strconv.Atoi(strings.TrimSpace(ds.settings.RetryMaxBackoff)); err == nil && ms > 0 {
+		policy.MaxBackoff = time.Duration(ms) * time.Millisecond
+	}
+	if v := strings.TrimSpace(ds.settings.RetryStatusCodes); v != "" {
+		policy.RetryableStatusCodes = []int{}
+		for _, part := range strings.Split(v, ",") {
+			code, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil {
+				return policy, backend.DownstreamError(fmt.Errorf("could not parse retryStatusCodes value %q: %w", part, err))
+			}
+			policy.RetryableStatusCodes = append(policy.RetryableStatusCodes, code)
+		}
+	}
+	return policy, nil
+}
+
+// newTransport builds the pooled HTTP transport shared by all requests of this
+// instance. MaxOpenConns and MaxIdleConns mirror the database/sql pool limits
+// of other SQL datasources; DialTimeout also bounds PDC dials.
+func (ds *GreptimeDatasource) newTransport(tlsConfig *tls.Config) (*http.Transport, error) {
+	dialTimeout := ds.dialTimeout()
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.TLSHandshakeTimeout = dialTimeout
+
+	if n, err := strconv.Atoi(strings.TrimSpace(ds.settings.MaxOpenConns)); err == nil && n > 0 {
+		transport.MaxConnsPerHost = n
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(ds.settings.MaxIdleConns)); err == nil && n > 0 {
+		transport.MaxIdleConns = n
+		transport.MaxIdleConnsPerHost = n
+	}
+
+	dialer := &net.Dialer{Timeout: dialTimeout, KeepAlive: 30 * time.Second}
+	transport.DialContext = dialer.DialContext
+
+	if dialCtx, err := getPDCDialContext(ds.settings); err != nil {
+		return nil, err
+	} else if dialCtx != nil {
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			ctx, cancel := context.WithTimeout(ctx, dialTimeout)
+			defer cancel()
+			return dialCtx(ctx, addr)
+		}
+	}
+	return transport, nil
+}
+
 func (ds *GreptimeDatasource) tlsConfig() (*tls.Config, error) {
 	if ds.settings.TlsAuthWithCACert || ds.settings.TlsClientAuth {
 		return getTLSConfig(ds.settings)
@@ -186,18 +590,112 @@ func (ds *GreptimeDatasource) tlsConfig() (*tls.Config, error) {
 
 // SQLURL returns the Greptime HTTP SQL endpoint.
 func (settings Settings) SQLURL() string {
+	return settings.baseURL() + "/v1/sql"
+}
+
+// PrometheusURL returns the root of Greptime's Prometheus-compatible HTTP API.
+func (settings Settings) PrometheusURL() string {
+	return settings.baseURL() + "/v1/prometheus/api/v1"
+}
+
+// EndpointURLs returns the base URLs of Host and every additional endpoint,
+// or nil when only Host is configured.
+func (settings Settings) EndpointURLs() []string {
+	if len(settings.Endpoints) == 0 {
+		return nil
+	}
+	urls := []string{settings.baseURL()}
+	for _, endpoint := range settings.Endpoints {
+		u := settings.endpointURL(endpoint)
+		if !slices.Contains(urls, u) {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// Transport returns the protocol queries actually use. Hosts given as http(s)
+// URLs always use HTTP, and so does "native" in settings saved before
+// nativeFlightVersion, when the config editor defaulted to it. Settings
+// without a version, such as provisioned ones, count as saved before it.
+func (settings Settings) Transport() string {
+	host := strings.TrimSpace(settings.Host)
+	if strings.HasPrefix(host, "http://") || strings.HasPrefix(host, "https://") {
+		return ProtocolHTTP
+	}
+	switch settings.Protocol {
+	case ProtocolNative:
+		if versionBefore(settings.Version, nativeFlightVersion) {
+			return ProtocolHTTP
+		}
+		return ProtocolNative
+	case ProtocolPostgres:
+		return ProtocolPostgres
+	}
+	return ProtocolHTTP
+}
+
+// versionBefore reports whether the major.minor.patch version v is older than
+// target. Missing or malformed parts count as 0.
+func versionBefore(v, target string) bool {
+	parse := func(v string) [3]int {
+		var parts [3]int
+		v, _, _ = strings.Cut(strings.TrimPrefix(v, "v"), "-")
+		for i, part := range strings.SplitN(v, ".", 3) {
+			parts[i], _ = strconv.Atoi(part)
+		}
+		return parts
+	}
+	a, b := parse(v), parse(target)
+	return slices.Compare(a[:], b[:]) < 0
+}
+
+// GRPCAddress returns the host:port of the Arrow Flight endpoint, defaulting
+// the port from Port (or 4001).
+func (settings Settings) GRPCAddress() string {
+	return settings.hostPort(greptime.DefaultFlightPort)
+}
+
+// PostgresAddress returns the host:port of the PostgreSQL endpoint, defaulting
+// the port from Port (or 4003).
+func (settings Settings) PostgresAddress() string {
+	return settings.hostPort(greptime.DefaultPostgresPort)
+}
+
+func (settings Settings) hostPort(defaultPort int64) string {
 	host := strings.TrimRight(strings.TrimSpace(settings.Host), "/")
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	port := settings.Port
+	if port == 0 {
+		port = defaultPort
+	}
+	return net.JoinHostPort(host, strconv.FormatInt(port, 10))
+}
+
+func (settings Settings) baseURL() string {
+	return settings.endpointURL(settings.Host)
+}
+
+// endpointURL turns a host, host:port or URL into a base URL, defaulting the
+// scheme from Secure and the port from Port (or 4000).
+func (settings Settings) endpointURL(host string) string {
+	host = strings.TrimRight(strings.TrimSpace(host), "/")
 	if strings.HasPrefix(host, "http://") || strings.HasPrefix(host, "https://") {
-		return host + "/v1/sql"
+		return host
 	}
 
 	scheme := "http"
 	if settings.Secure {
 		scheme = "https"
 	}
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return fmt.Sprintf("%s://%s", scheme, host)
+	}
 	port := settings.Port
 	if port == 0 {
 		port = 4000
 	}
-	return fmt.Sprintf("%s://%s:%d/v1/sql", scheme, host, port)
+	return fmt.Sprintf("%s://%s:%d", scheme, host, port)
 }
@@ -4,9 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -14,6 +18,8 @@ import (
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/GreptimeTeam/greptimedb-grafana-datasource/pkg/greptime"
 )
 
 // makeMockServer creates an httptest.Server that returns the given response body and status code.
@@ -33,6 +39,15 @@ func makeMockServer(responseBody string, statusCode int) (*httptest.Server, *str
 	return ts, &capturedSQL
 }
 
+// newTestDatasource builds a datasource with its long-lived client, disposed at test end.
+func newTestDatasource(t testing.TB, settings Settings) *GreptimeDatasource {
+	t.Helper()
+	ds, err := newGreptimeDatasource(settings)
+	require.NoError(t, err)
+	t.Cleanup(ds.Dispose)
+	return ds
+}
+
 // makeDataQuery builds a backend.DataQuery for testing.
 func makeDataQuery(refID, rawSQL, editorType, queryType string, extraFields map[string]any) backend.DataQuery {
 	q := map[string]any{
@@ -84,12 +99,10 @@ func TestQueryData_TimeSeries_DateBin_GroupBy(t *testing.T) {
 	ts, capturedSQL := makeMockServer(responseJSON, http.StatusOK)
 	defer ts.Close()
 
-	ds := &GreptimeDatasource{
-		settings: Settings{
-			Host:            ts.URL,
-			DefaultDatabase: "public",
-		},
-	}
+	ds := newTestDatasource(t, Settings{
+		Host:            ts.URL,
+		DefaultDatabase: "public",
+	})
 
 	req := &backend.QueryDataRequest{
 		Queries: []backend.DataQuery{
@@ -145,12 +158,10 @@ func TestQueryData_Logs(t *testing.T) {
 	ts, _ := makeMockServer(responseJSON, http.StatusOK)
 	defer ts.Close()
 
-	ds := &GreptimeDatasource{
-		settings: Settings{
-			Host:            ts.URL,
-			DefaultDatabase: "public",
-		},
-	}
+	ds := newTestDatasource(t, Settings{
+		Host:            ts.URL,
+		DefaultDatabase: "public",
+	})
 
 	req := &backend.QueryDataRequest{
 		Queries: []backend.DataQuery{
@@ -221,12 +232,10 @@ func TestQueryData_Traces(t *testing.T) {
 	ts, _ := makeMockServer(responseJSON, http.StatusOK)
 	defer ts.Close()
 
-	ds := &GreptimeDatasource{
-		settings: Settings{
-			Host:            ts.URL,
-			DefaultDatabase: "public",
-		},
-	}
+	ds := newTestDatasource(t, Settings{
+		Host:            ts.URL,
+		DefaultDatabase: "public",
+	})
 
 	// RefID "Trace ID" triggers trace detail mode, so IsTraceDetailQuery returns true.
 	traceColumns := []map[string]any{
@@ -311,12 +320,10 @@ func TestQueryData_Table(t *testing.T) {
 	ts, _ := makeMockServer(responseJSON, http.StatusOK)
 	defer ts.Close()
 
-	ds := &GreptimeDatasource{
-		settings: Settings{
-			Host:            ts.URL,
-			DefaultDatabase: "public",
-		},
-	}
+	ds := newTestDatasource(t, Settings{
+		Host:            ts.URL,
+		DefaultDatabase: "public",
+	})
 
 	req := &backend.QueryDataRequest{
 		Queries: []backend.DataQuery{
@@ -344,15 +351,95 @@ func TestQueryData_Table(t *testing.T) {
 	assert.Equal(t, 2, frame.Rows(), "table frame should have 2 rows")
 }
 
+// TestQueryData_Stats verifies execution statistics reach the first frame's meta.
+func TestQueryData_Stats(t *testing.T) {
+	responseJSON := `{"code":0,"execution_time_ms":9,"resp_metrics":{"greptime_exec_read_cost":4},
+		"output":[{"records":{"schema":{"column_schemas":[{"name":"n","data_type":"Int64"}]},"rows":[[1],[2]]}}]}`
+
+	ts, _ := makeMockServer(responseJSON, http.StatusOK)
+	defer ts.Close()
+
+	ds := newTestDatasource(t, Settings{Host: ts.URL, ResponseFormat: "json"})
+
+	req := &backend.QueryDataRequest{
+		Queries: []backend.DataQuery{
+			makeDataQuery("A", "SELECT n FROM t", "sql", "table", nil),
+		},
+	}
+
+	resp, err := ds.QueryData(context.Background(), req)
+	require.NoError(t, err)
+
+	dr := resp.Responses["A"]
+	require.NoError(t, dr.Error)
+	require.NotEmpty(t, dr.Frames)
+	stats := map[string]float64{}
+	for _, stat := range dr.Frames[0].Meta.Stats {
+		stats[stat.DisplayName] = stat.Value
+	}
+	assert.Equal(t, float64(9), stats["Server execution time"])
+	assert.Contains(t, stats, "End-to-end latency")
+	assert.Equal(t, float64(len(responseJSON)), stats["Response size"])
+	assert.Equal(t, float64(2), stats["Rows"])
+	assert.Equal(t, float64(4), stats["Exec read cost"])
+}
+
+// TestQueryData_Explain verifies explain queries run under EXPLAIN ANALYZE and
+// return node graph frames, falling back to the table when there is no plan.
+func TestQueryData_Explain(t *testing.T) {
+	responseJSON := `{"code":0,"output":[{"records":{"schema":{"column_schemas":[
+		{"name":"stage","data_type":"UInt32"},{"name":"node","data_type":"UInt32"},{"name":"plan","data_type":"String"}]},
+		"rows":[[0,0,"ProjectionExec: expr=[n@0 as n] metrics=[output_rows=1]\n  SeqScan: region=1 metrics=[output_rows=1]\n"]]}}]}`
+
+	ts, capturedSQL := makeMockServer(responseJSON, http.StatusOK)
+	defer ts.Close()
+
+	ds := newTestDatasource(t, Settings{Host: ts.URL, ResponseFormat: "json"})
+
+	req := &backend.QueryDataRequest{
+		Queries: []backend.DataQuery{
+			makeDataQuery("A", "SELECT n FROM t WHERE $__timeFilter(ts)", "sql", "explain", nil),
+		},
+	}
+
+	resp, err := ds.QueryData(context.Background(), req)
+	require.NoError(t, err)
+
+	dr := resp.Responses["A"]
+	require.NoError(t, dr.Error)
+	assert.Contains(t, *capturedSQL, "*/ EXPLAIN ANALYZE SELECT n FROM t WHERE \"ts\" >= ")
+	require.Len(t, dr.Frames, 2)
+	assert.Equal(t, "nodes", dr.Frames[0].Name)
+	assert.Equal(t, "edges", dr.Frames[1].Name)
+	assert.Equal(t, 2, dr.Frames[0].Rows())
+	assert.Equal(t, 1, dr.Frames[1].Rows())
+
+	plain, _ := makeMockServer(`{"code":0,"output":[{"records":{"schema":{"column_schemas":[{"name":"n","data_type":"Int64"}]},"rows":[[1]]}}]}`, http.StatusOK)
+	defer plain.Close()
+	ds = newTestDatasource(t, Settings{Host: plain.URL, ResponseFormat: "json"})
+	resp, err = ds.QueryData(context.Background(), req)
+	require.NoError(t, err)
+	require.Len(t, resp.Responses["A"].Frames, 1)
+	assert.Equal(t, "n", resp.Responses["A"].Frames[0].Fields[0].Name)
+
+	// Statements that EXPLAIN ANALYZE would execute never reach GreptimeDB.
+	*capturedSQL = ""
+	ds = newTestDatasource(t, Settings{Host: ts.URL, ResponseFormat: "json"})
+	resp, err = ds.QueryData(context.Background(), &backend.QueryDataRequest{
+		Queries: []backend.DataQuery{makeDataQuery("A", "DELETE FROM t", "sql", "explain", nil)},
+	})
+	require.NoError(t, err)
+	assert.ErrorIs(t, resp.Responses["A"].Error, greptime.ErrNotExplainable)
+	assert.Empty(t, *capturedSQL)
+}
+
 // TestQueryData_EmptySQL verifies that an empty rawSql returns empty frames (no error).
 func TestQueryData_EmptySQL(t *testing.T) {
 	// No mock server needed — empty SQL short-circuits before any HTTP call.
-	ds := &GreptimeDatasource{
-		settings: Settings{
-			Host:            "http://localhost:9999",
-			DefaultDatabase: "public",
-		},
-	}
+	ds := newTestDatasource(t, Settings{
+		Host:            "http://localhost:9999",
+		DefaultDatabase: "public",
+	})
 
 	req := &backend.QueryDataRequest{
 		Queries: []backend.DataQuery{
@@ -376,12 +463,10 @@ func TestQueryData_SQLError(t *testing.T) {
 	ts, _ := makeMockServer(responseJSON, http.StatusOK)
 	defer ts.Close()
 
-	ds := &GreptimeDatasource{
-		settings: Settings{
-			Host:            ts.URL,
-			DefaultDatabase: "public",
-		},
-	}
+	ds := newTestDatasource(t, Settings{
+		Host:            ts.URL,
+		DefaultDatabase: "public",
+	})
 
 	req := &backend.QueryDataRequest{
 		Queries: []backend.DataQuery{
@@ -403,12 +488,10 @@ func TestQueryData_HTTPError(t *testing.T) {
 	ts, _ := makeMockServer("Internal Server Error", http.StatusInternalServerError)
 	defer ts.Close()
 
-	ds := &GreptimeDatasource{
-		settings: Settings{
-			Host:            ts.URL,
-			DefaultDatabase: "public",
-		},
-	}
+	ds := newTestDatasource(t, Settings{
+		Host:            ts.URL,
+		DefaultDatabase: "public",
+	})
 
 	req := &backend.QueryDataRequest{
 		Queries: []backend.DataQuery{
@@ -424,3 +507,666 @@ func TestQueryData_HTTPError(t *testing.T) {
 	assert.Error(t, dr.Error, "HTTP 500 should produce a DataResponse error")
 	assert.Contains(t, dr.Error.Error(), "greptime http 500")
 }
+
+// TestQueryData_ErrorStatus verifies GreptimeDB errors set a matching status,
+// a downstream error source and a readable message.
+func TestQueryData_ErrorStatus(t *testing.T) {
+	ts, _ := makeMockServer(`{"code":4001,"error":"Table not found: greptime.public.cpu"}`, http.StatusOK)
+	defer ts.Close()
+
+	ds := newTestDatasource(t, Settings{Host: ts.URL, DefaultDatabase: "public"})
+
+	req := &backend.QueryDataRequest{
+		Queries: []backend.DataQuery{
+			makeDataQuery("A", "SELECT * FROM cpu", "sql", "table", nil),
+		},
+	}
+
+	resp, err := ds.QueryData(context.Background(), req)
+	require.NoError(t, err)
+
+	dr := resp.Responses["A"]
+	require.Error(t, dr.Error)
+	assert.Equal(t, `table "cpu" not found in database "public"`, dr.Error.Error())
+	assert.Equal(t, backend.StatusNotFound, dr.Status)
+	assert.Equal(t, backend.ErrorSourceDownstream, dr.ErrorSource)
+}
+
+// TestQueryData_ReusesConnections verifies the per-instance client keeps
+// connections alive across QueryData and CheckHealth calls.
+func TestQueryData_ReusesConnections(t *testing.T) {
+	var newConns atomic.Int32
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		_, _ = w.Write([]byte(`{"code": 0, "output": []}`))
+	}))
+	ts.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			newConns.Add(1)
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	ds := newTestDatasource(t, Settings{Host: ts.URL})
+
+	req := &backend.QueryDataRequest{
+		Queries: []backend.DataQuery{makeDataQuery("A", "SELECT 1", "sql", "table", nil)},
+	}
+	for i := 0; i < 3; i++ {
+		_, err := ds.QueryData(context.Background(), req)
+		require.NoError(t, err)
+	}
+	health, err := ds.CheckHealth(context.Background(), &backend.CheckHealthRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, backend.HealthStatusOk, health.Status)
+
+	assert.Equal(t, int32(1), newConns.Load(), "sequential requests should share one pooled connection")
+}
+
+func TestNewTransport_PoolSettings(t *testing.T) {
+	ds := &GreptimeDatasource{settings: Settings{
+		Host:         "http://localhost:4000",
+		MaxOpenConns: "12",
+		MaxIdleConns: "7",
+		DialTimeout:  "3",
+	}}
+
+	transport, err := ds.newTransport(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 12, transport.MaxConnsPerHost)
+	assert.Equal(t, 7, transport.MaxIdleConns)
+	assert.Equal(t, 7, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, 3*time.Second, transport.TLSHandshakeTimeout)
+	assert.NotNil(t, transport.DialContext)
+}
+
+// TestQueryData_RowLimit verifies the row limit truncates results and that the
+// warning notice survives time-series formatting.
+func TestQueryData_RowLimit(t *testing.T) {
+	responseJSON := `{
+		"code": 0,
+		"output": [{
+			"records": {
+				"schema": {
+					"column_schemas": [
+						{"name": "time", "data_type": "TimestampMillisecond"},
+						{"name": "host", "data_type": "String"},
+						{"name": "cpu", "data_type": "Float64"}
+					]
+				},
+				"rows": [
+					[1700000000000, "host-a", 1],
+					[1700000060000, "host-a", 2],
+					[1700000120000, "host-a", 3]
+				]
+			}
+		}]
+	}`
+
+	ts, _ := makeMockServer(responseJSON, http.StatusOK)
+	defer ts.Close()
+
+	ds := newTestDatasource(t, Settings{Host: ts.URL, RowLimit: 2})
+
+	req := &backend.QueryDataRequest{
+		Queries: []backend.DataQuery{
+			makeDataQuery("A", "SELECT time, host, cpu FROM cpu", "sql", "timeseries", nil),
+		},
+	}
+
+	resp, err := ds.QueryData(context.Background(), req)
+	require.NoError(t, err)
+
+	dr := resp.Responses["A"]
+	require.NoError(t, dr.Error)
+	require.Len(t, dr.Frames, 1)
+	assert.Equal(t, 2, dr.Frames[0].Rows())
+	require.NotNil(t, dr.Frames[0].Meta)
+	require.Len(t, dr.Frames[0].Meta.Notices, 1)
+	assert.Equal(t, data.NoticeSeverityWarning, dr.Frames[0].Meta.Notices[0].Severity)
+	assert.Contains(t, dr.Frames[0].Meta.Notices[0].Text, "1 rows were dropped")
+}
+
+// TestQueryData_PromQL verifies promql queries go to the Prometheus API and
+// return labeled multi-frame time series.
+func TestQueryData_PromQL(t *testing.T) {
+	var gotPath, gotQuery, gotStep string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		gotPath, gotQuery, gotStep = r.URL.Path, r.PostForm.Get("query"), r.PostForm.Get("step")
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[
+			{"metric":{"host":"a"},"values":[[1704067200,"1"],[1704067260,"2"]]},
+			{"metric":{"host":"b"},"values":[[1704067200,"3"]]}
+		]}}`))
+	}))
+	defer ts.Close()
+
+	ds := newTestDatasource(t, Settings{Host: ts.URL, DefaultDatabase: "public"})
+
+	req := &backend.QueryDataRequest{
+		Queries: []backend.DataQuery{
+			makeDataQuery("A", "", "sql", "promql", map[string]any{"expr": "sum by (host) (rate(cpu[5m]))"}),
+		},
+	}
+
+	resp, err := ds.QueryData(context.Background(), req)
+	require.NoError(t, err)
+
+	dr := resp.Responses["A"]
+	require.NoError(t, dr.Error)
+	assert.Equal(t, "/v1/prometheus/api/v1/query_range", gotPath)
+	assert.Equal(t, "sum by (host) (rate(cpu[5m]))", gotQuery)
+	assert.Equal(t, "60", gotStep, "step should default to the panel interval")
+
+	require.Len(t, dr.Frames, 2)
+	assert.Equal(t, data.Labels{"host": "a"}, dr.Frames[0].Fields[1].Labels)
+	assert.Equal(t, 2, dr.Frames[0].Rows())
+	assert.Equal(t, "sum by (host) (rate(cpu[5m]))", dr.Frames[0].Meta.ExecutedQueryString)
+}
+
+// TestQueryData_Database verifies a query's database overrides the default
+// only when the datasource allows it.
+func TestQueryData_Database(t *testing.T) {
+	var mu sync.Mutex
+	var databases []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		databases = append(databases, r.Header.Get("x-greptime-db-name"))
+		_, _ = w.Write([]byte(`{"code":0,"output":[]}`))
+	}))
+	defer ts.Close()
+
+	ds := newTestDatasource(t, Settings{Host: ts.URL, DefaultDatabase: "metrics", AllowedDatabases: []string{"logs"}})
+
+	req := &backend.QueryDataRequest{
+		Queries: []backend.DataQuery{
+			makeDataQuery("A", "SELECT 1", "sql", "table", nil),
+			makeDataQuery("B", "SELECT 1", "sql", "table", map[string]any{"database": "logs"}),
+			makeDataQuery("C", "SELECT 2", "sql", "table", map[string]any{"database": "metrics"}),
+			makeDataQuery("D", "SELECT 1", "sql", "table", map[string]any{"database": "secrets"}),
+		},
+	}
+
+	resp, err := ds.QueryData(context.Background(), req)
+	require.NoError(t, err)
+	for _, refID := range []string{"A", "B", "C"} {
+		require.NoError(t, resp.Responses[refID].Error, refID)
+	}
+	require.ErrorIs(t, resp.Responses["D"].Error, ErrorDatabaseNotAllowed)
+	assert.ErrorContains(t, resp.Responses["D"].Error, "secrets")
+	assert.Equal(t, backend.StatusForbidden, resp.Responses["D"].Status)
+	assert.ElementsMatch(t, []string{"metrics", "logs", "metrics"}, databases)
+}
+
+// TestQueryData_Timezone verifies the dashboard timezone, or else the
+// datasource default, reaches both the macros and the session header.
+func TestQueryData_Timezone(t *testing.T) {
+	var mu sync.Mutex
+	timezones := map[string]string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		_, sql, _ := strings.Cut(r.PostForm.Get("sql"), "*/ ")
+		mu.Lock()
+		defer mu.Unlock()
+		timezones[sql] = r.Header.Get("x-greptime-timezone")
+		_, _ = w.Write([]byte(`{"code":0,"output":[]}`))
+	}))
+	defer ts.Close()
+
+	ds := newTestDatasource(t, Settings{Host: ts.URL, Timezone: "Europe/Berlin"})
+
+	req := &backend.QueryDataRequest{
+		Queries: []backend.DataQuery{
+			makeDataQuery("A", "SELECT $__timezone", "sql", "table", map[string]any{"meta": map[string]any{"timezone": "Asia/Shanghai"}}),
+			makeDataQuery("B", "SELECT $__timezone", "sql", "table", map[string]any{"meta": map[string]any{"timezone": "utc"}}),
+			makeDataQuery("C", "SELECT $__timezone", "sql", "table", nil),
+		},
+	}
+
+	resp, err := ds.QueryData(context.Background(), req)
+	require.NoError(t, err)
+	for _, refID := range []string{"A", "B", "C"} {
+		require.NoError(t, resp.Responses[refID].Error, refID)
+	}
+	assert.Equal(t, map[string]string{
+		"SELECT 'Asia/Shanghai'": "Asia/Shanghai",
+		"SELECT 'UTC'":           "UTC",
+		"SELECT 'Europe/Berlin'": "Europe/Berlin",
+	}, timezones)
+}
+
+// TestQueryData_Hints verifies custom settings are sent as hints that
+// queries can extend or override.
+func TestQueryData_Hints(t *testing.T) {
+	var mu sync.Mutex
+	var hints []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		hints = append(hints, r.Header.Get("x-greptime-hints"))
+		_, _ = w.Write([]byte(`{"code":0,"output":[]}`))
+	}))
+	defer ts.Close()
+
+	ds := newTestDatasource(t, Settings{Host: ts.URL, CustomSettings: []CustomSetting{{Setting: "read_preference", Value: "follower"}}})
+
+	req := &backend.QueryDataRequest{
+		Queries: []backend.DataQuery{
+			makeDataQuery("A", "SELECT 1", "sql", "table", nil),
+			makeDataQuery("B", "SELECT 1", "sql", "table", map[string]any{"hints": map[string]string{"read_preference": "leader"}}),
+			makeDataQuery("C", "SELECT 1", "sql", "table", map[string]any{"hints": map[string]string{"Bad Hint": "1"}}),
+		},
+	}
+
+	resp, err := ds.QueryData(context.Background(), req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Responses["A"].Error)
+	require.NoError(t, resp.Responses["B"].Error)
+	require.ErrorIs(t, resp.Responses["C"].Error, greptime.ErrInvalidHint)
+	assert.ElementsMatch(t, []string{"read_preference=follower", "read_preference=leader"}, hints)
+}
+
+// TestQueryData_Concurrent verifies queries run in parallel up to
+// MaxOpenConns and each refId keeps its own result.
+func TestQueryData_Concurrent(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			peak := maxInFlight.Load()
+			if n <= peak || maxInFlight.CompareAndSwap(peak, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		_ = r.ParseForm()
+		_, sql, _ := strings.Cut(r.PostForm.Get("sql"), "*/ ")
+		if sql == "SELECT 'C'" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"code":1004,"error":"Invalid SQL"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"code":0,"output":[{"records":{"schema":{"column_schemas":[{"name":"v","data_type":"String"}]},"rows":[["` + sql + `"]]}}]}`))
+	}))
+	defer ts.Close()
+
+	ds := newTestDatasource(t, Settings{Host: ts.URL, MaxOpenConns: "2", ResponseFormat: "json"})
+
+	var queries []backend.DataQuery
+	for _, refID := range []string{"A", "B", "C", "D", "E"} {
+		queries = append(queries, makeDataQuery(refID, "SELECT '"+refID+"'", "sql", "table", nil))
+	}
+	resp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{Queries: queries})
+	require.NoError(t, err)
+
+	assert.Equal(t, int32(2), maxInFlight.Load())
+	require.Len(t, resp.Responses, 5)
+	assert.Error(t, resp.Responses["C"].Error)
+	for _, refID := range []string{"A", "B", "D", "E"} {
+		dr := resp.Responses[refID]
+		require.NoError(t, dr.Error, refID)
+		require.Len(t, dr.Frames, 1, refID)
+		assert.Equal(t, refID, dr.Frames[0].RefID)
+		v, _ := dr.Frames[0].Fields[0].ConcreteAt(0)
+		assert.Equal(t, "SELECT '"+refID+"'", v)
+	}
+}
+
+// panickingQuerier panics on statements containing "boom".
+type panickingQuerier struct {
+	greptime.Querier
+}
+
+func (q panickingQuerier) ExecuteSQL(ctx context.Context, sql string, forwarded http.Header) (*greptime.Response, error) {
+	if strings.Contains(sql, "boom") {
+		panic("boom")
+	}
+	return q.Querier.ExecuteSQL(ctx, sql, forwarded)
+}
+
+// TestQueryData_PanicIsolated verifies a panicking query fails only its own
+// refId.
+func TestQueryData_PanicIsolated(t *testing.T) {
+	ts, _ := makeMockServer(`{"code":0,"output":[]}`, http.StatusOK)
+	defer ts.Close()
+
+	ds := newTestDatasource(t, Settings{Host: ts.URL})
+	ds.client = panickingQuerier{ds.client}
+
+	resp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+		Queries: []backend.DataQuery{
+			makeDataQuery("A", "SELECT 1", "sql", "table", nil),
+			makeDataQuery("B", "SELECT 'boom'", "sql", "table", nil),
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, resp.Responses["A"].Error)
+	require.ErrorContains(t, resp.Responses["B"].Error, "query B failed unexpectedly: boom")
+	assert.Equal(t, backend.ErrorSourcePlugin, resp.Responses["B"].ErrorSource)
+}
+
+// TestQueryData_PromQLError verifies Prometheus API errors are propagated.
+func TestQueryData_PromQLError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"status":"error","errorType":"bad_data","error":"unexpected end of input"}`))
+	}))
+	defer ts.Close()
+
+	ds := newTestDatasource(t, Settings{Host: ts.URL})
+
+	req := &backend.QueryDataRequest{
+		Queries: []backend.DataQuery{
+			makeDataQuery("A", "", "sql", "promql", map[string]any{"expr": "rate("}),
+		},
+	}
+
+	resp, err := ds.QueryData(context.Background(), req)
+	require.NoError(t, err)
+	require.Error(t, resp.Responses["A"].Error)
+	assert.Contains(t, resp.Responses["A"].Error.Error(), "unexpected end of input")
+}
+
+// TestQueryData_TQLEval verifies TQL EVAL results are formatted as labeled
+// time series regardless of queryType, and that $__tqlRange is expanded.
+func TestQueryData_TQLEval(t *testing.T) {
+	responseJSON := `{
+		"code": 0,
+		"output": [{
+			"records": {
+				"schema": {
+					"column_schemas": [
+						{"name": "greptime_timestamp", "data_type": "TimestampMillisecond"},
+						{"name": "greptime_value", "data_type": "Float64"},
+						{"name": "host", "data_type": "String"}
+					]
+				},
+				"rows": [
+					[1704067200000, 1.0, "a"],
+					[1704067200000, 2.0, "b"],
+					[1704067260000, 1.5, "a"]
+				]
+			}
+		}]
+	}`
+
+	ts, capturedSQL := makeMockServer(responseJSON, http.StatusOK)
+	defer ts.Close()
+
+	ds := newTestDatasource(t, Settings{Host: ts.URL})
+
+	req := &backend.QueryDataRequest{
+		Queries: []backend.DataQuery{
+			makeDataQuery("A", "TQL EVAL ($__tqlRange) rate(cpu[5m])", "sql", "table", nil),
+		},
+	}
+
+	resp, err := ds.QueryData(context.Background(), req)
+	require.NoError(t, err)
+
+	dr := resp.Responses["A"]
+	require.NoError(t, dr.Error)
+	assert.Contains(t, *capturedSQL, "TQL EVAL (1704067200, 1704153600, '1m') rate(cpu[5m])")
+
+	require.Len(t, dr.Frames, 2)
+	assert.Equal(t, data.Labels{"host": "a"}, dr.Frames[0].Fields[1].Labels)
+	assert.Equal(t, 2, dr.Frames[0].Rows())
+	assert.Equal(t, data.Labels{"host": "b"}, dr.Frames[1].Fields[1].Labels)
+}
+
+func TestQueryData_MultipleStatements(t *testing.T) {
+	var requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		_, _ = w.Write([]byte(`{"code":0,"output":[{"affectedrows":0},` +
+			`{"records":{"schema":{"column_schemas":[{"name":"host","data_type":"String"}]},"rows":[["a"],["b"]]}},` +
+			`{"records":{"schema":{"column_schemas":[{"name":"v","data_type":"Float64"}]},"rows":[[1.5]]}}]}`))
+	}))
+	defer ts.Close()
+
+	ds := newTestDatasource(t, Settings{Host: ts.URL, CacheTTL: "60"})
+	sql := "SET time_zone = 'Asia/Shanghai';\nSELECT host FROM cpu;\nSELECT v FROM cpu"
+	run := func(mode string) backend.DataResponse {
+		resp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+			Queries: []backend.DataQuery{makeDataQuery("A", sql, "sql", "table", map[string]any{"resultMode": mode})},
+		})
+		require.NoError(t, err)
+		return resp.Responses["A"]
+	}
+
+	// Every result set, without the affected rows of SET.
+	dr := run("")
+	require.NoError(t, dr.Error)
+	require.Len(t, dr.Frames, 2)
+	assert.Equal(t, "SELECT host FROM cpu", dr.Frames[0].Name)
+	assert.Equal(t, 2, dr.Frames[0].Rows())
+	assert.Equal(t, "SELECT v FROM cpu", dr.Frames[1].Name)
+
+	// The last one only, served from the cache with the same naming.
+	dr = run("last")
+	require.NoError(t, dr.Error)
+	require.Len(t, dr.Frames, 1)
+	assert.Equal(t, "SELECT v FROM cpu", dr.Frames[0].Name)
+	assert.Equal(t, int32(1), requests.Load())
+
+	dr = run("first")
+	assert.ErrorContains(t, dr.Error, `invalid resultMode "first"`)
+}
+
+// TestQueryData_BuilderWithoutRawSQL verifies that builder queries saved
+// without rawSql, as alert rules may be, run the SQL generated from their
+// builderOptions with macros expanded.
+func TestQueryData_BuilderWithoutRawSQL(t *testing.T) {
+	responseJSON := `{"code":0,"output":[{"records":{"schema":{"column_schemas":[{"name":"ts","data_type":"TimestampMillisecond"},{"name":"usage","data_type":"Float64"}]},"rows":[[1704067200000,1.5]]}}]}`
+	ts, capturedSQL := makeMockServer(responseJSON, http.StatusOK)
+	defer ts.Close()
+
+	ds := newTestDatasource(t, Settings{Host: ts.URL, DefaultDatabase: "public"})
+	builder := map[string]any{"builderOptions": map[string]any{
+		"database":  "public",
+		"table":     "cpu",
+		"queryType": "table",
+		"mode":      "list",
+		"columns":   []map[string]any{{"name": "ts", "type": "TimestampMillisecond"}, {"name": "usage", "type": "Float64"}},
+		"filters": []map[string]any{{
+			"filterType": "custom", "key": "ts", "type": "TimestampMillisecond",
+			"condition": "AND", "operator": "WITH IN DASHBOARD TIME RANGE",
+		}},
+		"limit": 100,
+	}}
+
+	resp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+		Queries: []backend.DataQuery{makeDataQuery("A", "", "builder", "table", builder)},
+	})
+	require.NoError(t, err)
+
+	dr := resp.Responses["A"]
+	require.NoError(t, dr.Error)
+	require.Len(t, dr.Frames, 1)
+	assert.Equal(t, 1, dr.Frames[0].Rows())
+	assert.Contains(t, *capturedSQL, `SELECT "ts", "usage" FROM "public"."cpu" WHERE ( "ts" >= `)
+	assert.Contains(t, *capturedSQL, " LIMIT 100")
+	assert.NotContains(t, *capturedSQL, "$__")
+
+	// SQL editor queries never fall back to the builder.
+	resp, err = ds.QueryData(context.Background(), &backend.QueryDataRequest{
+		Queries: []backend.DataQuery{makeDataQuery("B", "", "sql", "table", builder)},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, resp.Responses["B"].Frames)
+}
+
+func TestRetryPolicy_FromSettings(t *testing.T) {
+	ds := &GreptimeDatasource{settings: Settings{
+		RetryMaxAttempts: "4",
+		RetryBackoff:     "50",
+		RetryMaxBackoff:  "800",
+		RetryStatusCodes: "429, 503",
+	}}
+	policy, err := ds.retryPolicy()
+	require.NoError(t, err)
+	assert.Equal(t, greptime.RetryPolicy{
+		MaxAttempts:          4,
+		InitialBackoff:       50 * time.Millisecond,
+		MaxBackoff:           800 * time.Millisecond,
+		RetryableStatusCodes: []int{429, 503},
+	}, policy)
+
+	ds.settings = Settings{RetryMaxAttempts: "0"}
+	policy, err = ds.retryPolicy()
+	require.NoError(t, err)
+	assert.Equal(t, 1, policy.MaxAttempts, "0 disables retries")
+
+	ds.settings = Settings{RetryStatusCodes: "503,oops"}
+	_, err = ds.retryPolicy()
+	assert.ErrorContains(t, err, "retryStatusCodes")
+}
+
+// TestQueryData_RetryNotice verifies a retried query succeeds and surfaces the retry as a notice.
+func TestQueryData_RetryNotice(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte(`{"code":0,"output":[{"records":{"schema":{"column_schemas":[{"name":"v","data_type":"Int64"}]},"rows":[[1]]}}]}`))
+	}))
+	defer ts.Close()
+
+	ds := newTestDatasource(t, Settings{Host: ts.URL, RetryBackoff: "1"})
+
+	resp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+		Queries: []backend.DataQuery{makeDataQuery("A", "SELECT v FROM t", "sql", "table", nil)},
+	})
+	require.NoError(t, err)
+
+	dr := resp.Responses["A"]
+	require.NoError(t, dr.Error)
+	require.Len(t, dr.Frames, 1)
+	require.Len(t, dr.Frames[0].Meta.Notices, 1)
+	assert.Contains(t, dr.Frames[0].Meta.Notices[0].Text, "greptime http 502")
+}
+
+func TestSettings_EndpointURLs(t *testing.T) {
+	assert.Nil(t, Settings{Host: "db", Port: 4000}.EndpointURLs(), "a single host keeps the plain SQL URL")
+
+	settings := Settings{
+		Host:      "db-1",
+		Port:      4000,
+		Secure:    true,
+		Endpoints: []string{"db-2", "db-3:4010", "http://db-4:4000/", "db-1"},
+	}
+	assert.Equal(t, []string{
+		"https://db-1:4000",
+		"https://db-2:4000",
+		"https://db-3:4010",
+		"http://db-4:4000",
+	}, settings.EndpointURLs())
+}
+
+func TestSettings_Transport(t *testing.T) {
+	assert.Equal(t, ProtocolHTTP, Settings{Host: "db", Port: 4000}.Transport())
+	assert.Equal(t, ProtocolHTTP, Settings{Host: "http://db:4000", Protocol: ProtocolNative}.Transport(), "http URLs keep the HTTP transport")
+	assert.Equal(t, ProtocolNative, Settings{Host: "db", Protocol: ProtocolNative, Version: nativeFlightVersion}.Transport())
+	assert.Equal(t, ProtocolNative, Settings{Host: "db", Protocol: ProtocolNative, Version: "3.2.0"}.Transport())
+	assert.Equal(t, ProtocolHTTP, Settings{Host: "db", Port: 4000, Protocol: ProtocolNative}.Transport(), "native without a version keeps HTTP")
+	assert.Equal(t, ProtocolHTTP, Settings{Host: "db", Port: 4000, Protocol: ProtocolNative, Version: "3.0.2"}.Transport(), "native saved by older editors keeps HTTP")
+	assert.Equal(t, ProtocolPostgres, Settings{Host: "db", Protocol: ProtocolPostgres}.Transport())
+
+	assert.Equal(t, "db:4001", Settings{Host: "db"}.GRPCAddress())
+	assert.Equal(t, "db:5001", Settings{Host: "db", Port: 5001}.GRPCAddress())
+	assert.Equal(t, "db:4101", Settings{Host: "db:4101", Port: 5001}.GRPCAddress())
+	assert.Equal(t, "db:4003", Settings{Host: "db"}.PostgresAddress())
+}
+
+// TestNewClient_Postgres verifies the postgres protocol selects the
+// wire-protocol client, which cannot serve PromQL queries.
+func TestNewClient_Postgres(t *testing.T) {
+	ds := newTestDatasource(t, Settings{Host: "127.0.0.1", Port: 1, Protocol: ProtocolPostgres})
+	_, ok := ds.client.(*greptime.PostgresClient)
+	require.True(t, ok)
+
+	req := &backend.QueryDataRequest{
+		Queries: []backend.DataQuery{
+			makeDataQuery("A", "", "sql", "promql", map[string]any{"expr": "up"}),
+		},
+	}
+	resp, err := ds.QueryData(context.Background(), req)
+	require.NoError(t, err)
+	assert.ErrorIs(t, resp.Responses["A"].Error, ErrorPromQLRequiresHTTP)
+}
+
+// TestQueryData_PromQLRequiresHTTP verifies PromQL queries fail clearly on the native protocol.
+func TestQueryData_PromQLRequiresHTTP(t *testing.T) {
+	ds := newTestDatasource(t, Settings{Host: "127.0.0.1", Port: 1, Protocol: ProtocolNative, Version: nativeFlightVersion})
+	_, ok := ds.client.(*greptime.FlightClient)
+	require.True(t, ok)
+
+	req := &backend.QueryDataRequest{
+		Queries: []backend.DataQuery{
+			makeDataQuery("A", "", "sql", "promql", map[string]any{"expr": "up"}),
+		},
+	}
+	resp, err := ds.QueryData(context.Background(), req)
+	require.NoError(t, err)
+	assert.ErrorIs(t, resp.Responses["A"].Error, ErrorPromQLRequiresHTTP)
+}
+
+// TestCheckHealth_Endpoints verifies each endpoint is reported individually.
+func TestCheckHealth_Endpoints(t *testing.T) {
+	live, _ := makeMockServer(`{"code":0,"output":[{"records":{"schema":{"column_schemas":[{"name":"1","data_type":"Int64"}]},"rows":[[1]]}}]}`, http.StatusOK)
+	defer live.Close()
+	down, _ := makeMockServer("bad gateway", http.StatusBadGateway)
+	defer down.Close()
+
+	ds := newTestDatasource(t, Settings{Host: live.URL, Endpoints: []string{down.URL}})
+
+	health, err := ds.CheckHealth(context.Background(), &backend.CheckHealthRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, backend.HealthStatusOk, health.Status)
+	assert.Contains(t, health.Message, "1 of 2 endpoints OK")
+	assert.Contains(t, health.Message, down.URL+": greptime http 502")
+
+	var details struct {
+		Endpoints []greptime.EndpointStatus `json:"endpoints"`
+	}
+	require.NoError(t, json.Unmarshal(health.JSONDetails, &details))
+	require.Len(t, details.Endpoints, 2)
+	assert.True(t, details.Endpoints[0].Healthy)
+	assert.False(t, details.Endpoints[1].Healthy)
+
+	live.Close()
+	health, err = ds.CheckHealth(context.Background(), &backend.CheckHealthRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, backend.HealthStatusError, health.Status)
+	assert.Contains(t, health.Message, "0 of 2 endpoints OK")
+}
+
+// TestCheckHealth_OAuth verifies health checks use the forwarded identity and
+// report a missing token clearly.
+func TestCheckHealth_OAuth(t *testing.T) {
+	var authorization string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		_, _ = w.Write([]byte(`{"code":0,"output":[]}`))
+	}))
+	defer ts.Close()
+
+	ds := newTestDatasource(t, Settings{Host: ts.URL, AuthMode: greptime.AuthModeOAuth})
+
+	health, err := ds.CheckHealth(context.Background(), &backend.CheckHealthRequest{
+		Headers: map[string]string{"Authorization": "Bearer user-token"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, backend.HealthStatusOk, health.Status)
+	assert.Equal(t, "Bearer user-token", authorization)
+
+	health, err = ds.CheckHealth(context.Background(), &backend.CheckHealthRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, backend.HealthStatusError, health.Status)
+	assert.Equal(t, greptime.ErrMissingOAuthToken.Error(), health.Message)
+}
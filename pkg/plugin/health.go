@@ -0,0 +1,244 @@
+package plugin
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+
+	"github.com/GreptimeTeam/greptimedb-grafana-datasource/pkg/greptime"
+)
+
+// certificateExpiryWarning is how long before expiry a certificate is flagged.
+const certificateExpiryWarning = 30 * 24 * time.Hour
+
+// Health detail states. A warning keeps the datasource usable, unlike an error.
+const (
+	healthOK      = "ok"
+	healthWarning = "warning"
+	healthError   = "error"
+)
+
+// healthDetails is the CheckHealth JSONDetails. Grafana shows Message below
+// the result.
+type healthDetails struct {
+	Status       string                    `json:"status"`
+	Message      string                    `json:"message,omitempty"`
+	Version      string                    `json:"version,omitempty"`
+	LatencyMs    int64                     `json:"latencyMs,omitempty"`
+	Database     *healthCheck              `json:"database,omitempty"`
+	Tables       []healthCheck             `json:"tables,omitempty"`
+	Certificates []certificateCheck        `json:"certificates,omitempty"`
+	Endpoints    []greptime.EndpointStatus `json:"endpoints,omitempty"`
+	Warnings     []string                  `json:"warnings,omitempty"`
+}
+
+// healthCheck is the outcome of checking one database or table.
+type healthCheck struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// certificateCheck describes a certificate in use and when it expires.
+type certificateCheck struct {
+	Source   string    `json:"source"`
+	Subject  string    `json:"subject"`
+	NotAfter time.Time `json:"notAfter"`
+	DaysLeft int       `json:"daysLeft"`
+}
+
+// CheckHealth runs SELECT 1 against every endpoint, then reports the server
+// version, round-trip latency, whether the default database exists, whether
+// the configured logs and traces tables are readable, and certificates close
+// to expiry. Unreachable endpoints fail the check; the diagnostics only add
+// warnings.
+func (ds *GreptimeDatasource) CheckHealth(ctx context.Context, req *backend.CheckHealthRequest) (*backend.CheckHealthResult, error) {
+	forwarded := req.GetHTTPHeaders()
+	greptime.LogExecutedSQL("health", "SELECT 1")
+	statuses := ds.client.CheckEndpoints(ctx, forwarded)
+
+	details := healthDetails{Status: healthOK}
+	var healthy int
+	var failures []string
+	for _, status := range statuses {
+		if !status.Healthy {
+			log.DefaultLogger.Error("greptime health check failed", "endpoint", status.URL, "error", status.Error)
+			failures = append(failures, fmt.Sprintf("%s: %s", status.URL, status.Error))
+			continue
+		}
+		healthy++
+		if latency := status.Latency.Milliseconds(); details.LatencyMs == 0 || latency < details.LatencyMs {
+			details.LatencyMs = latency
+		}
+	}
+
+	result := &backend.CheckHealthResult{Status: backend.HealthStatusOk, Message: "Database connection OK"}
+	if len(statuses) > 1 {
+		details.Endpoints = statuses
+		result.Message = fmt.Sprintf("%d of %d endpoints OK", healthy, len(statuses))
+		if len(failures) > 0 {
+			result.Message += "; " + strings.Join(failures, "; ")
+			details.Warnings = append(details.Warnings, fmt.Sprintf("%d of %d endpoints are unreachable", len(failures), len(statuses)))
+		}
+	}
+
+	if healthy == 0 {
+		result.Status = backend.HealthStatusError
+		if len(statuses) == 1 {
+			result.Message = statuses[0].Error
+		}
+		details.Status = healthError
+		details.Warnings = nil
+	} else {
+		ds.diagnose(ctx, forwarded, &details)
+		if len(details.Warnings) > 0 {
+			details.Status = healthWarning
+			details.Message = strings.Join(details.Warnings, "\n")
+			result.Message += fmt.Sprintf(", with %d warning(s)", len(details.Warnings))
+		}
+	}
+
+	var err error
+	if result.JSONDetails, err = json.Marshal(details); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// diagnose fills in the version, database, table and certificate checks of
+// details, recording every problem as a warning.
+func (ds *GreptimeDatasource) diagnose(ctx context.Context, forwarded http.Header, details *healthDetails) {
+	warn := func(format string, args ...any) {
+		details.Warnings = append(details.Warnings, fmt.Sprintf(format, args...))
+	}
+
+	version, err := ds.client.ExecuteSQL(ctx, "SELECT version()", forwarded)
+	if err != nil {
+		warn("could not read the server version: %s", err)
+	} else {
+		details.Version = firstValue(version)
+		details.Certificates = append(details.Certificates, certificateChecks("server", version.PeerCertificates)...)
+	}
+
+	database := ds.defaultDatabase()
+	details.Database = &healthCheck{Name: database}
+	schemata, err := ds.client.ExecuteSQL(ctx, fmt.Sprintf(
+		"SELECT schema_name FROM information_schema.schemata WHERE schema_name = '%s'", strings.ReplaceAll(database, "'", "''")), forwarded)
+	switch {
+	case err != nil:
+		details.Database.Error = err.Error()
+		warn("could not check database %q: %s", database, err)
+	case firstValue(schemata) == "":
+		details.Database.Error = "database not found"
+		warn("default database %q does not exist", database)
+	default:
+		details.Database.OK = true
+	}
+
+	for _, table := range []struct{ kind, database, table string }{
+		{"logs", ds.settings.LogsDatabase, ds.settings.LogsTable},
+		{"traces", ds.settings.TracesDatabase, ds.settings.TracesTable},
+	} {
+		name := strings.TrimSpace(table.table)
+		if name == "" {
+			continue
+		}
+		db := strings.TrimSpace(table.database)
+		if db == "" {
+			db = database
+		}
+		check := healthCheck{Name: db + "." + name, OK: true}
+		sql := fmt.Sprintf("SELECT * FROM %s.%s LIMIT 0", quoteIdentifier(db), quoteIdentifier(name))
+		if _, err := ds.client.ExecuteSQL(ctx, sql, forwarded); err != nil {
+			check.OK, check.Error = false, err.Error()
+			warn("%s table %s is not readable: %s", table.kind, check.Name, err)
+		}
+		details.Tables = append(details.Tables, check)
+	}
+
+	if ds.settings.TlsClientAuth {
+		details.Certificates = append(details.Certificates, pemCertificateChecks("client", ds.settings.TlsClientCert)...)
+	}
+	if ds.settings.TlsAuthWithCACert {
+		details.Certificates = append(details.Certificates, pemCertificateChecks("ca", ds.settings.TlsCACert)...)
+	}
+	now := time.Now()
+	for _, cert := range details.Certificates {
+		switch {
+		case now.After(cert.NotAfter):
+			warn("%s certificate %q expired on %s", cert.Source, cert.Subject, cert.NotAfter.Format(time.DateOnly))
+		case cert.NotAfter.Sub(now) < certificateExpiryWarning:
+			warn("%s certificate %q expires in %d day(s), on %s", cert.Source, cert.Subject, cert.DaysLeft, cert.NotAfter.Format(time.DateOnly))
+		}
+	}
+}
+
+// defaultDatabase returns the configured default database or GreptimeDB's.
+func (ds *GreptimeDatasource) defaultDatabase() string {
+	if database := strings.TrimSpace(ds.settings.DefaultDatabase); database != "" {
+		return database
+	}
+	return greptime.DefaultDatabaseName
+}
+
+// firstValue returns the first cell of resp as a string, or "" when it has no rows.
+func firstValue(resp *greptime.Response) string {
+	frames, err := greptime.ResponseToFrames(resp, "")
+	if err != nil || len(frames) == 0 || len(frames[0].Fields) == 0 || frames[0].Rows() == 0 {
+		return ""
+	}
+	field := frames[0].Fields[0]
+	if v, ok := field.ConcreteAt(0); ok {
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+// certificateChecks describes the leaf certificate of a chain.
+func certificateChecks(source string, chain []*x509.Certificate) []certificateCheck {
+	if len(chain) == 0 {
+		return nil
+	}
+	return []certificateCheck{newCertificateCheck(source, chain[0], time.Now())}
+}
+
+// pemCertificateChecks describes the certificates of a PEM bundle.
+func pemCertificateChecks(source, bundle string) []certificateCheck {
+	var checks []certificateCheck
+	rest := []byte(bundle)
+	for {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			return checks
+		}
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			checks = append(checks, newCertificateCheck(source, cert, time.Now()))
+		}
+	}
+}
+
+func newCertificateCheck(source string, cert *x509.Certificate, now time.Time) certificateCheck {
+	subject := cert.Subject.CommonName
+	if subject == "" {
+		subject = cert.Subject.String()
+	}
+	return certificateCheck{
+		Source:   source,
+		Subject:  subject,
+		NotAfter: cert.NotAfter,
+		DaysLeft: int(cert.NotAfter.Sub(now).Hours() / 24),
+	}
+}
+
+// quoteIdentifier double-quotes a database or table name.
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -0,0 +1,167 @@
+package plugin
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// healthServer answers the CheckHealth statements; respond maps a statement
+// (without its query tag) to a /v1/sql body, nil meaning one row with 1.
+func healthServer(respond func(sql string) string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		sql := r.PostForm.Get("sql")
+		if _, rest, ok := strings.Cut(sql, "*/ "); ok {
+			sql = rest
+		}
+		body := respond(sql)
+		if body == "" {
+			body = `{"code":0,"output":[{"records":{"schema":{"column_schemas":[{"name":"1","data_type":"Int64"}]},"rows":[[1]]}}]}`
+		}
+		_, _ = w.Write([]byte(body))
+	}
+}
+
+func healthDetailsOf(t *testing.T, result *backend.CheckHealthResult) healthDetails {
+	t.Helper()
+	var details healthDetails
+	require.NoError(t, json.Unmarshal(result.JSONDetails, &details))
+	return details
+}
+
+func TestCheckHealth_Diagnostics(t *testing.T) {
+	var statements []string
+	ts := httptest.NewServer(healthServer(func(sql string) string {
+		statements = append(statements, sql)
+		switch {
+		case sql == "SELECT version()":
+			return `{"code":0,"output":[{"records":{"schema":{"column_schemas":[{"name":"version()","data_type":"String"}]},"rows":[["8.4.2-greptimedb-0.14.0"]]}}]}`
+		case strings.Contains(sql, `"otel"."traces"`):
+			return `{"code":4001,"error":"Table not found: greptime.otel.traces"}`
+		}
+		return ""
+	}))
+	defer ts.Close()
+
+	ds := newTestDatasource(t, Settings{
+		Host:            ts.URL,
+		DefaultDatabase: "metrics",
+		LogsTable:       "logs",
+		TracesDatabase:  "otel",
+		TracesTable:     "traces",
+		ResponseFormat:  "json",
+	})
+
+	health, err := ds.CheckHealth(context.Background(), &backend.CheckHealthRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, backend.HealthStatusOk, health.Status)
+	assert.Equal(t, "Database connection OK, with 1 warning(s)", health.Message)
+
+	details := healthDetailsOf(t, health)
+	assert.Equal(t, healthWarning, details.Status)
+	assert.Equal(t, "8.4.2-greptimedb-0.14.0", details.Version)
+	assert.Equal(t, &healthCheck{Name: "metrics", OK: true}, details.Database)
+	assert.Equal(t, []healthCheck{
+		{Name: "metrics.logs", OK: true},
+		{Name: "otel.traces", Error: `table "traces" not found in database "otel"`},
+	}, details.Tables)
+	assert.Equal(t, []string{`traces table otel.traces is not readable: table "traces" not found in database "otel"`}, details.Warnings)
+	assert.Equal(t, details.Warnings[0], details.Message)
+	assert.Contains(t, statements, `SELECT * FROM "metrics"."logs" LIMIT 0`)
+	assert.Contains(t, statements, "SELECT schema_name FROM information_schema.schemata WHERE schema_name = 'metrics'")
+}
+
+func TestCheckHealth_MissingDatabase(t *testing.T) {
+	ts := httptest.NewServer(healthServer(func(sql string) string {
+		if strings.Contains(sql, "information_schema.schemata") {
+			return `{"code":0,"output":[{"records":{"schema":{"column_schemas":[{"name":"schema_name","data_type":"String"}]},"rows":[]}}]}`
+		}
+		return ""
+	}))
+	defer ts.Close()
+
+	ds := newTestDatasource(t, Settings{Host: ts.URL, DefaultDatabase: "missing", ResponseFormat: "json"})
+
+	health, err := ds.CheckHealth(context.Background(), &backend.CheckHealthRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, backend.HealthStatusOk, health.Status)
+	details := healthDetailsOf(t, health)
+	assert.Equal(t, healthWarning, details.Status)
+	assert.False(t, details.Database.OK)
+	assert.Equal(t, []string{`default database "missing" does not exist`}, details.Warnings)
+}
+
+func TestCheckHealth_Failure(t *testing.T) {
+	ts, _ := makeMockServer("Internal Server Error", http.StatusInternalServerError)
+	defer ts.Close()
+
+	ds := newTestDatasource(t, Settings{Host: ts.URL})
+
+	health, err := ds.CheckHealth(context.Background(), &backend.CheckHealthRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, backend.HealthStatusError, health.Status)
+	details := healthDetailsOf(t, health)
+	assert.Equal(t, healthError, details.Status)
+	assert.Empty(t, details.Version)
+}
+
+// testCertificate returns a self-signed PEM certificate and key valid until notAfter.
+func testCertificate(t *testing.T, notAfter time.Time) (certPEM, keyPEM string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "grafana"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+func TestCheckHealth_Certificates(t *testing.T) {
+	ts := httptest.NewTLSServer(healthServer(func(string) string { return "" }))
+	defer ts.Close()
+
+	certPEM, keyPEM := testCertificate(t, time.Now().Add(10*24*time.Hour+time.Hour))
+	ds := newTestDatasource(t, Settings{
+		Host:               ts.URL,
+		InsecureSkipVerify: true,
+		TlsClientAuth:      true,
+		TlsClientCert:      certPEM,
+		TlsClientKey:       keyPEM,
+	})
+
+	health, err := ds.CheckHealth(context.Background(), &backend.CheckHealthRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, backend.HealthStatusOk, health.Status)
+
+	details := healthDetailsOf(t, health)
+	require.Len(t, details.Certificates, 2)
+	assert.Equal(t, "server", details.Certificates[0].Source)
+	assert.Equal(t, "client", details.Certificates[1].Source)
+	assert.Equal(t, 10, details.Certificates[1].DaysLeft)
+	require.Len(t, details.Warnings, 1)
+	assert.Contains(t, details.Warnings[0], `client certificate "grafana" expires in 10 day(s)`)
+}
@@ -0,0 +1,165 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+
+	"github.com/GreptimeTeam/greptimedb-grafana-datasource/pkg/greptime"
+)
+
+// inflightGroup collapses identical queries running at the same time into a
+// single upstream call, like golang.org/x/sync/singleflight, except that the
+// call is only cancelled once every caller waiting for it has gone away.
+type inflightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*inflightCall
+}
+
+// inflightCall is an upstream call and the callers waiting for it.
+type inflightCall struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int
+	encode  bool // a caller wants the encoded result, to cache it
+	taken   bool // resp has been handed to a caller
+	resp    *greptime.Response
+	entry   *cacheEntry // nil unless shared or encoded for the cache
+	err     error
+	panic   any // re-raised in every waiter, as singleflight does
+}
+
+// do runs fn once for all concurrent callers with the same key and returns
+// its result. fn runs under a context carrying the values of the first
+// caller's ctx that is cancelled when the last waiter's ctx is done.
+//
+// The first caller to collect the result gets the response fn returned
+// itself. The result is encoded only when several callers wait for it, each
+// of the others decoding its own copy, or when a caller sets encode; the
+// entry is returned to every caller in that case and is nil otherwise.
+func (g *inflightGroup) do(ctx context.Context, key string, encode bool, fn func(ctx context.Context) (*greptime.Response, error)) (*greptime.Response, *cacheEntry, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = map[string]*inflightCall{}
+	}
+	call, ok := g.calls[key]
+	if ok {
+		call.waiters++
+		call.encode = call.encode || encode
+	} else {
+		callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		call = &inflightCall{done: make(chan struct{}), cancel: cancel, waiters: 1, encode: encode}
+		g.calls[key] = call
+		go func() {
+			defer cancel()
+			defer func() {
+				if r := recover(); r != nil {
+					g.mu.Lock()
+					call.panic = r
+					g.forget(key, call)
+					g.mu.Unlock()
+				}
+				close(call.done)
+			}()
+			resp, err := fn(callCtx)
+
+			// No caller joins once the call is forgotten, so the waiters
+			// counted here are all that will collect the result.
+			g.mu.Lock()
+			g.forget(key, call)
+			shared := err == nil && (call.waiters > 1 || call.encode)
+			g.mu.Unlock()
+			if shared {
+				if call.entry, err = encodeResult(resp); err != nil {
+					err = backend.PluginError(err)
+				}
+			}
+			call.resp, call.err = resp, err
+		}()
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+		if call.panic != nil {
+			panic(call.panic)
+		}
+		if call.err != nil {
+			return nil, nil, call.err
+		}
+		g.mu.Lock()
+		first := !call.taken
+		call.taken = true
+		g.mu.Unlock()
+		if first {
+			return call.resp, call.entry, nil
+		}
+		resp, err := call.entry.decode()
+		if err != nil {
+			return nil, nil, backend.PluginError(err)
+		}
+		return resp, call.entry, nil
+	case <-ctx.Done():
+		g.mu.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			call.cancel()
+			// Later callers must not join a cancelled call.
+			g.forget(key, call)
+		}
+		g.mu.Unlock()
+		return nil, nil, ctx.Err()
+	}
+}
+
+// forget removes call from the group if it is still registered under key;
+// g.mu must be held.
+func (g *inflightGroup) forget(key string, call *inflightCall) {
+	if g.calls[key] == call {
+		delete(g.calls, key)
+	}
+}
+
+// encodeResult encodes the frames of resp. ResponseToFrames names the frames
+// and appends notices to them, so it runs on copies of the outputs and
+// frames, leaving resp as the client returned it for the caller handed it.
+func encodeResult(resp *greptime.Response) (*cacheEntry, error) {
+	view := *resp
+	view.Output = slices.Clone(resp.Output)
+	for i, output := range view.Output {
+		if output.Frame == nil {
+			continue
+		}
+		frame := *output.Frame
+		if frame.Meta != nil {
+			meta := *frame.Meta
+			meta.Notices = slices.Clip(meta.Notices)
+			frame.Meta = &meta
+		}
+		view.Output[i].Frame = &frame
+	}
+	frames, err := greptime.ResponseToFrames(&view, "")
+	if err != nil {
+		return nil, err
+	}
+	return newCacheEntry(resp, frames)
+}
+
+// execute runs sql. Read-only statements go through the in-flight group, so
+// identical concurrent queries share one upstream call. The returned entry is
+// the encoded result when it was shared or encode is set, nil otherwise.
+func (ds *GreptimeDatasource) execute(ctx context.Context, refID, sql string, model queryModel, forwarded http.Header, encode bool) (*greptime.Response, *cacheEntry, error) {
+	if !greptime.IsReadOnlyStatement(sql) {
+		greptime.LogExecutedSQL(refID, sql)
+		resp, err := ds.client.ExecuteSQL(ctx, sql, forwarded)
+		return resp, nil, err
+	}
+
+	return ds.inflight.do(ctx, ds.resultKey(sql, model, forwarded), encode, func(ctx context.Context) (*greptime.Response, error) {
+		greptime.LogExecutedSQL(refID, sql)
+		return ds.client.ExecuteSQL(ctx, sql, forwarded)
+	})
+}
@@ -0,0 +1,199 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GreptimeTeam/greptimedb-grafana-datasource/pkg/greptime"
+)
+
+// waiting returns how many callers wait for in-flight calls.
+func (g *inflightGroup) waiting() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	n := 0
+	for _, call := range g.calls {
+		n += call.waiters
+	}
+	return n
+}
+
+func TestQueryData_DeduplicatesInflight(t *testing.T) {
+	var requests atomic.Int32
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		_, _ = w.Write([]byte(`{"code":0,"output":[{"records":{"schema":{"column_schemas":[{"name":"v","data_type":"Float64"}]},"rows":[[1.5],[2.5]]}}]}`))
+	}))
+	defer ts.Close()
+
+	ds := newTestDatasource(t, Settings{Host: ts.URL, ResponseFormat: "json"})
+
+	const viewers = 5
+	responses := make([]backend.DataResponse, viewers)
+	var wg sync.WaitGroup
+	for i := range viewers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+				Queries: []backend.DataQuery{makeDataQuery("A", "SELECT v FROM cpu", "sql", "table", nil)},
+			})
+			if assert.NoError(t, err) {
+				responses[i] = resp.Responses["A"]
+			}
+		}()
+	}
+	require.Eventually(t, func() bool { return ds.inflight.waiting() == viewers }, 5*time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), requests.Load())
+	for i, dr := range responses {
+		require.NoError(t, dr.Error)
+		require.Len(t, dr.Frames, 1)
+		v, _ := dr.Frames[0].Fields[0].ConcreteAt(1)
+		assert.Equal(t, 2.5, v, i)
+	}
+	// Every caller owns its frames.
+	responses[0].Frames[0].Fields[0].Set(1, ptr(9.0))
+	v, _ := responses[1].Frames[0].Fields[0].ConcreteAt(1)
+	assert.Equal(t, 2.5, v)
+
+	// Once done, the same query runs again.
+	_, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+		Queries: []backend.DataQuery{makeDataQuery("A", "SELECT v FROM cpu", "sql", "table", nil)},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), requests.Load())
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func TestInflightGroup_Cancellation(t *testing.T) {
+	var g inflightGroup
+	var calls atomic.Int32
+	cancelled := make(chan struct{})
+	fn := func(ctx context.Context) (*greptime.Response, error) {
+		calls.Add(1)
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	}
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	go func() { _, _, err := g.do(ctx1, "k", false, fn); errs <- err }()
+	require.Eventually(t, func() bool { return g.waiting() == 1 }, 5*time.Second, time.Millisecond)
+	go func() { _, _, err := g.do(ctx2, "k", false, fn); errs <- err }()
+	require.Eventually(t, func() bool { return g.waiting() == 2 }, 5*time.Second, time.Millisecond)
+
+	// The first caller leaving does not cancel the shared call.
+	cancel1()
+	require.ErrorIs(t, <-errs, context.Canceled)
+	select {
+	case <-cancelled:
+		t.Fatal("upstream call cancelled while a caller still waits")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// The last one does.
+	cancel2()
+	require.ErrorIs(t, <-errs, context.Canceled)
+	<-cancelled
+	assert.Equal(t, int32(1), calls.Load())
+
+	// A new caller starts a fresh call rather than joining the cancelled one.
+	resp, _, err := g.do(context.Background(), "k", false, func(context.Context) (*greptime.Response, error) {
+		return &greptime.Response{}, nil
+	})
+	require.NoError(t, err)
+	assert.NotNil(t, resp)
+}
+
+func TestInflightGroup_EncodesOnlyWhenShared(t *testing.T) {
+	var g inflightGroup
+	result := func() *greptime.Response {
+		return &greptime.Response{Output: []greptime.Output{{Frame: data.NewFrame("", data.NewField("v", nil, []float64{1.5}))}}}
+	}
+
+	// A single caller gets the response itself, never encoded.
+	want := result()
+	resp, entry, err := g.do(context.Background(), "k", false, func(context.Context) (*greptime.Response, error) {
+		return want, nil
+	})
+	require.NoError(t, err)
+	assert.Same(t, want, resp)
+	assert.Nil(t, entry)
+
+	// A caller that caches the result gets it encoded, and its own frames
+	// untouched by the encoding.
+	want = result()
+	resp, entry, err = g.do(context.Background(), "k", true, func(context.Context) (*greptime.Response, error) {
+		return want, nil
+	})
+	require.NoError(t, err)
+	assert.Same(t, want, resp)
+	require.NotNil(t, entry)
+	assert.Equal(t, "", resp.Output[0].Frame.Name)
+	assert.Nil(t, resp.Output[0].Frame.Meta)
+
+	// Callers sharing a call get one response itself and decoded copies.
+	release := make(chan struct{})
+	want = result()
+	fn := func(context.Context) (*greptime.Response, error) {
+		<-release
+		return want, nil
+	}
+	responses := make(chan *greptime.Response, 2)
+	for range 2 {
+		go func() {
+			resp, entry, err := g.do(context.Background(), "k", false, fn)
+			assert.NoError(t, err)
+			assert.NotNil(t, entry)
+			responses <- resp
+		}()
+	}
+	require.Eventually(t, func() bool { return g.waiting() == 2 }, 5*time.Second, time.Millisecond)
+	close(release)
+	first, second := <-responses, <-responses
+	if second == want {
+		first, second = second, first
+	}
+	assert.Same(t, want, first)
+	assert.NotSame(t, want, second)
+	assert.NotSame(t, first.Output[0].Frame, second.Output[0].Frame)
+}
+
+func BenchmarkExecute_SingleCaller(b *testing.B) {
+	rows := strings.Repeat("[1.5],", 9999) + "[2.5]"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"code":0,"output":[{"records":{"schema":{"column_schemas":[{"name":"v","data_type":"Float64"}]},"rows":[` + rows + `]}}]}`))
+	}))
+	defer ts.Close()
+
+	ds := newTestDatasource(b, Settings{Host: ts.URL, ResponseFormat: "json"})
+	b.ReportAllocs()
+	for range b.N {
+		_, entry, err := ds.execute(context.Background(), "A", "SELECT v FROM cpu", queryModel{}, nil, false)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if entry != nil {
+			b.Fatal("single caller result was encoded")
+		}
+	}
+}
@@ -4,12 +4,16 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/proxy"
+
+	"github.com/GreptimeTeam/greptimedb-grafana-datasource/pkg/greptime"
+	"github.com/GreptimeTeam/greptimedb-grafana-datasource/pkg/macros"
 )
 
 // Settings - data loaded from grafana settings database
@@ -19,6 +23,9 @@ type Settings struct {
 	Protocol string `json:"protocol"`
 	Secure   bool   `json:"secure,omitempty"`
 	Path     string `json:"path,omitempty"`
+	// Version is the plugin version the config editor last saved these
+	// settings with; provisioned datasources set it themselves, if at all.
+	Version string `json:"version,omitempty"`
 
 	InsecureSkipVerify bool `json:"tlsSkipVerify,omitempty"`
 	TlsClientAuth      bool `json:"tlsAuth,omitempty"`
@@ -27,13 +34,33 @@ type Settings struct {
 	TlsCACert          string
 	TlsClientKey       string
 
-	Username string `json:"username,omitempty"`
-	Password string `json:"-,omitempty"`
+	// AuthMode is "basic" (default), "bearer" (BearerToken) or "oauth"
+	// (the signed-in user's forwarded Authorization header).
+	AuthMode    string `json:"authMode,omitempty"`
+	Username    string `json:"username,omitempty"`
+	Password    string `json:"-,omitempty"`
+	BearerToken string `json:"-"`
 
 	DefaultDatabase string `json:"defaultDatabase,omitempty"`
+	// AllowedDatabases are the databases queries may select besides DefaultDatabase.
+	AllowedDatabases []string `json:"allowedDatabases,omitempty"`
+	// Timezone is the session timezone of queries that carry no dashboard
+	// timezone, e.g. alert rules; empty keeps the server default.
+	Timezone string `json:"timezone,omitempty"`
+
+	// Endpoints are additional frontends ("host:port" or URLs) queried alongside Host.
+	Endpoints []string `json:"endpoints,omitempty"`
+	// EndpointSelection is "round-robin" (default) or "least-latency".
+	EndpointSelection string `json:"endpointSelection,omitempty"`
 
 	// LogsContextColumns are datasource-config columns copied into LogLines labels.
 	LogsContextColumns []string `json:"-"`
+	// LogsTable and TracesTable are the configured default tables, checked by
+	// CheckHealth; the database is empty when it defaults to DefaultDatabase.
+	LogsDatabase   string `json:"-"`
+	LogsTable      string `json:"-"`
+	TracesDatabase string `json:"-"`
+	TracesTable    string `json:"-"`
 
 	ConnMaxLifetime string `json:"connMaxLifetime,omitempty"`
 	DialTimeout     string `json:"dialTimeout,omitempty"`
@@ -41,25 +68,111 @@ type Settings struct {
 	MaxIdleConns    string `json:"maxIdleConns,omitempty"`
 	MaxOpenConns    string `json:"maxOpenConns,omitempty"`
 
+	// Retry policy for read-only statements. Backoffs are in milliseconds and
+	// RetryStatusCodes is a comma-separated list; empty values use the client defaults.
+	RetryMaxAttempts string `json:"retryMaxAttempts,omitempty"`
+	RetryBackoff     string `json:"retryBackoff,omitempty"`
+	RetryMaxBackoff  string `json:"retryMaxBackoff,omitempty"`
+	RetryStatusCodes string `json:"retryStatusCodes,omitempty"`
+
+	// Result cache: CacheTTL in seconds (empty or 0 disables it) and
+	// CacheMaxSize, its memory cap in megabytes.
+	CacheTTL     string `json:"cacheTTL,omitempty"`
+	CacheMaxSize string `json:"cacheMaxSize,omitempty"`
+
 	HttpHeaders           map[string]string `json:"-"`
 	ForwardGrafanaHeaders bool              `json:"forwardGrafanaHeaders,omitempty"`
 	CustomSettings        []CustomSetting   `json:"customSettings"`
 	ProxyOptions          *proxy.Options
 
 	RowLimit int64 `json:"rowLimit,omitempty"`
+
+	// ResponseFormat is the /v1/sql body format: "arrow" (default) or "json" as a fallback.
+	ResponseFormat string `json:"responseFormat,omitempty"`
+
+	// MaxResponseBytes caps the bytes read from a /v1/sql body; zero means unlimited.
+	MaxResponseBytes int64 `json:"maxResponseBytes,omitempty"`
 }
 
+// CustomSetting is a GreptimeDB query hint, e.g. read_preference=leader,
+// sent with every request.
 type CustomSetting struct {
 	Setting string `json:"setting"`
 	Value   string `json:"value"`
 }
 
+// Hints returns CustomSettings as query hints; later settings win.
+func (settings *Settings) Hints() map[string]string {
+	if len(settings.CustomSettings) == 0 {
+		return nil
+	}
+	hints := make(map[string]string, len(settings.CustomSettings))
+	for _, setting := range settings.CustomSettings {
+		hints[strings.TrimSpace(setting.Setting)] = strings.TrimSpace(setting.Value)
+	}
+	return hints
+}
+
 const secureHeaderKeyPrefix = "secureHttpHeaders."
 
+// Protocols accepted in the protocol setting; empty means ProtocolHTTP.
+const (
+	ProtocolNative   = "native" // Arrow Flight over gRPC
+	ProtocolHTTP     = "http"
+	ProtocolPostgres = "postgres"
+)
+
+// nativeFlightVersion is the first plugin version whose "native" protocol is
+// Arrow Flight. Earlier config editors saved "native" on every datasource,
+// all of which queried over HTTP.
+const nativeFlightVersion = "3.1.0"
+
+// defaultMaxOpenConns is the MaxOpenConns used when the setting is empty.
+const defaultMaxOpenConns = 50
+
+// isAllowedDatabase reports whether a query may run in database: the default
+// database always is, others must be listed in AllowedDatabases.
+func (settings *Settings) isAllowedDatabase(database string) bool {
+	defaultDatabase := strings.TrimSpace(settings.DefaultDatabase)
+	if defaultDatabase == "" {
+		defaultDatabase = greptime.DefaultDatabaseName
+	}
+	return database == defaultDatabase || slices.Contains(settings.AllowedDatabases, database)
+}
+
 func (settings *Settings) isValid() (err error) {
 	if strings.TrimSpace(settings.Host) == "" {
 		return backend.DownstreamError(ErrorMessageInvalidHost)
 	}
+	switch settings.Protocol {
+	case "", ProtocolHTTP, ProtocolNative, ProtocolPostgres:
+	default:
+		return backend.DownstreamError(ErrorMessageInvalidProtocol)
+	}
+	switch settings.AuthMode {
+	case "", greptime.AuthModeBasic:
+	case greptime.AuthModeBearer, greptime.AuthModeOAuth:
+		if settings.Transport() == ProtocolPostgres {
+			return backend.DownstreamError(ErrorMessageAuthModeUnsupported)
+		}
+		if settings.AuthMode == greptime.AuthModeBearer && strings.TrimSpace(settings.BearerToken) == "" {
+			return backend.DownstreamError(ErrorMessageInvalidBearerToken)
+		}
+	default:
+		return backend.DownstreamError(ErrorMessageInvalidAuthMode)
+	}
+	for name, value := range settings.Hints() {
+		if err := greptime.ValidateHint(name, value); err != nil {
+			return backend.DownstreamError(fmt.Errorf("%w: %w", ErrorMessageInvalidCustomSetting, err))
+		}
+	}
+	if _, err := macros.LoadTimezone(settings.Timezone); err != nil {
+		return backend.DownstreamError(fmt.Errorf("%w: %w", ErrorMessageInvalidTimezone, err))
+	}
+	if settings.Transport() != ProtocolHTTP {
+		// The gRPC and PostgreSQL ports have defaults.
+		return nil
+	}
 	host := strings.TrimSpace(settings.Host)
 	if !strings.HasPrefix(host, "http://") && !strings.HasPrefix(host, "https://") && settings.Port == 0 {
 		return backend.DownstreamError(ErrorMessageInvalidPort)
@@ -95,6 +208,12 @@ func LoadSettings(ctx context.Context, config backend.DataSourceInstanceSettings
 	if jsonData["protocol"] != nil {
 		settings.Protocol = jsonData["protocol"].(string)
 	}
+	if jsonData["version"] != nil {
+		settings.Version, _ = jsonData["version"].(string)
+	}
+	if jsonData["authMode"] != nil {
+		settings.AuthMode = jsonData["authMode"].(string)
+	}
 	if jsonData["secure"] != nil {
 		if secure, ok := jsonData["secure"].(string); ok {
 			settings.Secure, err = strconv.ParseBool(secure)
@@ -144,7 +263,28 @@ func LoadSettings(ctx context.Context, config backend.DataSourceInstanceSettings
 		settings.DefaultDatabase = jsonData["defaultDatabase"].(string)
 	}
 
+	switch databases := jsonData["allowedDatabases"].(type) {
+	case []interface{}:
+		for _, raw := range databases {
+			if database, ok := raw.(string); ok && strings.TrimSpace(database) != "" {
+				settings.AllowedDatabases = append(settings.AllowedDatabases, strings.TrimSpace(database))
+			}
+		}
+	case string:
+		for _, database := range strings.Split(databases, ",") {
+			if strings.TrimSpace(database) != "" {
+				settings.AllowedDatabases = append(settings.AllowedDatabases, strings.TrimSpace(database))
+			}
+		}
+	}
+
+	if jsonData["timezone"] != nil {
+		settings.Timezone = strings.TrimSpace(jsonData["timezone"].(string))
+	}
+
 	if logsRaw, ok := jsonData["logs"].(map[string]interface{}); ok {
+		settings.LogsDatabase, _ = logsRaw["defaultDatabase"].(string)
+		settings.LogsTable, _ = logsRaw["defaultTable"].(string)
 		if cols, ok := logsRaw["contextColumns"].([]interface{}); ok {
 			for _, c := range cols {
 				if s, ok := c.(string); ok && s != "" {
@@ -154,6 +294,11 @@ func LoadSettings(ctx context.Context, config backend.DataSourceInstanceSettings
 		}
 	}
 
+	if tracesRaw, ok := jsonData["traces"].(map[string]interface{}); ok {
+		settings.TracesDatabase, _ = tracesRaw["defaultDatabase"].(string)
+		settings.TracesTable, _ = tracesRaw["defaultTable"].(string)
+	}
+
 	// Deprecated: Replaced with DialTimeout for v4. Deserializes "timeout" field for old v3 configs.
 	if jsonData["timeout"] != nil {
 		settings.DialTimeout = jsonData["timeout"].(string)
@@ -162,6 +307,24 @@ func LoadSettings(ctx context.Context, config backend.DataSourceInstanceSettings
 		settings.DialTimeout = jsonData["dialTimeout"].(string)
 	}
 
+	switch endpoints := jsonData["endpoints"].(type) {
+	case []interface{}:
+		for _, raw := range endpoints {
+			if endpoint, ok := raw.(string); ok && strings.TrimSpace(endpoint) != "" {
+				settings.Endpoints = append(settings.Endpoints, strings.TrimSpace(endpoint))
+			}
+		}
+	case string:
+		for _, endpoint := range strings.FieldsFunc(endpoints, func(r rune) bool { return r == ',' || r == '\n' }) {
+			if strings.TrimSpace(endpoint) != "" {
+				settings.Endpoints = append(settings.Endpoints, strings.TrimSpace(endpoint))
+			}
+		}
+	}
+	if jsonData["endpointSelection"] != nil {
+		settings.EndpointSelection = jsonData["endpointSelection"].(string)
+	}
+
 	if jsonData["queryTimeout"] != nil {
 		if val, ok := jsonData["queryTimeout"].(string); ok {
 			settings.QueryTimeout = val
@@ -170,6 +333,21 @@ func LoadSettings(ctx context.Context, config backend.DataSourceInstanceSettings
 			settings.QueryTimeout = fmt.Sprintf("%d", int64(val))
 		}
 	}
+	for key, target := range map[string]*string{
+		"retryMaxAttempts": &settings.RetryMaxAttempts,
+		"retryBackoff":     &settings.RetryBackoff,
+		"retryMaxBackoff":  &settings.RetryMaxBackoff,
+		"retryStatusCodes": &settings.RetryStatusCodes,
+		"cacheTTL":         &settings.CacheTTL,
+		"cacheMaxSize":     &settings.CacheMaxSize,
+	} {
+		switch val := jsonData[key].(type) {
+		case string:
+			*target = val
+		case float64:
+			*target = fmt.Sprintf("%d", int64(val))
+		}
+	}
 	if jsonData["customSettings"] != nil {
 		customSettingsRaw := jsonData["customSettings"].([]interface{})
 		customSettings := make([]CustomSetting, len(customSettingsRaw))
@@ -184,6 +362,35 @@ func LoadSettings(ctx context.Context, config backend.DataSourceInstanceSettings
 
 		settings.CustomSettings = customSettings
 	}
+	// Per-datasource row limit; overrides Grafana's [sql] row_limit when positive.
+	var rowLimitOverride int64
+	if jsonData["rowLimit"] != nil {
+		if rowLimit, ok := jsonData["rowLimit"].(string); ok {
+			if strings.TrimSpace(rowLimit) != "" {
+				rowLimitOverride, err = strconv.ParseInt(strings.TrimSpace(rowLimit), 10, 64)
+				if err != nil {
+					return settings, backend.DownstreamError(fmt.Errorf("could not parse rowLimit value: %w", err))
+				}
+			}
+		} else {
+			rowLimitOverride = int64(jsonData["rowLimit"].(float64))
+		}
+	}
+	if jsonData["maxResponseBytes"] != nil {
+		if maxResponseBytes, ok := jsonData["maxResponseBytes"].(string); ok {
+			if strings.TrimSpace(maxResponseBytes) != "" {
+				settings.MaxResponseBytes, err = strconv.ParseInt(strings.TrimSpace(maxResponseBytes), 10, 64)
+				if err != nil {
+					return settings, backend.DownstreamError(fmt.Errorf("could not parse maxResponseBytes value: %w", err))
+				}
+			}
+		} else {
+			settings.MaxResponseBytes = int64(jsonData["maxResponseBytes"].(float64))
+		}
+	}
+	if jsonData["responseFormat"] != nil {
+		settings.ResponseFormat = jsonData["responseFormat"].(string)
+	}
 	if jsonData["forwardGrafanaHeaders"] != nil {
 		if forwardGrafanaHeaders, ok := jsonData["forwardGrafanaHeaders"].(string); ok {
 			settings.ForwardGrafanaHeaders, err = strconv.ParseBool(forwardGrafanaHeaders)
@@ -209,7 +416,7 @@ func LoadSettings(ctx context.Context, config backend.DataSourceInstanceSettings
 		settings.MaxIdleConns = "25"
 	}
 	if strings.TrimSpace(settings.MaxOpenConns) == "" {
-		settings.MaxOpenConns = "50"
+		settings.MaxOpenConns = strconv.Itoa(defaultMaxOpenConns)
 	}
 
 	// Auth credentials come from Grafana's standard Basic Auth fields
@@ -220,6 +427,9 @@ func LoadSettings(ctx context.Context, config backend.DataSourceInstanceSettings
 			settings.Password = basicAuthPassword
 		}
 	}
+	if bearerToken, ok := config.DecryptedSecureJSONData["bearerToken"]; ok {
+		settings.BearerToken = bearerToken
+	}
 
 	tlsCACert, ok := config.DecryptedSecureJSONData["tlsCACert"]
 	if ok {
@@ -255,6 +465,9 @@ func LoadSettings(ctx context.Context, config backend.DataSourceInstanceSettings
 	}
 
 	settings.RowLimit = sqlCfg.RowLimit
+	if rowLimitOverride > 0 {
+		settings.RowLimit = rowLimitOverride
+	}
 
 	return settings, settings.isValid()
 }
@@ -47,7 +47,7 @@ func TestLoadSettings(t *testing.T) {
 							"defaultDatabase":"example", "tlsSkipVerify": true, "tlsAuth" : true,
 							"tlsAuthWithCACert": true, "dialTimeout": "10", "enableSecureSocksProxy": true,
 							"httpHeaders": [{ "name": " test-plain-1 ", "value": "value-1", "secure": false }],
-							"forwardGrafanaHeaders": true
+							"forwardGrafanaHeaders": true, "responseFormat": "json", "maxResponseBytes": "1048576"
 						}`),
 						DecryptedSecureJSONData: map[string]string{
 							"basicAuthPassword": "bar",
@@ -94,7 +94,9 @@ func TestLoadSettings(t *testing.T) {
 							KeepAlive: proxy.DefaultTimeoutOptions.KeepAlive,
 						},
 					},
-					RowLimit: 1000000,
+					RowLimit:         1000000,
+					ResponseFormat:   "json",
+					MaxResponseBytes: 1048576,
 				},
 				wantErr: nil,
 				testCtx: ctx,
@@ -232,6 +234,124 @@ func TestLoadSettings(t *testing.T) {
 				wantErr: nil,
 				testCtx: ctx,
 			},
+			{
+				name: "should let the datasource row limit override Grafana's",
+				args: args{
+					config: backend.DataSourceInstanceSettings{
+						JSONData:                []byte(`{"host": "http://localhost:4000", "rowLimit": 500}`),
+						DecryptedSecureJSONData: map[string]string{},
+					},
+				},
+				wantSettings: Settings{
+					Host:            "http://localhost:4000",
+					ConnMaxLifetime: "5",
+					DialTimeout:     "10",
+					MaxIdleConns:    "25",
+					MaxOpenConns:    "50",
+					QueryTimeout:    "60",
+					HttpHeaders:     map[string]string{},
+					RowLimit:        500,
+				},
+				wantErr: nil,
+				testCtx: ctx,
+			},
+			{
+				name: "should read additional endpoints",
+				args: args{
+					config: backend.DataSourceInstanceSettings{
+						JSONData: []byte(`{"host": "db-1", "port": 4000, "endpoints": ["db-2", " db-3:4010 ", ""],
+							"endpointSelection": "least-latency"}`),
+						DecryptedSecureJSONData: map[string]string{},
+					},
+				},
+				wantSettings: Settings{
+					Host:              "db-1",
+					Port:              4000,
+					Endpoints:         []string{"db-2", "db-3:4010"},
+					EndpointSelection: "least-latency",
+					ConnMaxLifetime:   "5",
+					DialTimeout:       "10",
+					MaxIdleConns:      "25",
+					MaxOpenConns:      "50",
+					QueryTimeout:      "60",
+					HttpHeaders:       map[string]string{},
+					RowLimit:          1000000,
+				},
+				wantErr: nil,
+				testCtx: ctx,
+			},
+			{
+				name: "should read the retry policy",
+				args: args{
+					config: backend.DataSourceInstanceSettings{
+						JSONData: []byte(`{"host": "http://localhost:4000", "retryMaxAttempts": 5, "retryBackoff": "100",
+							"retryMaxBackoff": 1500, "retryStatusCodes": "502, 503"}`),
+						DecryptedSecureJSONData: map[string]string{},
+					},
+				},
+				wantSettings: Settings{
+					Host:             "http://localhost:4000",
+					ConnMaxLifetime:  "5",
+					DialTimeout:      "10",
+					MaxIdleConns:     "25",
+					MaxOpenConns:     "50",
+					QueryTimeout:     "60",
+					RetryMaxAttempts: "5",
+					RetryBackoff:     "100",
+					RetryMaxBackoff:  "1500",
+					RetryStatusCodes: "502, 503",
+					HttpHeaders:      map[string]string{},
+					RowLimit:         1000000,
+				},
+				wantErr: nil,
+				testCtx: ctx,
+			},
+			{
+				name: "should read the bearer token auth mode",
+				args: args{
+					config: backend.DataSourceInstanceSettings{
+						JSONData:                []byte(`{"host": "http://localhost:4000", "authMode": "bearer"}`),
+						DecryptedSecureJSONData: map[string]string{"bearerToken": "token"},
+					},
+				},
+				wantSettings: Settings{
+					Host:            "http://localhost:4000",
+					AuthMode:        "bearer",
+					BearerToken:     "token",
+					ConnMaxLifetime: "5",
+					DialTimeout:     "10",
+					MaxIdleConns:    "25",
+					MaxOpenConns:    "50",
+					QueryTimeout:    "60",
+					HttpHeaders:     map[string]string{},
+					RowLimit:        1000000,
+				},
+				wantErr: nil,
+				testCtx: ctx,
+			},
+			{
+				name: "should read the allowed databases",
+				args: args{
+					config: backend.DataSourceInstanceSettings{
+						JSONData:                []byte(`{"host": "http://localhost:4000", "defaultDatabase": "metrics", "allowedDatabases": "logs, traces,"}`),
+						DecryptedSecureJSONData: map[string]string{},
+					},
+				},
+				wantSettings: Settings{
+					Host:             "http://localhost:4000",
+					DefaultDatabase:  "metrics",
+					AllowedDatabases: []string{"logs", "traces"},
+					ConnMaxLifetime:  "5",
+					DialTimeout:      "10",
+					MaxIdleConns:     "25",
+					MaxOpenConns:     "50",
+					QueryTimeout:     "60",
+					HttpHeaders:      map[string]string{},
+					RowLimit:         1000000,
+				},
+				wantErr: nil,
+				testCtx: ctx,
+			},
 		}
 		for _, tt := range tests {
 			t.Run(tt.name, func(t *testing.T) {
@@ -261,6 +381,19 @@ func TestLoadSettings(t *testing.T) {
 			{jsonData: `{ "host": "", "port": 443 }`, password: "", wantErr: ErrorMessageInvalidHost, description: "should capture empty server name"},
 			{jsonData: `{ "host": "foo" }`, password: "", wantErr: ErrorMessageInvalidPort, description: "should capture nil port"},
 			{jsonData: `  "host": "foo", "port": 443, "username" : "foo" }`, password: "", wantErr: ErrorMessageInvalidJSON, description: "should capture invalid json"},
+			{jsonData: `{ "host": "foo", "port": 443, "protocol": "grpc" }`, password: "", wantErr: ErrorMessageInvalidProtocol, description: "should capture unknown protocol"},
+			{jsonData: `{ "host": "foo", "protocol": "native", "version": "3.1.0" }`, password: "", wantErr: nil, description: "should default the native port"},
+			{jsonData: `{ "host": "foo", "protocol": "native" }`, password: "", wantErr: ErrorMessageInvalidPort, description: "should treat native without a version as http"},
+			{jsonData: `{ "host": "foo", "protocol": "native", "version": "3.0.2" }`, password: "", wantErr: ErrorMessageInvalidPort, description: "should treat native saved by older editors as http"},
+			{jsonData: `{ "host": "foo", "protocol": "postgres" }`, password: "", wantErr: nil, description: "should default the postgres port"},
+			{jsonData: `{ "host": "foo", "port": 443, "authMode": "token" }`, password: "", wantErr: ErrorMessageInvalidAuthMode, description: "should capture unknown auth mode"},
+			{jsonData: `{ "host": "foo", "port": 443, "authMode": "bearer" }`, password: "", wantErr: ErrorMessageInvalidBearerToken, description: "should capture missing bearer token"},
+			{jsonData: `{ "host": "foo", "protocol": "postgres", "authMode": "oauth" }`, password: "", wantErr: ErrorMessageAuthModeUnsupported, description: "should capture oauth over postgres"},
+			{jsonData: `{ "host": "foo", "port": 443, "timezone": "Mars/Olympus" }`, password: "", wantErr: ErrorMessageInvalidTimezone, description: "should capture unknown timezone"},
+			{jsonData: `{ "host": "foo", "port": 443, "timezone": "Asia/Shanghai" }`, password: "", wantErr: nil, description: "should accept an IANA timezone"},
+			{jsonData: `{ "host": "foo", "port": 443, "customSettings": [{"setting": "Read-Preference", "value": "leader"}] }`, password: "", wantErr: ErrorMessageInvalidCustomSetting, description: "should capture invalid hint names"},
+			{jsonData: `{ "host": "foo", "port": 443, "customSettings": [{"setting": "ttl", "value": "7d,append_mode=true"}] }`, password: "", wantErr: ErrorMessageInvalidCustomSetting, description: "should capture hint values with separators"},
+			{jsonData: `{ "host": "foo", "port": 443, "customSettings": [{"setting": " read_preference ", "value": "leader"}] }`, password: "", wantErr: nil, description: "should accept valid hints"},
 		}
 		for i, tc := range tests {
 			t.Run(fmt.Sprintf("[%v/%v] %s", i+1, len(tests), tc.description), func(t *testing.T) {
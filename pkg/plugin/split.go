@@ -0,0 +1,158 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/gtime"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/pkg/errors"
+
+	"github.com/GreptimeTeam/greptimedb-grafana-datasource/pkg/greptime"
+	"github.com/GreptimeTeam/greptimedb-grafana-datasource/pkg/macros"
+)
+
+// splitRanges returns the chunks a query with SplitDuration runs over, and
+// the interval every chunk is interpolated with: that of the whole range, so
+// $__interval and date_bin buckets do not shrink with the chunks. It returns
+// no ranges for queries that are not split: without SplitDuration, EXPLAIN
+// queries, SQL that does not filter on the time range through macros and SQL
+// whose chunk results cannot be joined (see greptime.CanSplitSQL), which runs
+// over the whole range at once.
+func (ds *GreptimeDatasource) splitRanges(query backend.DataQuery, model queryModel) ([]backend.TimeRange, time.Duration, error) {
+	split := strings.TrimSpace(model.SplitDuration)
+	if split == "" || greptime.ResolveQueryType(model) == greptime.QueryTypeExplain || !macros.UsesTimeRange(model.RawSQL) {
+		return nil, 0, nil
+	}
+	if !greptime.CanSplitSQL(model.RawSQL) {
+		return nil, 0, nil
+	}
+	size, err := gtime.ParseDuration(split)
+	if err != nil || size <= 0 {
+		return nil, 0, backend.DownstreamError(fmt.Errorf("invalid splitDuration %q: expected a duration such as 1d or 12h", split))
+	}
+
+	interval, err := gtime.ParseDuration(macros.ResolveGreptimePanelInterval(query.Interval, query.TimeRange, query.MaxDataPoints))
+	if err != nil {
+		return nil, 0, backend.PluginError(err)
+	}
+	// Chunks align to the date_bin bucket, which ResolveGreptimePanelInterval
+	// rounds; the macros keep getting the panel interval when there is one.
+	ranges := greptime.SplitTimeRange(query.TimeRange, size, interval)
+	if query.Interval > 0 {
+		interval = query.Interval
+	}
+	return ranges, interval, nil
+}
+
+// fetchSplit runs the query over every chunk of ranges in parallel, at most
+// MaxOpenConns at a time, and merges the chunk results in time order. Chunks
+// are cached individually, so a refresh only queries the chunks that changed.
+//
+// Chunks share the request's slots with the other queries. The query hands its
+// own slot to its chunks for good, so queries waiting for their chunks can
+// never hold every slot, and a finished split query returns without waiting
+// for a slot again.
+func (ds *GreptimeDatasource) fetchSplit(ctx context.Context, query backend.DataQuery, model queryModel, ranges []backend.TimeRange, interval time.Duration, forwarded http.Header) (fetchResult, error) {
+	statements := make([]string, len(ranges))
+	for i, tr := range ranges {
+		sql, err := macros.InterpolateSQL(strings.TrimSpace(model.RawSQL), tr, interval, query.MaxDataPoints, ds.timezone(model))
+		if err != nil {
+			return fetchResult{}, err
+		}
+		statements[i] = sql
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make([]fetchResult, len(ranges))
+	errs := make([]error, len(ranges))
+	var limit querySlots
+	if slot, ok := ctx.Value(querySlotKey{}).(*querySlot); ok {
+		limit = slot.slots
+		slot.release()
+	} else {
+		limit = make(querySlots, ds.maxConcurrentQueries())
+	}
+	var wg sync.WaitGroup
+	for i, tr := range ranges {
+		chunk := query
+		chunk.TimeRange, chunk.Interval = tr, interval
+		wg.Add(1)
+		limit <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-limit }()
+			defer func() {
+				if r := recover(); r != nil {
+					errs[i] = backend.PluginError(fmt.Errorf("time range chunk %d failed unexpectedly: %v", i+1, r))
+					cancel()
+				}
+			}()
+			if results[i], errs[i] = ds.fetch(ctx, chunk, model, statements[i], forwarded); errs[i] != nil {
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+	// Report the failure itself rather than the cancellation of other chunks.
+	var firstErr error
+	for _, err := range errs {
+		if err != nil && (firstErr == nil || errors.Is(firstErr, context.Canceled)) {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return fetchResult{}, firstErr
+	}
+
+	merged := fetchResult{response: &greptime.Response{Metrics: map[string]float64{}}}
+	chunks := make([][]*data.Frame, len(results))
+	var cached int
+	for i, result := range results {
+		chunks[i] = result.frames
+		merged.response.ExecutionTimeMs += result.response.ExecutionTimeMs
+		merged.response.ResponseBytes += result.response.ResponseBytes
+		for name, value := range result.response.Metrics {
+			merged.response.Metrics[name] += value
+		}
+		if result.cached {
+			cached++
+		}
+	}
+
+	frames, err := greptime.MergeChunkFrames(chunks, ranges)
+	if err != nil {
+		return fetchResult{}, backend.PluginError(err)
+	}
+	// Every chunk kept up to RowLimit rows; the merged result may not.
+	for n, frame := range frames {
+		var dropped int64
+		for _, result := range results {
+			if n < len(result.response.Output) {
+				dropped += result.response.Output[n].DroppedRows
+			}
+		}
+		greptime.LimitMergedRows(frame, ds.settings.RowLimit, dropped)
+	}
+	for _, frame := range frames {
+		merged.response.Output = append(merged.response.Output, greptime.Output{Frame: frame})
+	}
+	if cached > 0 {
+		for _, frame := range frames {
+			frame.AppendNotices(data.Notice{
+				Severity: data.NoticeSeverityInfo,
+				Text:     fmt.Sprintf("%d of %d time range chunks were served from the query cache", cached, len(ranges)),
+			})
+		}
+	}
+	merged.frames = frames
+	merged.sql = strings.Join(statements, ";\n")
+	merged.stats = []data.QueryStat{{FieldConfig: data.FieldConfig{DisplayName: "Time range chunks"}, Value: float64(len(ranges))}}
+	return merged, nil
+}
@@ -0,0 +1,229 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var timeLiteralPattern = regexp.MustCompile(`'(\d{4}-\d\d-\d\dT[\d:.]+Z)'`)
+
+// chunkServer answers a $__timeFilter query with rows for hosts a and b at
+// both ends of the requested range, valued by the day the range starts.
+func chunkServer(t *testing.T, statements *[]string, mu *sync.Mutex) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		sql := r.PostForm.Get("sql")
+		mu.Lock()
+		*statements = append(*statements, sql)
+		mu.Unlock()
+
+		m := timeLiteralPattern.FindAllStringSubmatch(sql, 2)
+		if !assert.Len(t, m, 2, sql) {
+			return
+		}
+		from, _ := time.Parse(time.RFC3339, m[0][1])
+		to, _ := time.Parse(time.RFC3339, m[1][1])
+		var rows []string
+		for _, ts := range []time.Time{from, to} {
+			for _, host := range []string{"a", "b"} {
+				rows = append(rows, fmt.Sprintf(`[%d,"%s",%d]`, ts.UnixMilli(), host, from.Day()))
+			}
+		}
+		_, _ = fmt.Fprintf(w, `{"code":0,"execution_time_ms":2,"output":[{"records":{"schema":{"column_schemas":[`+
+			`{"name":"ts","data_type":"TimestampMillisecond"},{"name":"host","data_type":"String"},{"name":"v","data_type":"Int64"}]},"rows":[%s]}}]}`,
+			strings.Join(rows, ","))
+	}))
+}
+
+// bucketedSQL aggregates per time bucket, so it can be split.
+const bucketedSQL = "SELECT date_bin('1h', ts) AS ts, host, max(v) AS v FROM cpu WHERE $__timeFilter(ts) GROUP BY 1, host"
+
+func TestQueryData_SplitTimeRange(t *testing.T) {
+	var mu sync.Mutex
+	var statements []string
+	ts := chunkServer(t, &statements, &mu)
+	defer ts.Close()
+
+	ds := newTestDatasource(t, Settings{Host: ts.URL, ResponseFormat: "json"})
+	query := makeDataQuery("A", bucketedSQL+" ORDER BY ts", "sql", "timeseries", map[string]any{"splitDuration": "1d"})
+	query.TimeRange = backend.TimeRange{
+		From: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2024, 1, 4, 0, 0, 0, 0, time.UTC),
+	}
+	query.Interval = time.Hour
+
+	resp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{Queries: []backend.DataQuery{query}})
+	require.NoError(t, err)
+	dr := resp.Responses["A"]
+	require.NoError(t, dr.Error)
+	require.Len(t, statements, 3)
+
+	// One continuous series per host; each chunk's end row is superseded by
+	// the next chunk, except for the last.
+	require.Len(t, dr.Frames, 2)
+	for _, frame := range dr.Frames {
+		require.Equal(t, 4, frame.Rows(), frame.Fields[1].Labels)
+		var values []float64
+		for i := 0; i < frame.Rows(); i++ {
+			v, _ := frame.Fields[1].ConcreteAt(i)
+			values = append(values, v.(float64))
+		}
+		assert.Equal(t, []float64{1, 2, 3, 3}, values)
+	}
+
+	meta := dr.Frames[0].Meta
+	assert.Equal(t, 3, strings.Count(meta.ExecutedQueryString, "SELECT date_bin('1h', ts) AS ts, host, max(v) AS v FROM cpu"))
+	stats := map[string]float64{}
+	for _, stat := range meta.Stats {
+		stats[stat.DisplayName] = stat.Value
+	}
+	assert.Equal(t, float64(3), stats["Time range chunks"])
+	assert.Equal(t, float64(6), stats["Server execution time"])
+}
+
+func TestQueryData_SplitTimeRange_NotSplit(t *testing.T) {
+	var mu sync.Mutex
+	var statements []string
+	ts := chunkServer(t, &statements, &mu)
+	defer ts.Close()
+
+	ds := newTestDatasource(t, Settings{Host: ts.URL, ResponseFormat: "json"})
+
+	// Without a split duration the range is queried at once.
+	query := makeDataQuery("A", "SELECT ts, host, v FROM cpu WHERE $__timeFilter(ts)", "sql", "table", nil)
+	resp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{Queries: []backend.DataQuery{query}})
+	require.NoError(t, err)
+	require.NoError(t, resp.Responses["A"].Error)
+	assert.Len(t, statements, 1)
+
+	query = makeDataQuery("B", bucketedSQL, "sql", "table", map[string]any{"splitDuration": "soon"})
+	resp, err = ds.QueryData(context.Background(), &backend.QueryDataRequest{Queries: []backend.DataQuery{query}})
+	require.NoError(t, err)
+	assert.ErrorContains(t, resp.Responses["B"].Error, `invalid splitDuration "soon"`)
+	assert.Len(t, statements, 1)
+
+	// Results that cannot be joined from chunks run over the whole range.
+	for _, sql := range []string{
+		"SELECT ts, host, v FROM cpu WHERE $__timeFilter(ts) ORDER BY v DESC LIMIT 10",
+		bucketedSQL + " LIMIT 100",
+		"SELECT host, count(*) FROM cpu WHERE $__timeFilter(ts) GROUP BY host",
+	} {
+		mu.Lock()
+		statements = nil
+		mu.Unlock()
+		query := makeDataQuery("C", sql, "sql", "table", map[string]any{"splitDuration": "1h"})
+		resp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{Queries: []backend.DataQuery{query}})
+		require.NoError(t, err)
+		require.NoError(t, resp.Responses["C"].Error)
+		assert.Len(t, statements, 1, sql)
+	}
+}
+
+// TestQueryData_SplitTimeRange_RowLimit verifies the row limit applies to the
+// merged result, not only to each chunk.
+func TestQueryData_SplitTimeRange_RowLimit(t *testing.T) {
+	var mu sync.Mutex
+	var statements []string
+	ts := chunkServer(t, &statements, &mu)
+	defer ts.Close()
+
+	// Each chunk returns 4 rows; 3 chunks lose their end rows when merged,
+	// except for the last, leaving 8 rows.
+	ds := newTestDatasource(t, Settings{Host: ts.URL, ResponseFormat: "json", RowLimit: 5})
+	query := makeDataQuery("A", bucketedSQL, "sql", "table", map[string]any{"splitDuration": "1d"})
+	query.TimeRange = backend.TimeRange{
+		From: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2024, 1, 4, 0, 0, 0, 0, time.UTC),
+	}
+	resp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{Queries: []backend.DataQuery{query}})
+	require.NoError(t, err)
+	dr := resp.Responses["A"]
+	require.NoError(t, dr.Error)
+	require.Len(t, statements, 3)
+	require.Len(t, dr.Frames, 1)
+	assert.Equal(t, 5, dr.Frames[0].Rows())
+	require.Len(t, dr.Frames[0].Meta.Notices, 1)
+	assert.Equal(t, "Results have been limited to 5 rows because the SQL row limit was reached; 3 rows were dropped",
+		dr.Frames[0].Meta.Notices[0].Text)
+}
+
+// TestFetchSplit_SharesSlots verifies that the chunks of a split query run in
+// the request's MaxOpenConns slots, the query's own slot included, and that
+// the query does not take its slot back once the chunks are done.
+func TestFetchSplit_SharesSlots(t *testing.T) {
+	var running, maxRunning, requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		_, _ = w.Write([]byte(`{"code":0,"output":[{"records":{"schema":{"column_schemas":[` +
+			`{"name":"ts","data_type":"TimestampMillisecond"},{"name":"v","data_type":"Int64"}]},"rows":[]}}]}`))
+	}))
+	defer ts.Close()
+
+	ds := newTestDatasource(t, Settings{Host: ts.URL, ResponseFormat: "json", MaxOpenConns: "2"})
+	query := makeDataQuery("A", "SELECT date_bin('1h', ts) AS ts, max(v) AS v FROM cpu WHERE $__timeFilter(ts) GROUP BY 1",
+		"sql", "table", map[string]any{"splitDuration": "1d"})
+	query.TimeRange = backend.TimeRange{
+		From: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2024, 1, 4, 0, 0, 0, 0, time.UTC),
+	}
+	var model queryModel
+	require.NoError(t, json.Unmarshal(query.JSON, &model))
+	ranges, interval, err := ds.splitRanges(query, model)
+	require.NoError(t, err)
+	require.Len(t, ranges, 3)
+
+	// This query holds one slot and another query the other, leaving the
+	// chunks the slot this query gives up.
+	slots := make(querySlots, 2)
+	slots <- struct{}{}
+	slots <- struct{}{}
+	slot := &querySlot{slots: slots}
+	ctx := context.WithValue(context.Background(), querySlotKey{}, slot)
+	_, err = ds.fetchSplit(ctx, query, model, ranges, interval, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), requests.Load())
+	assert.Equal(t, int32(1), maxRunning.Load())
+	assert.Len(t, slots, 1, "only the other query's slot is held")
+
+	// Releasing the query's slot again, as QueryData does, is a no-op.
+	slot.release()
+	assert.Len(t, slots, 1)
+
+	// Split queries filling every slot of a request still finish.
+	var queries []backend.DataQuery
+	for _, refID := range []string{"B", "C", "D"} {
+		// Distinct statements, so identical in-flight chunks are not shared.
+		q := makeDataQuery(refID, "SELECT date_bin('1h', ts) AS ts, max(v) AS "+refID+" FROM cpu WHERE $__timeFilter(ts) GROUP BY 1",
+			"sql", "table", map[string]any{"splitDuration": "1d"})
+		q.TimeRange = query.TimeRange
+		queries = append(queries, q)
+	}
+	resp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{Queries: queries})
+	require.NoError(t, err)
+	for _, dr := range resp.Responses {
+		require.NoError(t, dr.Error)
+	}
+	assert.Equal(t, int32(12), requests.Load())
+}
@@ -1,6 +1,6 @@
 import React from 'react';
 import { QueryEditorProps } from '@grafana/data';
-import { CodeEditor, monacoTypes } from '@grafana/ui';
+import { CodeEditor, InlineFormLabel, Select, monacoTypes } from '@grafana/ui';
 import { Datasource } from 'data/GreptimeDatasource';
 import { registerSQL, Range, Fetcher } from './sqlProvider';
 import { GreptimeConfig } from 'types/config';
@@ -12,6 +12,7 @@ import { mapQueryTypeToGrafanaFormat } from 'data/utils';
 import { QueryType } from 'types/queryBuilder';
 import { QueryTypeSwitcher } from 'components/queryBuilder/QueryTypeSwitcher';
 import { pluginVersion } from 'utils/version';
+import labels from 'labels';
 
 type SqlEditorProps = QueryEditorProps<Datasource, GreptimeQuery, GreptimeConfig>;
 
@@ -45,6 +46,14 @@ export const SqlEditor = (props: SqlEditorProps) => {
     });
   };
 
+  // Databases selectable per query; the editor only offers a choice when the datasource allows some.
+  const defaultDatabase = datasource.getDefaultDatabase();
+  const allowedDatabases = datasource.settings.jsonData.allowedDatabases || [];
+  const databaseOptions = [defaultDatabase, ...allowedDatabases.filter((db) => db !== defaultDatabase)].map((db) => ({ label: db, value: db }));
+  if (sqlQuery.database && !databaseOptions.some((o) => o.value === sqlQuery.database)) {
+    databaseOptions.push({ label: sqlQuery.database, value: sqlQuery.database });
+  }
+
   const schema: Schema = {
     databases: () => datasource.fetchDatabases(),
     tables: (db?: string) => datasource.fetchTables(db),
@@ -102,6 +111,22 @@ export const SqlEditor = (props: SqlEditorProps) => {
     <>
       <div className={'gf-form ' + styles.QueryEditor.queryType}>
         <QueryTypeSwitcher queryType={queryType} onChange={(queryType) => saveChanges({ queryType })} sqlEditor />
+        {allowedDatabases.length > 0 && (
+          <>
+            <InlineFormLabel width={8} className="query-keyword" tooltip={labels.components.SqlEditor.database.tooltip}>
+              {labels.components.SqlEditor.database.label}
+            </InlineFormLabel>
+            <Select
+              className={`width-15 ${styles.Common.inlineSelect}`}
+              aria-label={labels.components.SqlEditor.database.label}
+              options={databaseOptions}
+              value={sqlQuery.database || defaultDatabase}
+              onChange={(e) => saveChanges({ database: e.value === defaultDatabase ? undefined : e.value })}
+              menuPlacement={'bottom'}
+              allowCustomValue
+            />
+          </>
+        )}
       </div>
       <div className={styles.Common.wrapper}>
         <CodeEditor
@@ -6,12 +6,14 @@ import allLabels from 'labels';
 interface DefaultDatabaseTableConfigProps {
   defaultDatabase?: string;
   defaultTable?: string;
+  allowedDatabases?: string[];
   onDefaultDatabaseChange: (e: SyntheticEvent<HTMLInputElement | HTMLSelectElement, Event>) => void;
   onDefaultTableChange: (e: SyntheticEvent<HTMLInputElement | HTMLSelectElement, Event>) => void;
+  onAllowedDatabasesChange: (databases: string[]) => void;
 }
 
 export const DefaultDatabaseTableConfig = (props: DefaultDatabaseTableConfigProps) => {
-  const { defaultDatabase, defaultTable, onDefaultDatabaseChange, onDefaultTableChange } = props;
+  const { defaultDatabase, defaultTable, allowedDatabases, onDefaultDatabaseChange, onDefaultTableChange, onAllowedDatabasesChange } = props;
   const labels = allLabels.components.Config.DefaultDatabaseTableConfig;
 
   return (
@@ -46,6 +48,21 @@ export const DefaultDatabaseTableConfig = (props: DefaultDatabaseTableConfigProp
           type="text"
         />
       </Field>
+      <Field
+        label={labels.allowedDatabases.label}
+        description={labels.allowedDatabases.description}
+      >
+        <Input
+          name={labels.allowedDatabases.name}
+          width={40}
+          defaultValue={(allowedDatabases || []).join(', ')}
+          onBlur={(e) => onAllowedDatabasesChange(e.currentTarget.value.split(',').map((db) => db.trim()).filter(Boolean))}
+          label={labels.allowedDatabases.label}
+          aria-label={labels.allowedDatabases.label}
+          placeholder={labels.allowedDatabases.placeholder}
+          type="text"
+        />
+      </Field>
     </ConfigSection>
   );
 }
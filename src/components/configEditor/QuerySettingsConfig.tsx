@@ -1,13 +1,15 @@
 import React, { FormEvent } from 'react';
-import { Switch, Field } from '@grafana/ui';
+import { Switch, Field, Input } from '@grafana/ui';
 import { ConfigSection } from 'components/experimental/ConfigSection';
 import allLabels from 'labels';
 
 interface QuerySettingsConfigProps {
 
   filterValidationEnabled?: boolean;
+  timezone?: string;
 
   onFilterValidationEnabledChange: (e: FormEvent<HTMLInputElement>) => void;
+  onTimezoneChange: (e: FormEvent<HTMLInputElement>) => void;
 }
 
 export const QuerySettingsConfig = (props: QuerySettingsConfigProps) => {
@@ -19,6 +21,7 @@ export const QuerySettingsConfig = (props: QuerySettingsConfigProps) => {
     // queryTimeout,
     // validateSql,
     filterValidationEnabled,
+    timezone,
     // onConnMaxIdleConnsChange,
     // onConnMaxLifetimeChange,
     // onConnMaxOpenConnsChange,
@@ -26,6 +29,7 @@ export const QuerySettingsConfig = (props: QuerySettingsConfigProps) => {
     // onQueryTimeoutChange,
     // onValidateSqlChange,
     onFilterValidationEnabledChange,
+    onTimezoneChange,
   } = props;
 
   const labels = allLabels.components.Config.QuerySettingsConfig;
@@ -100,6 +104,19 @@ export const QuerySettingsConfig = (props: QuerySettingsConfigProps) => {
       <Field label="Query Builder Filter Validation" description="Enable validation to require at least one non-default time range condition">
         <Switch className="gf-form" value={filterValidationEnabled || false} onChange={onFilterValidationEnabledChange} role="checkbox" />
       </Field>
+
+      <Field label={labels.timezone.label} description={labels.timezone.tooltip}>
+        <Input
+          name={labels.timezone.name}
+          width={40}
+          value={timezone || ''}
+          onChange={onTimezoneChange}
+          label={labels.timezone.label}
+          aria-label={labels.timezone.label}
+          placeholder={labels.timezone.placeholder}
+          type="text"
+        />
+      </Field>
     </ConfigSection>
   );
 };
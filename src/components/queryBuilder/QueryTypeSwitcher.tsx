@@ -28,6 +28,15 @@ const options = [
   },
 ];
 
+/** Query types only offered in the SQL editor */
+const sqlOptions = [
+  ...options,
+  {
+    label: labels.types.QueryType.explain,
+    value: QueryType.Explain,
+  },
+];
+
 /**
  * Component for switching between the different query builder interfaces
  */
@@ -40,7 +49,7 @@ export const QueryTypeSwitcher = (props: QueryTypeSwitcherProps) => {
       <InlineFormLabel width={8} className="query-keyword" tooltip={sqlEditor ? sqlTooltip : tooltip}>
         {label}
       </InlineFormLabel>
-      <RadioButtonGroup options={options} value={queryType} onChange={onChange} />
+      <RadioButtonGroup options={sqlEditor ? sqlOptions : options} value={queryType} onChange={onChange} />
     </span>
   );
 };
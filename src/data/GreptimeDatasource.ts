@@ -413,6 +413,7 @@ export class Datasource
     return {
       ...query,
       rawSql: this.replace(rawQuery, scoped) || '',
+      ...(query.database ? { database: this.replace(query.database, scoped) } : {}),
     };
   }
 
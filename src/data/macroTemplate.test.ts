@@ -10,6 +10,12 @@ describe('replacePreservingBackendMacros', () => {
     expect(result).toContain("host = 'a'");
   });
 
+  it('preserves TQL range macros', () => {
+    const sql = 'TQL EVAL ($__tqlRange) rate(cpu{host="$host"}[5m])';
+    const result = replacePreservingBackendMacros(sql, (s) => s.replace(/\$host/g, 'a'));
+    expect(result).toBe('TQL EVAL ($__tqlRange) rate(cpu{host="a"}[5m])');
+  });
+
   it('simulates templateSrv stripping unknown $__ names when unprotected', () => {
     const sql = 'WHERE $__timeFilter(ts)';
     const broken = sql.replace(/\$__timeFilter/g, '');
@@ -3,7 +3,7 @@
  * templateSrv.replace which may strip unknown $__ names (e.g. $__timeFilter → empty).
  */
 const BACKEND_MACRO_PATTERN =
-  /\$__(?:timeFilter_ms|timeFilter|timeInterval_ms|timeInterval|fromTime_ms|toTime_ms|fromTime|toTime|dateTimeFilter|dateFilter|interval_s|interval_ms|interval|dt)(?:\([^)]*\))?/g;
+  /\$__(?:timeFilter_ms|timeFilter|timeInterval_ms|timeInterval|fromTime_ms|toTime_ms|fromTime|toTime|dateTimeFilter|dateFilter|interval_s|interval_ms|interval|dt|tqlRange|tqlStart|tqlEnd|tqlStep|timezone)(?:\([^)]*\))?/g;
 
 export function replacePreservingBackendMacros(sql: string, replaceFn: (sql: string) => string): string {
   const placeholders = new Map<string, string>();
@@ -0,0 +1,21 @@
+import * as fs from 'fs';
+import * as path from 'path';
+import { QueryBuilderOptions } from 'types/queryBuilder';
+import { generateSql } from './sqlGenerator';
+
+interface GoldenCase {
+  name: string;
+  options: QueryBuilderOptions;
+  sql: string;
+}
+
+// Shared with pkg/greptime/sqlgen_test.go, which runs the same cases through the
+// backend port of the generator used when a query arrives without rawSql.
+const goldenFile = path.resolve(__dirname, '../../pkg/greptime/testdata/sqlgen.golden.json');
+const cases: GoldenCase[] = JSON.parse(fs.readFileSync(goldenFile, 'utf8'));
+
+describe('SQL Generator golden cases', () => {
+  it.each(cases.map((c) => [c.name, c] as const))('%s', (_, c) => {
+    expect(generateSql(c.options)).toEqual(c.sql);
+  });
+});
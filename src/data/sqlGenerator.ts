@@ -1,7 +1,11 @@
 import { BooleanFilter, BuilderMode, ColumnHint, DateFilterWithValue, FilterOperator, MultiFilter, NumberFilter, QueryBuilderOptions, QueryType, SelectedColumn, StringFilter, TimeUnit } from 'types/queryBuilder';
 
 /**
- * Generates a SQL string for the given QueryBuilderOptions
+ * Generates a SQL string for the given QueryBuilderOptions.
+ *
+ * pkg/greptime/sqlgen.go ports this generator so the backend can run builder
+ * queries saved without rawSql; keep both in step with the shared cases in
+ * pkg/greptime/testdata/sqlgen.golden.json.
  */
 export const generateSql = (options: QueryBuilderOptions): string => {
   const hasTraceIdFilter = options.meta?.isTraceIdMode && options.meta?.traceId;
@@ -107,8 +111,8 @@ const generateTraceIdQuery = (options: QueryBuilderOptions): string => {
   }
 
   if (hasTraceIdFilter) {
-    const traceId = options.meta!.traceId;
-    queryParts.push(`trace_id = '${traceId}'`);
+    const traceId = options.meta!.traceId!;
+    queryParts.push(`trace_id = '${traceId.replace(/'/g, "''")}'`);
   }
 
   if (filterParts) {
@@ -207,7 +211,8 @@ const generateLogsQuery = (_options: QueryBuilderOptions): string => {
     if (filterParts) {
       queryParts.push('AND');
     }
-    queryParts.push(`(${escapeIdentifier(logMessage.name)} LIKE '%${options.meta!.logMessageLike}%')`);
+    const like = options.meta!.logMessageLike!.replace(/'/g, "''");
+    queryParts.push(`(${escapeIdentifier(logMessage.name)} LIKE '%${like}%')`);
   }
 
   const orderBy = getOrderBy(options);
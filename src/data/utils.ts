@@ -25,6 +25,7 @@ export const isBuilderOptionsRunnable = (builderOptions: QueryBuilderOptions): b
 export const mapQueryBuilderOptionsToGrafanaFormat = (t?: QueryBuilderOptions): number => {
   switch (t?.queryType) {
     case QueryType.Table:
+    case QueryType.Explain:
       return 1;
     case QueryType.Logs:
       return 2;
@@ -10,7 +10,19 @@ export default {
           tooltip: 'GreptimeDB url',
           error: 'Server address required'
         },
+        protocol: {
+          label: 'Protocol',
+          tooltip: 'HTTP queries the /v1/sql API (port 4000). Native uses the gRPC Arrow Flight endpoint (port 4001) and PostgreSQL the PostgreSQL wire protocol (port 4003); both expect the server address as host or host:port.',
+          http: 'HTTP',
+          native: 'Native (Arrow Flight)',
+          postgres: 'PostgreSQL',
+        },
 
+        bearerToken: {
+          label: 'Bearer token',
+          description: 'Sends a static token as "Authorization: Bearer <token>", e.g. for GreptimeCloud',
+          placeholder: 'token',
+        },
         username: {
           label: 'Username',
           placeholder: 'default',
@@ -95,6 +107,12 @@ export default {
           name: 'defaultTable',
           placeholder: 'table'
         },
+        allowedDatabases: {
+          label: 'Allowed databases',
+          description: 'comma-separated databases that SQL queries may select instead of the default database',
+          name: 'allowedDatabases',
+          placeholder: 'logs, traces'
+        },
       },
       QuerySettingsConfig: {
         title: 'Query settings',
@@ -120,7 +138,7 @@ export default {
           label: 'Max Open Connections',
           name: 'maxOpenConns',
           placeholder: '50',
-          tooltip: 'Maximum number of open connections'
+          tooltip: 'Maximum number of open connections, which also bounds how many queries of a panel run at once'
         },
         queryTimeout: {
           label: 'Query Timeout (seconds)',
@@ -131,6 +149,12 @@ export default {
         validateSql: {
           label: 'Validate SQL',
           tooltip: 'Validate SQL in the editor.'
+        },
+        timezone: {
+          label: 'Default timezone',
+          name: 'timezone',
+          placeholder: 'Europe/Berlin',
+          tooltip: 'IANA timezone for queries without a dashboard timezone, such as alert rules. Empty keeps the GreptimeDB server default.'
         }
       },
       TracesConfig: {
@@ -268,6 +292,12 @@ export default {
       tooltip: 'Sets the layout for the query builder',
       sqlTooltip: 'Sets the panel type for explore view'
     },
+    SqlEditor: {
+      database: {
+        label: 'Database',
+        tooltip: 'Runs the query in this database instead of the datasource default. Only the default and the allowed databases are accepted.',
+      },
+    },
     DatabaseSelect: {
       label: 'Database',
       tooltip: 'GreptimeDB database to query from',
@@ -436,6 +466,7 @@ export default {
       logs: 'Logs',
       timeseries: 'Time Series',
       traces: 'Traces',
+      explain: 'Explain',
     },
     ColumnHint: {
       [ColumnHint.Time]: 'Time',
@@ -17,8 +17,21 @@ export interface GreptimeConfig extends DataSourceJsonData {
   tlsAuthWithCACert?: boolean;
 
   username: string;
+  /**
+   * How queries authenticate: 'basic' (default), 'bearer' (static token in secure JSON)
+   * or 'oauth' (forwards the signed-in user's Authorization header; requires oauthPassThru)
+   */
+  authMode?: AuthMode;
 
   defaultDatabase?: string;
+  /**
+   * Databases a query may select besides defaultDatabase
+   */
+  allowedDatabases?: string[];
+  /**
+   * IANA timezone of queries that carry no dashboard timezone (e.g. alert rules)
+   */
+  timezone?: string;
   defaultTable?: string;
 
   connMaxLifetime?: string;
@@ -26,6 +39,50 @@ export interface GreptimeConfig extends DataSourceJsonData {
   maxIdleConns?: string;
   maxOpenConns?: string;
   queryTimeout?: string;
+  /**
+   * Additional frontends ('host:port' or URLs) queried alongside host, with failover
+   */
+  endpoints?: string[];
+  /**
+   * How requests are spread across endpoints
+   */
+  endpointSelection?: 'round-robin' | 'least-latency';
+  /**
+   * Total attempts for read-only statements on transient failures (1 disables retries)
+   */
+  retryMaxAttempts?: string;
+  /**
+   * Initial retry backoff in milliseconds; doubles per retry
+   */
+  retryBackoff?: string;
+  /**
+   * Maximum retry backoff in milliseconds
+   */
+  retryMaxBackoff?: string;
+  /**
+   * Comma-separated HTTP status codes that are retried, e.g. '502,503,504'
+   */
+  retryStatusCodes?: string;
+  /**
+   * Seconds a query result is reused for identical queries; empty or 0 disables the cache
+   */
+  cacheTTL?: string;
+  /**
+   * Memory cap of the result cache in megabytes (default 64)
+   */
+  cacheMaxSize?: string;
+  /**
+   * Body format requested from /v1/sql: 'arrow' (default) or 'json'
+   */
+  responseFormat?: 'arrow' | 'json';
+  /**
+   * Maximum rows kept per result; overrides Grafana's [sql] row_limit when set
+   */
+  rowLimit?: number;
+  /**
+   * Maximum bytes read from a /v1/sql response; larger results are truncated with a warning
+   */
+  maxResponseBytes?: number;
   validateSql?: boolean;
 
   /**
@@ -47,6 +104,7 @@ export interface GreptimeConfig extends DataSourceJsonData {
 
 interface GreptimeSecureConfigProperties {
   password?: string;
+  bearerToken?: string;
 
   tlsCACert?: string;
   tlsClientCert?: string;
@@ -108,7 +166,22 @@ export interface AliasTableEntry {
   aliasTable: string;
 }
 
+export enum AuthMode {
+  Basic = 'basic',
+  Bearer = 'bearer',
+  OAuth = 'oauth',
+}
+
 export enum Protocol {
+  /**
+   * Arrow Flight over gRPC. Configs saved before nativeFlightVersion used it as the HTTP default.
+   */
   Native = 'native',
   Http = 'http',
+  Postgres = 'postgres',
 }
+
+/**
+ * First plugin version whose native protocol is Arrow Flight
+ */
+export const nativeFlightVersion = '3.1.0';
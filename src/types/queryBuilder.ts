@@ -17,6 +17,8 @@ export enum QueryType {
   Logs = 'logs',
   TimeSeries = 'timeseries',
   Traces = 'traces',
+  /** EXPLAIN ANALYZE of the SQL, rendered as a node graph */
+  Explain = 'explain',
 }
 
 export interface QueryBuilderOptions {
@@ -13,6 +13,16 @@ export interface GreptimeQueryBase extends DataQuery {
   pluginVersion: string,
   editorType: EditorType;
   rawSql: string;
+  /** Runs the query in this database instead of the datasource default; must be in allowedDatabases */
+  database?: string;
+  /** GreptimeDB query hints added to, or overriding, the datasource custom settings */
+  hints?: Record<string, string>;
+  /** Always queries GreptimeDB, skipping the datasource result cache */
+  bypassCache?: boolean;
+  /** Runs the query over chunks of this duration (e.g. '1d') in parallel and merges the results */
+  splitDuration?: string;
+  /** Which outputs of a multi-statement query to return: every result set (default) or the last output only */
+  resultMode?: 'all' | 'last';
 
   /**
    * REQUIRED by backend for auto selecting preferredVisualizationType.
@@ -2,8 +2,9 @@ import React, { ChangeEvent, useState } from 'react';
 import {
   DataSourcePluginOptionsEditorProps,
   onUpdateDatasourceJsonDataOption,
+  onUpdateDatasourceSecureJsonDataOption,
 } from '@grafana/data';
-import {  Switch, Input,  Button, Field, HorizontalGroup, Alert, VerticalGroup } from '@grafana/ui';
+import {  Switch, Input,  Button, Field, HorizontalGroup, Alert, VerticalGroup, RadioButtonGroup, SecretInput } from '@grafana/ui';
 import { Auth, convertLegacyAuthProps, AuthMethod } from '@grafana/experimental';
 
 import {
@@ -12,7 +13,9 @@ import {
   GreptimeSecureConfig,
   GreptimeLogsConfig,
   GreptimeTracesConfig,
-  AliasTableEntry
+  AliasTableEntry,
+  AuthMode,
+  Protocol
 } from 'types/config';
 import { gte as versionGte } from 'semver';
 import { ConfigSection, ConfigSubSection } from 'components/experimental/ConfigSection';
@@ -134,11 +137,47 @@ export const ConfigEditor: React.FC<ConfigEditorProps> = (props) => {
     onChange: onOptionsChange,
   });
 
-  function returnSelectedMethod() {
+  const bearerMethodId: `custom-${string}` = 'custom-bearer';
 
+  function returnSelectedMethod() {
+    if (jsonData.authMode === AuthMode.Bearer) {
+      return bearerMethodId;
+    }
+    if (jsonData.authMode === AuthMode.OAuth) {
+      return AuthMethod.OAuthForward;
+    }
     return newAuthProps.selectedMethod;
   }
 
+  const onResetBearerToken = () => {
+    onOptionsChange({
+      ...options,
+      secureJsonFields: { ...options.secureJsonFields, bearerToken: false },
+      secureJsonData: { ...options.secureJsonData, bearerToken: '' },
+    });
+  };
+
+  const bearerTokenMethod = {
+    id: bearerMethodId,
+    label: labels.bearerToken.label,
+    description: labels.bearerToken.description,
+    component: (
+      <Field label={labels.bearerToken.label} description={labels.bearerToken.description}>
+        <SecretInput
+          name="bearerToken"
+          width={40}
+          label={labels.bearerToken.label}
+          aria-label={labels.bearerToken.label}
+          placeholder={labels.bearerToken.placeholder}
+          value={(options.secureJsonData as { bearerToken?: string } | undefined)?.bearerToken || ''}
+          isConfigured={Boolean(options.secureJsonFields?.bearerToken)}
+          onReset={onResetBearerToken}
+          onChange={onUpdateDatasourceSecureJsonDataOption(props, 'bearerToken')}
+        />
+      </Field>
+    ),
+  };
+
   return (
     <>
       {uidWarning}
@@ -161,8 +200,17 @@ export const ConfigEditor: React.FC<ConfigEditorProps> = (props) => {
             placeholder={labels.serverAddress.placeholder}
           />
         </Field>
-
-       
+        <Field label={labels.protocol.label} description={labels.protocol.tooltip}>
+          <RadioButtonGroup<Protocol>
+            options={[
+              { label: labels.protocol.http, value: Protocol.Http },
+              { label: labels.protocol.native, value: Protocol.Native },
+              { label: labels.protocol.postgres, value: Protocol.Postgres },
+            ]}
+            value={jsonData.protocol || Protocol.Http}
+            onChange={(protocol) => onOptionsChange({ ...options, jsonData: { ...options.jsonData, protocol } })}
+          />
+        </Field>
       </ConfigSection>
 
 
@@ -171,14 +219,23 @@ export const ConfigEditor: React.FC<ConfigEditorProps> = (props) => {
       <Divider />
       <Auth
         {...newAuthProps}
-        visibleMethods={[AuthMethod.NoAuth, AuthMethod.BasicAuth]}
+        visibleMethods={[AuthMethod.NoAuth, AuthMethod.BasicAuth, AuthMethod.OAuthForward, bearerMethodId]}
+        customMethods={[bearerTokenMethod]}
         onAuthMethodSelect={(method) => {
+          let authMode = AuthMode.Basic;
+          if (method === bearerMethodId) {
+            authMode = AuthMode.Bearer;
+          } else if (method === AuthMethod.OAuthForward) {
+            authMode = AuthMode.OAuth;
+          }
           onOptionsChange({
             ...options,
             basicAuth: method === AuthMethod.BasicAuth,
             withCredentials: method === AuthMethod.CrossSiteCredentials,
             jsonData: {
               ...options.jsonData,
+              authMode,
+              oauthPassThru: method === AuthMethod.OAuthForward,
             },
           });
         }}
@@ -227,16 +284,20 @@ export const ConfigEditor: React.FC<ConfigEditorProps> = (props) => {
         <DefaultDatabaseTableConfig
           defaultDatabase={jsonData.defaultDatabase}
           defaultTable={jsonData.defaultTable}
+          allowedDatabases={jsonData.allowedDatabases}
           onDefaultDatabaseChange={onUpdateDatasourceJsonDataOption(props, 'defaultDatabase')}
           onDefaultTableChange={onUpdateDatasourceJsonDataOption(props, 'defaultTable')}
+          onAllowedDatabasesChange={(allowedDatabases) => onOptionsChange({ ...options, jsonData: { ...jsonData, allowedDatabases } })}
         />
         
         <Divider />
         <QuerySettingsConfig
         
           filterValidationEnabled={jsonData.filterValidationEnabled || false}
+          timezone={jsonData.timezone}
           
           onFilterValidationEnabledChange={(e) => onSwitchToggle('filterValidationEnabled', e.currentTarget.checked)}
+          onTimezoneChange={onUpdateDatasourceJsonDataOption(props, 'timezone')}
         />
 
         <Divider />
@@ -289,14 +350,17 @@ export const ConfigEditor: React.FC<ConfigEditorProps> = (props) => {
             />
           </Field>
         )}
-        <ConfigSubSection title="Custom Settings">
+        <ConfigSubSection
+          title="Custom Settings"
+          description="Query hints sent with every request (x-greptime-hints), e.g. read_preference = leader. Names are lowercase snake_case; values cannot contain ',' or '='. Not sent over the PostgreSQL protocol."
+        >
           {customSettings.map(({ setting, value }, i) => {
             return (
               <HorizontalGroup key={i}>
                 <Field label={`Setting`} aria-label={`Setting`}>
                   <Input
                     value={setting}
-                    placeholder={'Setting'}
+                    placeholder={'read_preference'}
                     onChange={(changeEvent: ChangeEvent<HTMLInputElement>) => {
                       let newSettings = customSettings.concat();
                       newSettings[i] = { setting: changeEvent.target.value, value };
@@ -310,7 +374,7 @@ export const ConfigEditor: React.FC<ConfigEditorProps> = (props) => {
                 <Field label={'Value'} aria-label={`Value`}>
                   <Input
                     value={value}
-                    placeholder={'Value'}
+                    placeholder={'leader'}
                     onChange={(changeEvent: ChangeEvent<HTMLInputElement>) => {
                       let newSettings = customSettings.concat();
                       newSettings[i] = { setting, value: changeEvent.target.value };
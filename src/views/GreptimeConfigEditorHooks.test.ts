@@ -1,6 +1,6 @@
 import { DataSourceSettings } from "@grafana/data";
 import { renderHook } from "@testing-library/react";
-import { GreptimeConfig, GreptimeHttpHeader, GreptimeSecureConfig, Protocol } from "types/config";
+import { GreptimeConfig, GreptimeHttpHeader, GreptimeSecureConfig, nativeFlightVersion, Protocol } from "types/config";
 import { onHttpHeadersChange, useConfigDefaults } from "./GreptimeConfigEditorHooks";
 import { pluginVersion } from "utils/version";
 import { defaultLogsTable, defaultTraceTable } from "otel";
@@ -94,7 +94,7 @@ describe('onHttpHeadersChange', () => {
 describe('useConfigDefaults', () => {
   const expectedDefaults: Partial<GreptimeConfig> = {
     version: pluginVersion,
-    protocol: Protocol.Native,
+    protocol: Protocol.Http,
     logs: {
       defaultTable: defaultLogsTable,
       selectContextColumns: true,
@@ -184,7 +184,7 @@ describe('useConfigDefaults', () => {
     const onOptionsChange = jest.fn();
     const options = {
       jsonData: {
-        protocol: Protocol.Native,
+        protocol: Protocol.Http,
       }
     } as any as DataSourceSettings<GreptimeConfig>;
 
@@ -194,8 +194,29 @@ describe('useConfigDefaults', () => {
       jsonData: {
         ...expectedDefaults,
         version: pluginVersion,
+        protocol: Protocol.Http,
+      }
+    };
+    expect(onOptionsChange).toHaveBeenCalledTimes(1);
+    expect(onOptionsChange).toHaveBeenCalledWith(expect.objectContaining(expectedOptions));
+  });
+
+  it('should migrate native without a version to http', async () => {
+    const onOptionsChange = jest.fn();
+    const options = {
+      jsonData: {
         protocol: Protocol.Native,
       }
+    } as any as DataSourceSettings<GreptimeConfig>;
+
+    renderHook(opts => useConfigDefaults(opts, onOptionsChange), { initialProps: options });
+
+    const expectedOptions = {
+      jsonData: {
+        ...expectedDefaults,
+        version: pluginVersion,
+        protocol: Protocol.Http,
+      }
     };
     expect(onOptionsChange).toHaveBeenCalledTimes(1);
     expect(onOptionsChange).toHaveBeenCalledWith(expect.objectContaining(expectedOptions));
@@ -206,6 +227,50 @@ describe('useConfigDefaults', () => {
     const options = {
       jsonData: {
         version: '3.0.0',
+        protocol: Protocol.Http,
+      }
+    } as any as DataSourceSettings<GreptimeConfig>;
+
+    renderHook(opts => useConfigDefaults(opts, onOptionsChange), { initialProps: options });
+
+    const expectedOptions = {
+      jsonData: {
+        ...expectedDefaults,
+        version: pluginVersion,
+        protocol: Protocol.Http,
+      }
+    };
+    expect(onOptionsChange).toHaveBeenCalledTimes(1);
+    expect(onOptionsChange).toHaveBeenCalledWith(expect.objectContaining(expectedOptions));
+  });
+
+  it('should migrate native saved by older versions to http', async () => {
+    const onOptionsChange = jest.fn();
+    const options = {
+      jsonData: {
+        version: '3.0.2',
+        protocol: Protocol.Native,
+      }
+    } as any as DataSourceSettings<GreptimeConfig>;
+
+    renderHook(opts => useConfigDefaults(opts, onOptionsChange), { initialProps: options });
+
+    const expectedOptions = {
+      jsonData: {
+        ...expectedDefaults,
+        version: pluginVersion,
+        protocol: Protocol.Http,
+      }
+    };
+    expect(onOptionsChange).toHaveBeenCalledTimes(1);
+    expect(onOptionsChange).toHaveBeenCalledWith(expect.objectContaining(expectedOptions));
+  });
+
+  it('should keep native saved by current versions', async () => {
+    const onOptionsChange = jest.fn();
+    const options = {
+      jsonData: {
+        version: nativeFlightVersion,
         protocol: Protocol.Native,
       }
     } as any as DataSourceSettings<GreptimeConfig>;
@@ -1,9 +1,9 @@
 import { DataSourceSettings, KeyValue } from "@grafana/data";
 import { defaultLogsTable, defaultTraceTable } from "otel";
 import { useEffect, useRef } from "react";
-import { GreptimeConfig, GreptimeHttpHeader, GreptimeSecureConfig, GreptimeTracesConfig, Protocol } from "types/config";
+import { GreptimeConfig, GreptimeHttpHeader, GreptimeSecureConfig, GreptimeTracesConfig, nativeFlightVersion, Protocol } from "types/config";
 import { TimeUnit } from "types/queryBuilder";
-import { pluginVersion } from "utils/version";
+import { isVersionGtOrEq, pluginVersion } from "utils/version";
 
 /**
  * Handles saving HTTP headers to Grafana config.
@@ -83,6 +83,7 @@ export const useConfigDefaults = (options: DataSourceSettings<GreptimeConfig>, o
     }
 
     const jsonData = { ...options.jsonData };
+    const savedVersion = jsonData.version;
     jsonData.version = pluginVersion; // Always overwrite version
 
     // v3 Migration
@@ -99,10 +100,15 @@ export const useConfigDefaults = (options: DataSourceSettings<GreptimeConfig>, o
     }
     delete (jsonData as any)['timeout'];
 
+    // Older editors saved the native protocol on every datasource, which queried over HTTP
+    if (jsonData.protocol === Protocol.Native && (!savedVersion || !isVersionGtOrEq(savedVersion, nativeFlightVersion))) {
+      jsonData.protocol = Protocol.Http;
+    }
+
     // Defaults
 
     if (!jsonData.protocol) {
-      jsonData.protocol = Protocol.Native;
+      jsonData.protocol = Protocol.Http;
     }
 
     if (!jsonData.logs || jsonData.logs.defaultTable === undefined) {